@@ -2,18 +2,17 @@ package controller
 
 import (
 	"context"
+	"encoding/json/v2"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/brave/go-update/extension"
 	"github.com/brave/go-update/logger"
 	"github.com/brave/go-update/omaha"
@@ -23,84 +22,92 @@ import (
 	"github.com/go-chi/chi/v5"
 )
 
-// WidevineExtensionID is used to add an exception to pass the request for Widevine
-// directly to google servers
-var WidevineExtensionID = "oimompecagnajdejgnnjijobebaeigek"
+// WidevineExtensionID is the ID of the Widevine component, which the default
+// routing table passes directly to google servers
+var WidevineExtensionID = extension.WidevineExtensionID
 
 // AllExtensionsMap holds a mapping of extension ID to extension object.
 // This list for tests is populated by extensions.OfferedExtensions.
-// For normal operations of this server it is obtained from the AWS config
-// of the host machine for DynamoDB.
+// For normal operations of this server it is refreshed from the configured
+// extension.Catalog, which defaults to DynamoDB.
 var AllExtensionsMap = extension.NewExtensionMap()
 
-// ExtensionUpdaterTimeout is the amount of time to wait between getting new updates from DynamoDB for the list of extensions
+// ExtensionUpdaterTimeout is the amount of time to wait between getting new updates from the catalog for the list of extensions
 var ExtensionUpdaterTimeout = time.Minute * 10
 
 // ProtocolFactory is the factory used to create protocol handlers
 var ProtocolFactory = &omaha.DefaultFactory{}
 
+// EventSink receives the events of pingbacks, which are dropped when it is nil
+var EventSink extension.EventSink
+
+// Stats counts update checks and events per extension version for /extensions/stats
+var Stats = extension.NewStatsAggregator(extension.DefaultStatsBucketSize, extension.DefaultStatsBucketCount, extension.DefaultStatsMaxKeys)
+
+// Actives counts the daily and monthly active clients per extension for /extensions/stats
+var Actives = extension.NewActiveCounter(extension.DefaultActiveCounterMaxKeys)
+
+// StatsWindows are the rolling windows reported by /extensions/stats
+var StatsWindows = []time.Duration{time.Hour, time.Hour * 24}
+
 // AllExtensionsCache is the global cache instance for all extensions JSON data
 var AllExtensionsCache = middleware.NewJSONCache()
 
-func initExtensionUpdatesFromDynamoDB() {
+// refreshMutex serializes refreshes so that a slow fetch never overwrites a newer one
+var refreshMutex sync.Mutex
+
+// refreshExtensions fetches the full catalog and swaps it into AllExtensionsMap.
+// The refreshed map is built off to the side so that a fetch which fails
+// halfway never leaves a partially updated AllExtensionsMap behind.
+func refreshExtensions(catalog extension.Catalog) {
+	refreshMutex.Lock()
+	defer refreshMutex.Unlock()
+
 	log := logger.New()
-	log.Info("Refreshing extensions from DynamoDB")
-	// Load AWS configuration
-	cfg, err := config.LoadDefaultConfig(context.Background())
+	log.Info("Refreshing extensions", "catalog", catalog.Name())
+
+	fetched, err := catalog.Fetch(context.Background())
 	if err != nil {
-		log.Error("Failed to load AWS config",
+		log.Error("Failed to fetch extensions from catalog",
+			"catalog", catalog.Name(),
 			"error", err)
 		sentry.CaptureException(err)
 		return
 	}
 
-	// Create DynamoDB client with optional custom endpoint
-	clientOpts := func(o *dynamodb.Options) {
-		if endpoint := os.Getenv("DYNAMODB_ENDPOINT"); endpoint != "" {
-			o.BaseEndpoint = aws.String(endpoint)
-		}
+	// Incomplete items, e.g. with null cohorts or releases, would break update
+	// checks. Leaving them out would drop served extensions, so the previous
+	// extensions are kept until the catalog is fixed.
+	if err := extension.ValidateExtensions(fetched); err != nil {
+		log.Error("Invalid extensions in catalog, keeping the previous extensions",
+			"catalog", catalog.Name(),
+			"error", err)
+		sentry.CaptureException(err)
+		return
 	}
-	svc := dynamodb.NewFromConfig(cfg, clientOpts)
 
-	// For most use cases, you probably wouldn't want to scan all entries; however,
-	// for our use case we have a read only small number of items, that are infrequently
-	// updated, usually less than daily by an external tool, and very often queried.
-	paginator := dynamodb.NewScanPaginator(svc, &dynamodb.ScanInput{
-		TableName: aws.String("Extensions"),
-	})
+	extensions := extension.NewExtensionMap()
+	for _, ext := range fetched {
+		// Items may store a version history, a single current release as they
+		// used to, or both. Either way the current release is derived from the history.
+		ext = ext.WithHistory()
 
-	// Process all pages
-	for paginator.HasMorePages() {
-		page, err := paginator.NextPage(context.Background())
-		if err != nil {
-			log.Error("Failed to scan DynamoDB table",
-				"table", "Extensions",
-				"error", err)
-			sentry.CaptureException(err)
-			return
+		// Ensure Size is at least 1 as per Omaha v4 spec
+		if ext.Size == 0 {
+			ext.Size = 1
 		}
 
-		// Update the extensions map
-		for _, item := range page.Items {
-			var ext extension.Extension
-			err := attributevalue.UnmarshalMap(item, &ext)
-			if err != nil {
-				log.Error("Failed to unmarshal DynamoDB item",
-					"error", err)
-				sentry.CaptureException(err)
-				continue
-			}
-
-			// Ensure Size is at least 1 as per Omaha v4 spec
-			if ext.Size == 0 {
-				ext.Size = 1
-			}
+		extensions.Store(ext.ID, ext)
+	}
 
-			AllExtensionsMap.Store(ext.ID, ext)
-		}
+	removed := AllExtensionsMap.Replace(extensions)
+	if len(removed) > 0 {
+		log.Info("Extensions removed from catalog",
+			"removed_count", len(removed),
+			"removed_ids", removed)
 	}
 
-	log.Info("Extension refresh completed", "item_count", AllExtensionsMap.Len())
+	log.Info("Extension refresh completed", "item_count", AllExtensionsMap.Len(), "removed_count", len(removed))
 
 	// Proactively refresh extension cache
 	data, err := AllExtensionsMap.MarshalJSON()
@@ -115,6 +122,38 @@ func initExtensionUpdatesFromDynamoDB() {
 	log.Info("Extensions cache refreshed successfully", "data_size", len(data))
 }
 
+// refreshRoutingTable loads the routing file into the current routing table,
+// keeping the previous table if the file is invalid
+func refreshRoutingTable(routingFile *extension.RoutingFile) {
+	log := logger.New()
+	table, err := routingFile.Load()
+	if err != nil {
+		log.Error("Failed to load routing table",
+			"routing", routingFile.Name(),
+			"error", err)
+		sentry.CaptureException(err)
+		return
+	}
+	extension.SetRoutingTable(table)
+	log.Info("Routing table refreshed", "routing", routingFile.Name(), "rule_count", len(table.Rules))
+}
+
+// refreshDenylist loads the denylist file into the current denylist, keeping
+// the previous denylist if the file is invalid
+func refreshDenylist(denylistFile *extension.DenylistFile) {
+	log := logger.New()
+	denylist, err := denylistFile.Load()
+	if err != nil {
+		log.Error("Failed to load denylist",
+			"denylist", denylistFile.Name(),
+			"error", err)
+		sentry.CaptureException(err)
+		return
+	}
+	extension.SetDenylist(denylist)
+	log.Info("Denylist refreshed", "denylist", denylistFile.Name(), "item_count", denylist.Len())
+}
+
 // RefreshExtensionsTicker updates the list of extensions by
 // calling the specified extensionMapUpdater function
 func RefreshExtensionsTicker(extensionMapUpdater func()) {
@@ -128,16 +167,47 @@ func RefreshExtensionsTicker(extensionMapUpdater func()) {
 	}()
 }
 
-// ExtensionsRouter is the router for /extensions endpoints
-func ExtensionsRouter(_ extension.Extensions, testRouter bool) chi.Router {
-	if !testRouter {
-		RefreshExtensionsTicker(initExtensionUpdatesFromDynamoDB)
+// ExtensionsRouter is the router for /extensions endpoints.
+// AllExtensionsMap is periodically refreshed from catalog, and additionally on every
+// change for catalogs which can be watched. Test routers load catalog once, without refreshing it.
+// The routing table and the denylist are loaded from the files named by ROUTING_RULES_FILE
+// and DENYLIST_FILE, and reloaded whenever they change.
+func ExtensionsRouter(catalog extension.Catalog, testRouter bool) chi.Router {
+	if testRouter {
+		refreshExtensions(catalog)
+	} else {
+		if path := os.Getenv("ROUTING_RULES_FILE"); path != "" {
+			routingFile := extension.NewRoutingFile(path)
+			refreshRoutingTable(routingFile)
+			go routingFile.Watch(context.Background(), func() {
+				refreshRoutingTable(routingFile)
+			})
+		}
+
+		if path := os.Getenv("DENYLIST_FILE"); path != "" {
+			denylistFile := extension.NewDenylistFile(path)
+			refreshDenylist(denylistFile)
+			go denylistFile.Watch(context.Background(), func() {
+				refreshDenylist(denylistFile)
+			})
+		}
+
+		RefreshExtensionsTicker(func() {
+			refreshExtensions(catalog)
+		})
+
+		if watchable, ok := catalog.(extension.WatchableCatalog); ok {
+			go watchable.Watch(context.Background(), func() {
+				refreshExtensions(catalog)
+			})
+		}
 	}
 
 	r := chi.NewRouter()
 	r.Post("/", UpdateExtensions)
 	r.Get("/", WebStoreUpdateExtension)
 	r.With(middleware.JSONCacheMiddleware(AllExtensionsCache)).Get("/all", PrintExtensions)
+	r.Get("/stats", PrintStats)
 	return r
 }
 
@@ -171,6 +241,42 @@ func PrintExtensions(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// PrintStats handles requests to /extensions/stats by returning the update checks and
+// events counted per extension and client version over each of StatsWindows, for the
+// dashboard to show the update success and failure rates of extensions, along with
+// the daily and monthly active clients of extensions. The events counted by an
+// EventSink in memory are returned per error code over the same windows.
+func PrintStats(w http.ResponseWriter, r *http.Request) {
+	logger := logger.FromContext(r.Context())
+
+	response := struct {
+		Windows []extension.StatsWindow `json:"Windows"`
+		Actives []extension.ActiveCount `json:"Actives"`
+		Events  []extension.EventWindow `json:"Events,omitempty"`
+	}{Actives: Actives.Counts()}
+	aggregator, _ := EventSink.(*extension.EventAggregator)
+	for _, window := range StatsWindows {
+		response.Windows = append(response.Windows, Stats.Window(window))
+		if aggregator != nil {
+			response.Events = append(response.Events, aggregator.Window(window))
+		}
+	}
+	data, err := json.Marshal(response)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error in marshal %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	// nosemgrep: go.lang.security.audit.xss.no-direct-write-to-responsewriter.no-direct-write-to-responsewriter
+	_, err = w.Write(data)
+	if err != nil {
+		logger.Error("Error writing stats response", "error", err)
+	}
+}
+
 // WebStoreUpdateExtension is the handler for installing extensions via the GET HTTP method.
 // Supports both Web Store and Brave-hosted MV2 extensions.
 //
@@ -209,12 +315,20 @@ func WebStoreUpdateExtension(w http.ResponseWriter, r *http.Request) {
 		}
 	}()
 
-	xValues := r.URL.Query()["x"]
+	// Extensions are checked like those of update requests, for the client described
+	// by the query parameters
+	query := r.URL.Query()
+	xValues := query["x"]
+	updateRequest := extension.UpdateRequest{
+		UpdaterType:    "chromiumcrx",
+		Channel:        query.Get("prodchannel"),
+		OS:             extension.NormalizeOS(query.Get("os")),
+		Arch:           extension.NormalizeArch(query.Get("arch"), query.Get("os_arch"), query.Get("nacl_arch")),
+		BrowserVersion: query.Get("prodversion"),
+		AcceptFormats:  extension.ParseAcceptFormats(query.Get("acceptformat")),
+	}
 	webStoreResponse := extension.Extensions{}
 
-	AllExtensionsMap.RLock()
-	defer AllExtensionsMap.RUnlock()
-
 	for _, x := range xValues {
 		unescaped, err := url.QueryUnescape(x)
 		if err != nil {
@@ -234,25 +348,47 @@ func WebStoreUpdateExtension(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		foundExtension, ok := AllExtensionsMap.Load(id)
-		if !ok && len(xValues) == 1 {
-			redirectURL := &url.URL{
-				Scheme:   "https",
-				Host:     extension.GetExtensionUpdaterHost(),
-				Path:     "/service/update2/crx",
-				RawQuery: r.URL.RawQuery, // nosemgrep: go.lang.security.injection.open-redirect.open-redirect
+		if entry, denied := extension.CurrentDenylist().Lookup(id); denied {
+			logDenied(logger, entry)
+			webStoreResponse = append(webStoreResponse, extension.Extension{ID: id, Status: entry.UpdateStatus()})
+			recordUpdateCheck(id, v, entry.UpdateStatus())
+			continue
+		}
+
+		_, ok := AllExtensionsMap.Load(id)
+		route := extension.CurrentRoutingTable().Route(id, "chromiumcrx", ok)
+		switch route.Action {
+		case extension.RouteDeny:
+			webStoreResponse = append(webStoreResponse, extension.Extension{ID: id, Status: "restricted"})
+			recordUpdateCheck(id, v, "restricted")
+			continue
+		case extension.RouteRedirect, extension.RouteProxy:
+			// Requests for a single extension are redirected, there is no proxying of GET requests
+			if len(xValues) == 1 {
+				redirectURL := &url.URL{
+					Scheme:   "https",
+					Host:     route.UpstreamHost("chromiumcrx"),
+					Path:     "/service/update2/crx",
+					RawQuery: r.URL.RawQuery, // nosemgrep: go.lang.security.injection.open-redirect.open-redirect
+				}
+				http.Redirect(w, r, redirectURL.String(), http.StatusTemporaryRedirect)
+				return
 			}
-			http.Redirect(w, r, redirectURL.String(), http.StatusTemporaryRedirect)
-			return
 		}
 
-		// We dont have any Brave Extensions yet, so this part of the code is not tested
-		if extension.CompareVersions(v, foundExtension.Version) < 0 {
-			webStoreResponse = append(webStoreResponse, extension.Extension{
-				ID:      foundExtension.ID,
-				Version: foundExtension.Version,
-				SHA256:  foundExtension.SHA256,
-			})
+		// Unknown extensions of requests for several extensions are left out
+		if !ok {
+			recordUpdateCheck(id, v, "noupdate")
+			continue
+		}
+
+		// Extensions which are up to date are left out of the response
+		checkRequest := updateRequest
+		checkRequest.Extensions = extension.Extensions{{ID: id, Version: v}}
+		checked := extension.ProcessExtensionRequests(&checkRequest, AllExtensionsMap)[0]
+		recordUpdateCheck(id, v, extension.GetUpdateStatus(checked))
+		if checked.Status != "noupdate" {
+			webStoreResponse = append(webStoreResponse, checked)
 		}
 	}
 
@@ -282,6 +418,81 @@ func WebStoreUpdateExtension(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// statsAppID returns the app ID the stats of an app are counted by. Clients may
+// send any app ID, so apps which aren't in the catalog are counted together.
+func statsAppID(id string) string {
+	if _, ok := AllExtensionsMap.Load(id); !ok {
+		return extension.UnknownAppID
+	}
+	return id
+}
+
+// recordUpdateCheck counts an update check in Stats, together with the checks of
+// other apps which aren't in the catalog whatever their version
+func recordUpdateCheck(id string, version string, status string) {
+	if appID := statsAppID(id); appID != id {
+		id, version = appID, ""
+	}
+	Stats.RecordUpdateCheck(id, version, status)
+}
+
+// recordEvents parses the events of a pingback, counts the valid ones in Stats and
+// hands them to the EventSink. Clients don't retry pingbacks, so failures are only logged.
+func recordEvents(ctx context.Context, body []byte, contentType string) {
+	log := logger.FromContext(ctx)
+
+	protocolVersion, err := protocol.DetectProtocolVersion(body, contentType)
+	if err != nil {
+		log.Debug("Ignoring malformed pingback", "error", err)
+		return
+	}
+	protocolHandler, err := ProtocolFactory.CreateProtocol(protocolVersion)
+	if err != nil {
+		log.Debug("Ignoring malformed pingback", "error", err)
+		return
+	}
+	pingback, err := protocolHandler.ParseRequest(body, contentType)
+	if err != nil {
+		log.Debug("Ignoring malformed pingback", "error", err)
+		return
+	}
+
+	events, invalid := pingback.ClientEvents()
+	if invalid > 0 {
+		log.Debug("Ignoring invalid events", "count", invalid)
+	}
+	if len(events) == 0 {
+		return
+	}
+	statsEvents := make([]extension.Event, len(events))
+	for i, event := range events {
+		if appID := statsAppID(event.AppID); appID != event.AppID {
+			event.AppID, event.AppVersion = appID, ""
+		}
+		statsEvents[i] = event
+	}
+	_ = Stats.Record(ctx, statsEvents)
+	if EventSink == nil {
+		return
+	}
+	sinkEvents := events
+	if _, ok := EventSink.(*extension.EventAggregator); ok {
+		// Events counted in memory are grouped like the stats
+		sinkEvents = statsEvents
+	}
+	if err := EventSink.Record(ctx, sinkEvents); err != nil {
+		log.Error("Failed to record events", "sink", EventSink.Name(), "error", err)
+	}
+}
+
+// logDenied records that updates of a denylisted extension were denied
+func logDenied(log *slog.Logger, entry extension.DenylistEntry) {
+	log.Info("Denied update of denylisted extension",
+		"id", entry.ID,
+		"reason", entry.Reason,
+		"source", entry.Source)
+}
+
 // UpdateExtensions is the handler for updating extensions
 func UpdateExtensions(w http.ResponseWriter, r *http.Request) {
 	contentType := r.Header.Get("content-type")
@@ -307,8 +518,9 @@ func UpdateExtensions(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if the request is a pingback and ignore it if so
+	// Pingbacks are not answered, their events are recorded by the EventSink
 	if protocol.IsPingbackRequest(body, contentType) {
+		recordEvents(r.Context(), body, contentType)
 		w.WriteHeader(http.StatusNoContent)
 		return
 	}
@@ -340,35 +552,70 @@ func UpdateExtensions(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Special case, if there's only 1 extension in the request and it is not something
-	// we know about, redirect the client to the appropriate update server.
-	if len(updateRequest.Extensions) == 1 {
-		_, ok := AllExtensionsMap.Load(updateRequest.Extensions[0].ID)
-		if !ok {
-			host := extension.GetUpdaterHostByType(updateRequest.UpdaterType)
-			if updateRequest.Extensions[0].ID == WidevineExtensionID {
-				host = "update.googleapis.com"
-			}
+	// Route every extension of the request, see extension.RoutingTable.
+	// Denylisted extensions are denied whatever their route.
+	routingTable := extension.CurrentRoutingTable()
+	denylist := extension.CurrentDenylist()
+	routes := make(map[string]extension.RoutingRule, len(updateRequest.Extensions))
+	deniedStatuses := map[string]string{}
+	for _, ext := range updateRequest.Extensions {
+		if entry, denied := denylist.Lookup(ext.ID); denied {
+			logDenied(logger, entry)
+			routes[ext.ID] = extension.RoutingRule{Action: extension.RouteDeny}
+			deniedStatuses[ext.ID] = entry.UpdateStatus()
+			continue
+		}
+		_, inCatalog := AllExtensionsMap.Load(ext.ID)
+		routes[ext.ID] = routingTable.Route(ext.ID, updateRequest.UpdaterType, inCatalog)
+	}
 
-			path := "/service/update2"
-			if isJSON {
-				path = "/service/update2/json"
-			}
-			redirectURL := &url.URL{
-				Scheme:   "https",
-				Host:     host,
-				Path:     path,
-				RawQuery: r.URL.RawQuery, // nosemgrep: go.lang.security.injection.open-redirect.open-redirect
-			}
+	// Special case, if there's only 1 extension in the request and it is routed
+	// elsewhere, redirect the client to the appropriate update server.
+	if len(updateRequest.Extensions) == 1 {
+		route := routes[updateRequest.Extensions[0].ID]
+		if route.Action == extension.RouteRedirect {
+			redirectURL := upstreamURL(route.UpstreamHost(updateRequest.UpdaterType), isJSON, r.URL.RawQuery)
 			http.Redirect(w, r, redirectURL.String(), http.StatusTemporaryRedirect)
 			return
 		}
 	}
 
-	updateResponse := extension.ProcessExtensionRequests(updateRequest.Extensions, AllExtensionsMap)
+	updateResponse := extension.ProcessExtensionRequests(updateRequest, AllExtensionsMap)
+	for i := range updateResponse {
+		if routes[updateResponse[i].ID].Action == extension.RouteDeny {
+			updateResponse[i].Status = "restricted"
+			if status, ok := deniedStatuses[updateResponse[i].ID]; ok {
+				updateResponse[i].Status = status
+			}
+		}
+	}
+
+	// Other requests with extensions routed elsewhere are answered in part by the
+	// appropriate update servers, for redirected extensions when proxying is enabled
+	upstreamHosts := map[string]string{}
+	for id, route := range routes {
+		if route.Action == extension.RouteProxy || (route.Action == extension.RouteRedirect && UpstreamProxyEnabled) {
+			upstreamHosts[id] = route.UpstreamHost(updateRequest.UpdaterType)
+		}
+	}
+	var proxiedApps []protocol.RawApp
+	if len(upstreamHosts) > 0 {
+		updateResponse, proxiedApps = proxyExtensions(r, body, updateResponse, upstreamHosts)
+	}
+
+	// The stats count the extensions answered here, by the version of the client
+	requested := make(map[string]extension.Extension, len(updateRequest.Extensions))
+	for _, ext := range updateRequest.Extensions {
+		requested[ext.ID] = ext
+	}
+	for _, ext := range updateResponse {
+		recordUpdateCheck(ext.ID, requested[ext.ID].Version, extension.GetUpdateStatus(ext))
+		Actives.Record(statsAppID(ext.ID), requested[ext.ID].Ping)
+	}
 
 	// Use the same protocol version for response as the request for v4
-	// Otherwise default to 3.1 for backward compatibility
+	// Otherwise default to 3.1 for backward compatibility. The v4 handler
+	// answers XML requests with 3.1 XML responses, v4 being JSON only.
 	responseProtocolVersion := "3.1"
 	if protocolVersion == "4.0" {
 		responseProtocolVersion = protocolVersion
@@ -392,6 +639,12 @@ func UpdateExtensions(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	data, err = protocol.AppendResponseApps(data, responseContentType, proxiedApps)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error formatting response: %v", err), http.StatusInternalServerError)
+		return
+	}
+
 	// Add JSON prefix to the response body (required by the Omaha protocol)
 	//
 	// See: https://chromium.googlesource.com/chromium/src/+/refs/heads/main/docs/updater/protocol_4.md#safe-json-prefixes
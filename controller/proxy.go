@@ -0,0 +1,167 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/brave/go-update/extension"
+	"github.com/brave/go-update/logger"
+	"github.com/brave/go-update/omaha/protocol"
+)
+
+// UpstreamProxyEnabled makes update requests mixing extensions we serve and redirected
+// extensions, such as the ones missing from the catalog, forward the redirected extensions
+// to their upstream updater instead of answering them with error-unknownApplication.
+// It is set with UPSTREAM_PROXY_ENABLED=true.
+var UpstreamProxyEnabled = os.Getenv("UPSTREAM_PROXY_ENABLED") == "true"
+
+// UpstreamProxyTimeout is the amount of time to wait for upstream updaters, set
+// with UPSTREAM_PROXY_TIMEOUT
+var UpstreamProxyTimeout = durationFromEnv("UPSTREAM_PROXY_TIMEOUT", time.Second*5)
+
+// UpstreamHTTPClient is the client used to send requests to upstream updaters
+var UpstreamHTTPClient = &http.Client{}
+
+func durationFromEnv(key string, fallback time.Duration) time.Duration {
+	if value, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return value
+	}
+	return fallback
+}
+
+// upstreamURL returns the URL of the update server at host
+func upstreamURL(host string, isJSON bool, rawQuery string) *url.URL {
+	path := "/service/update2"
+	if isJSON {
+		path = "/service/update2/json"
+	}
+	return &url.URL{
+		Scheme:   "https",
+		Host:     host,
+		Path:     path,
+		RawQuery: rawQuery, // nosemgrep: go.lang.security.injection.open-redirect.open-redirect
+	}
+}
+
+// proxyExtensions forwards the extensions in upstreamHosts, a mapping of extension
+// ID to the host of its upstream updater, to their upstream updaters. It returns
+// updateResponse without the extensions the upstream updaters answered, along with
+// their answers in protocol 3.1 for protocol v3 requests. Extensions whose upstream updater fails or times out are kept
+// with an error-internal status, so that clients retry them later.
+func proxyExtensions(r *http.Request, body []byte, updateResponse extension.Extensions,
+	upstreamHosts map[string]string,
+) (extension.Extensions, []protocol.RawApp) {
+	contentType := r.Header.Get("content-type")
+	isJSON := protocol.IsJSONContentType(contentType)
+
+	// Upstream updaters sign their responses for their own request, so CUP
+	// parameters are not forwarded
+	query := r.URL.Query()
+	query.Del("cup2key")
+	query.Del("cup2hreq")
+
+	idsByURL := map[string]map[string]bool{}
+	for id, host := range upstreamHosts {
+		upstream := upstreamURL(host, isJSON, query.Encode()).String()
+		if idsByURL[upstream] == nil {
+			idsByURL[upstream] = map[string]bool{}
+		}
+		idsByURL[upstream][id] = true
+	}
+
+	// Upstream updaters answer in the protocol version of the request, while protocol
+	// 3.0 requests are answered in protocol 3.1. These requests are forwarded as
+	// protocol 3.1 requests, so that the upstream apps fit the response.
+	if version, err := protocol.DetectProtocolVersion(body, contentType); err == nil && version == "3.0" {
+		body, err = protocol.SetRequestProtocol(body, contentType, "3.1")
+		if err != nil {
+			logger.FromContext(r.Context()).Warn("Failed to forward request upstream", "error", err)
+			idsByURL = nil
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), UpstreamProxyTimeout)
+	defer cancel()
+
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	answered := map[string]protocol.RawApp{}
+	for upstream, ids := range idsByURL {
+		wg.Go(func() {
+			apps, err := fetchUpstreamApps(ctx, upstream, body, contentType, ids)
+			if err != nil {
+				logger.FromContext(r.Context()).Warn("Upstream updater failed",
+					"upstream", upstream,
+					"app_count", len(ids),
+					"error", err)
+				return
+			}
+			mutex.Lock()
+			defer mutex.Unlock()
+			for _, app := range apps {
+				if ids[app.ID] {
+					answered[app.ID] = app
+				}
+			}
+		})
+	}
+	wg.Wait()
+
+	remaining := extension.Extensions{}
+	proxied := []protocol.RawApp{}
+	for _, ext := range updateResponse {
+		if app, ok := answered[ext.ID]; ok {
+			proxied = append(proxied, app)
+			continue
+		}
+		if _, ok := upstreamHosts[ext.ID]; ok {
+			ext.Status = "error-internal"
+		}
+		remaining = append(remaining, ext)
+	}
+	return remaining, proxied
+}
+
+// fetchUpstreamApps sends the update request in body, limited to the extensions
+// in ids, to upstream and returns the apps of its response
+func fetchUpstreamApps(ctx context.Context, upstream string, body []byte, contentType string,
+	ids map[string]bool,
+) ([]protocol.RawApp, error) {
+	upstreamBody, err := protocol.FilterRequestApps(body, contentType, func(appID string) bool {
+		return ids[appID]
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error filtering request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, upstream, bytes.NewReader(upstreamBody))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("content-type", contentType)
+
+	resp, err := UpstreamHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	limit := int64(1024 * 1024 * 10) // 10MiB
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit))
+	if err != nil {
+		return nil, fmt.Errorf("error reading response: %w", err)
+	}
+	return protocol.ResponseApps(data, contentType)
+}
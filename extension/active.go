@@ -0,0 +1,188 @@
+package extension
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Values of pings for clients which never pinged before and clients which
+// don't know when they last pinged
+const (
+	PingNever   = -1
+	PingUnknown = -2
+)
+
+// MonthlyActiveDays is the number of days over which monthly active clients are counted
+const MonthlyActiveDays = 28
+
+// DefaultActiveCounterMaxKeys is the number of extensions counted per day by the
+// active counter of the server
+const DefaultActiveCounterMaxKeys = 5000
+
+var dayStartEpoch = time.Date(2007, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// ElapsedDays returns the day of t as the number of days since Jan 1, 2007, which
+// is the elapsed_days of daystart in responses and the date of rd and ad pings
+func ElapsedDays(t time.Time) int {
+	return int(t.UTC().Sub(dayStartEpoch).Hours() / 24)
+}
+
+// ElapsedSeconds returns the number of seconds since the start of the day of t,
+// which is the elapsed_seconds of daystart in responses
+func ElapsedSeconds(t time.Time) int {
+	t = t.UTC()
+	return int(t.Sub(t.Truncate(time.Hour * 24)).Seconds())
+}
+
+// Ping holds the ping of an app in an update check. Clients send either the
+// number of days since their last roll call and activity (r and a), or the dates
+// of their last roll call and activity as returned by daystart (rd and ad). The
+// activity is only sent by clients which were active since their last ping.
+// Values which were not sent are nil.
+type Ping struct {
+	RollCallDays *int
+	ActiveDays   *int
+	RollCallDate *int
+	ActiveDate   *int
+}
+
+// lastDay returns the day of the last ping, preferring the date over the number
+// of days. Clients which never pinged are handled like clients which last pinged
+// MonthlyActiveDays days ago. It returns false for clients which didn't send the
+// value or don't know it.
+func lastDay(today int, days *int, date *int) (int, bool) {
+	if date != nil && *date != PingUnknown {
+		if *date == PingNever {
+			return today - MonthlyActiveDays, true
+		}
+		return *date, true
+	}
+	if days != nil && *days != PingUnknown {
+		if *days == PingNever {
+			return today - MonthlyActiveDays, true
+		}
+		return today - *days, true
+	}
+	return 0, false
+}
+
+// ActiveCount holds the number of clients of an extension
+type ActiveCount struct {
+	AppID string `json:"AppID"`
+	// DailyUsers and DailyActives count the clients checking for updates and the
+	// active clients today
+	DailyUsers   int64 `json:"DailyUsers"`
+	DailyActives int64 `json:"DailyActives"`
+	// MonthlyActives counts the clients active over the last MonthlyActiveDays days
+	MonthlyActives int64 `json:"MonthlyActives"`
+}
+
+type activeDay struct {
+	rollCalls int64
+	// actives holds the number of clients active for the first time today, by the
+	// number of days since they were last active, where MonthlyActiveDays means
+	// MonthlyActiveDays or more, or never
+	actives [MonthlyActiveDays + 1]int64
+}
+
+// ActiveCounter counts daily and monthly active clients per extension from their
+// pings, without keeping any client identifier. Clients ping with the day of their
+// last roll call and activity, so each one is counted on the first ping of a day
+// only. It holds at most maxKeys extensions per day and leaves out new ones once full.
+type ActiveCounter struct {
+	mutex   sync.Mutex
+	maxKeys int
+	days    map[int]map[string]*activeDay
+	now     func() time.Time
+}
+
+// NewActiveCounter creates an ActiveCounter holding at most maxKeys extensions per day
+func NewActiveCounter(maxKeys int) *ActiveCounter {
+	return &ActiveCounter{maxKeys: maxKeys, days: map[int]map[string]*activeDay{}, now: time.Now}
+}
+
+// Record counts the ping of a client for the extension
+func (c *ActiveCounter) Record(appID string, ping *Ping) {
+	if ping == nil {
+		return
+	}
+	today := ElapsedDays(c.now())
+	lastRollCall, knownRollCall := lastDay(today, ping.RollCallDays, ping.RollCallDate)
+	newRollCall := knownRollCall && lastRollCall < today
+	lastActive, knownActive := lastDay(today, ping.ActiveDays, ping.ActiveDate)
+	newActive := knownActive && lastActive < today
+	if !newRollCall && !newActive {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	day, ok := c.days[today]
+	if !ok {
+		// Days which no longer count for monthly actives are dropped
+		for d := range c.days {
+			if d <= today-MonthlyActiveDays {
+				delete(c.days, d)
+			}
+		}
+		day = map[string]*activeDay{}
+		c.days[today] = day
+	}
+	counts, ok := day[appID]
+	if !ok {
+		if len(day) >= c.maxKeys {
+			return
+		}
+		counts = &activeDay{}
+		day[appID] = counts
+	}
+
+	if newRollCall {
+		counts.rollCalls++
+	}
+	if newActive {
+		counts.actives[min(today-lastActive, MonthlyActiveDays)]++
+	}
+}
+
+// Counts returns the number of clients of every extension, sorted by extension ID
+func (c *ActiveCounter) Counts() []ActiveCount {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	today := ElapsedDays(c.now())
+	totals := map[string]*ActiveCount{}
+	for day, extensions := range c.days {
+		age := today - day
+		if age < 0 || age >= MonthlyActiveDays {
+			continue
+		}
+		for appID, counts := range extensions {
+			total, ok := totals[appID]
+			if !ok {
+				total = &ActiveCount{AppID: appID}
+				totals[appID] = total
+			}
+			if age == 0 {
+				total.DailyUsers = counts.rollCalls
+				for _, actives := range counts.actives {
+					total.DailyActives += actives
+				}
+			}
+			// Clients are counted on their first active day within the window, when
+			// their previous activity is older than the window
+			for gap := MonthlyActiveDays - age; gap <= MonthlyActiveDays; gap++ {
+				total.MonthlyActives += counts.actives[gap]
+			}
+		}
+	}
+
+	result := make([]ActiveCount, 0, len(totals))
+	for _, total := range totals {
+		result = append(result, *total)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].AppID < result[j].AppID
+	})
+	return result
+}
@@ -0,0 +1,60 @@
+package extension
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestElapsedDays(t *testing.T) {
+	now := time.Date(2024, 3, 15, 1, 2, 3, 0, time.UTC)
+	assert.Equal(t, 6283, ElapsedDays(now))
+	assert.Equal(t, 3723, ElapsedSeconds(now))
+	assert.Equal(t, 0, ElapsedDays(time.Date(2007, 1, 1, 23, 59, 0, 0, time.UTC)))
+}
+
+func TestActiveCounter(t *testing.T) {
+	intPtr := func(value int) *int { return &value }
+
+	now := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+	today := ElapsedDays(now)
+	counter := NewActiveCounter(2)
+	counter.now = func() time.Time { return now }
+
+	// A new install, then a client which already checked in today
+	counter.Record("aaaa", &Ping{RollCallDays: intPtr(PingNever), ActiveDays: intPtr(PingNever)})
+	counter.Record("aaaa", &Ping{RollCallDays: intPtr(0), ActiveDays: intPtr(0)})
+	// A client which checked in yesterday, was active 10 days ago and is active again
+	counter.Record("aaaa", &Ping{RollCallDate: intPtr(today - 1), ActiveDate: intPtr(today - 10)})
+	// A client which checked in a week ago and was not active since
+	counter.Record("aaaa", &Ping{RollCallDate: intPtr(today - 7)})
+	// Apps without pings or with unknown pings are not counted
+	counter.Record("bbbb", nil)
+	counter.Record("bbbb", &Ping{})
+	counter.Record("bbbb", &Ping{RollCallDays: intPtr(PingUnknown)})
+	counter.Record("cccc", &Ping{RollCallDays: intPtr(1)})
+	// A third extension doesn't fit
+	counter.Record("dddd", &Ping{RollCallDays: intPtr(1)})
+
+	assert.Equal(t, []ActiveCount{
+		{AppID: "aaaa", DailyUsers: 3, DailyActives: 2, MonthlyActives: 1},
+		{AppID: "cccc", DailyUsers: 1},
+	}, counter.Counts())
+
+	// Clients are counted once over the month
+	now = now.Add(time.Hour * 24 * 20)
+	today = ElapsedDays(now)
+	counter.Record("aaaa", &Ping{RollCallDate: intPtr(today - 20), ActiveDate: intPtr(today - 20)})
+	counter.Record("aaaa", &Ping{RollCallDate: intPtr(today - 1), ActiveDate: intPtr(today - 40)})
+	assert.Equal(t, []ActiveCount{
+		{AppID: "aaaa", DailyUsers: 2, DailyActives: 2, MonthlyActives: 3},
+		{AppID: "cccc"},
+	}, counter.Counts())
+
+	// Days drop out of the month
+	now = now.Add(time.Hour * 24 * 10)
+	assert.Equal(t, []ActiveCount{
+		{AppID: "aaaa", MonthlyActives: 2},
+	}, counter.Counts())
+}
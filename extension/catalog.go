@@ -0,0 +1,357 @@
+package extension
+
+import (
+	"bytes"
+	"context"
+	"encoding/json/v2"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Catalog is a source for the complete list of extensions the server offers.
+// The server periodically fetches the catalog and swaps the result into the
+// map it serves update checks from.
+type Catalog interface {
+	// Name returns a short human readable description of the catalog for logging
+	Name() string
+
+	// Fetch returns every extension currently in the catalog
+	Fetch(ctx context.Context) (Extensions, error)
+}
+
+func validatePlatforms(osList []string, archList []string) error {
+	for _, os := range osList {
+		if NormalizeOS(os) != os {
+			return fmt.Errorf("has unsupported OS %q", os)
+		}
+	}
+	for _, arch := range archList {
+		if NormalizeArch(arch) != arch {
+			return fmt.Errorf("has unsupported Arch %q", arch)
+		}
+	}
+	return nil
+}
+
+// validateDownloadURL checks that a package URL is an absolute http or https URL
+func validateDownloadURL(rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+		return fmt.Errorf("has invalid download URL %q", rawURL)
+	}
+	return nil
+}
+
+// WatchableCatalog is a Catalog which can detect changes to its contents
+// between the periodic refreshes.
+type WatchableCatalog interface {
+	Catalog
+
+	// Watch blocks until ctx is done, calling onChange whenever the contents
+	// of the catalog may have changed.
+	Watch(ctx context.Context, onChange func())
+}
+
+// FileCatalogPollInterval is the amount of time to wait between checks of a
+// FileCatalog's file for changes
+var FileCatalogPollInterval = time.Second * 2
+
+// ValidateExtensions checks that a list of extensions is complete enough to be
+// served: every extension needs a unique ID and must pass ValidateExtension.
+func ValidateExtensions(extensions Extensions) error {
+	seen := make(map[string]bool, len(extensions))
+	for i, extension := range extensions {
+		if extension.ID == "" {
+			return fmt.Errorf("extension at index %d has empty ID", i)
+		}
+		if seen[extension.ID] {
+			return fmt.Errorf("extension %s is listed more than once", extension.ID)
+		}
+		seen[extension.ID] = true
+		if err := ValidateExtension(extension); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidateExtension checks that an extension is complete enough to be served:
+// it needs an ID and a version, either of its own or derived from its version
+// history, and unless it is blacklisted the SHA256 of its package and of its
+// patches, and complete releases, cohorts and download locations.
+func ValidateExtension(extension Extension) error {
+	extension = extension.WithHistory()
+	if extension.ID == "" {
+		return fmt.Errorf("extension has empty ID")
+	}
+	if extension.Version == "" {
+		return fmt.Errorf("extension %s has empty Version", extension.ID)
+	}
+	if extension.Blacklisted {
+		return nil
+	}
+	if extension.SHA256 == "" {
+		return fmt.Errorf("extension %s has empty SHA256", extension.ID)
+	}
+	for fp, patchInfo := range extension.PatchList {
+		if err := validatePatch(patchInfo); err != nil {
+			return fmt.Errorf("extension %s patch from %s %w", extension.ID, fp, err)
+		}
+	}
+	if extension.RolloutPercentage < 0 || extension.RolloutPercentage > 100 {
+		return fmt.Errorf("extension %s has RolloutPercentage %d outside of [0, 100]", extension.ID, extension.RolloutPercentage)
+	}
+	if previous := extension.PreviousRelease; previous != nil && (previous.Version == "" || previous.SHA256 == "") {
+		return fmt.Errorf("extension %s has incomplete PreviousRelease", extension.ID)
+	}
+	if extension.MinBrowserVersion != "" && extension.MaxBrowserVersion != "" &&
+		CompareVersions(extension.MinBrowserVersion, extension.MaxBrowserVersion) > 0 {
+		return fmt.Errorf("extension %s has MinBrowserVersion greater than MaxBrowserVersion", extension.ID)
+	}
+	if err := validatePlatforms(extension.OS, extension.Arch); err != nil {
+		return fmt.Errorf("extension %s %w", extension.ID, err)
+	}
+	for _, host := range extension.DownloadHosts {
+		if host == "" || strings.ContainsAny(host, "/?#") {
+			return fmt.Errorf("extension %s has invalid download host %q", extension.ID, host)
+		}
+	}
+	if extension.URL != "" {
+		if err := validateDownloadURL(extension.URL); err != nil {
+			return fmt.Errorf("extension %s %w", extension.ID, err)
+		}
+	}
+	if extension.URLTemplate != "" {
+		// The template is checked as filled in for a sample host
+		sample := extension
+		sample.URL = ""
+		sample.DownloadHosts = []string{"example.com"}
+		if err := validateDownloadURL(GetPackageURLs(sample)[0]); err != nil {
+			return fmt.Errorf("extension %s has invalid URLTemplate %q", extension.ID, extension.URLTemplate)
+		}
+	}
+	for _, release := range extension.PlatformReleases {
+		if release == nil || release.Version == "" || release.SHA256 == "" {
+			return fmt.Errorf("extension %s has incomplete platform release", extension.ID)
+		}
+		if len(release.OS) == 0 && len(release.Arch) == 0 {
+			return fmt.Errorf("extension %s has platform release %s without OS or Arch", extension.ID, release.Version)
+		}
+		if err := validatePlatforms(release.OS, release.Arch); err != nil {
+			return fmt.Errorf("extension %s platform release %s %w", extension.ID, release.Version, err)
+		}
+	}
+	served := false
+	for _, release := range extension.Releases {
+		if release.Version == "" || release.SHA256 == "" {
+			return fmt.Errorf("extension %s has incomplete release in its version history", extension.ID)
+		}
+		if release.URL != "" {
+			if err := validateDownloadURL(release.URL); err != nil {
+				return fmt.Errorf("extension %s release %s %w", extension.ID, release.Version, err)
+			}
+		}
+		if !release.Served() && release.State != ReleaseStatePulled {
+			return fmt.Errorf("extension %s release %s has unsupported State %q", extension.ID, release.Version, release.State)
+		}
+		served = served || release.Served()
+	}
+	if !served {
+		return fmt.Errorf("extension %s has no release which was not pulled", extension.ID)
+	}
+	if err := validateCohorts(extension.Cohorts); err != nil {
+		return fmt.Errorf("extension %s %w", extension.ID, err)
+	}
+	for channel, release := range extension.Channels {
+		if _, ok := moreStableChannels[channel]; !ok {
+			return fmt.Errorf("extension %s has release for unsupported channel %q", extension.ID, channel)
+		}
+		if release == nil || release.Version == "" || release.SHA256 == "" {
+			return fmt.Errorf("extension %s has incomplete release for channel %s", extension.ID, channel)
+		}
+	}
+	return nil
+}
+
+// NewCatalogFromEnv returns the Catalog selected by the EXTENSIONS_CATALOG
+// environment variable:
+//   - "dynamodb" (default) scans the DynamoDB table named by DYNAMODB_EXTENSIONS_TABLE
+//   - "file" reads the JSON or YAML file named by EXTENSIONS_CATALOG_FILE
+//   - "memory" serves the compiled-in OfferedExtensions
+func NewCatalogFromEnv() (Catalog, error) {
+	switch catalogType := lookupEnvFallback("EXTENSIONS_CATALOG", "dynamodb"); catalogType {
+	case "dynamodb":
+		return NewDynamoDBCatalog(lookupEnvFallback("DYNAMODB_EXTENSIONS_TABLE", "Extensions")), nil
+	case "file":
+		path := os.Getenv("EXTENSIONS_CATALOG_FILE")
+		if path == "" {
+			return nil, fmt.Errorf("EXTENSIONS_CATALOG_FILE must be set when EXTENSIONS_CATALOG is %q", catalogType)
+		}
+		return NewFileCatalog(path), nil
+	case "memory":
+		return NewMemoryCatalog(OfferedExtensions), nil
+	default:
+		return nil, fmt.Errorf("unsupported extensions catalog: %q", catalogType)
+	}
+}
+
+// MemoryCatalog is a Catalog backed by an in-memory list of extensions.
+// It is safe for use across goroutines.
+type MemoryCatalog struct {
+	sync.RWMutex
+	extensions Extensions
+}
+
+// NewMemoryCatalog creates a MemoryCatalog holding a copy of extensions
+func NewMemoryCatalog(extensions Extensions) *MemoryCatalog {
+	c := &MemoryCatalog{}
+	c.Set(extensions)
+	return c
+}
+
+// Name returns the description of the catalog
+func (c *MemoryCatalog) Name() string {
+	return "memory"
+}
+
+// Fetch returns a copy of the extensions held by the catalog
+func (c *MemoryCatalog) Fetch(_ context.Context) (Extensions, error) {
+	c.RLock()
+	defer c.RUnlock()
+	return append(Extensions{}, c.extensions...), nil
+}
+
+// Set replaces the extensions held by the catalog
+func (c *MemoryCatalog) Set(extensions Extensions) {
+	c.Lock()
+	defer c.Unlock()
+	c.extensions = append(Extensions{}, extensions...)
+}
+
+// FileCatalog is a Catalog backed by a local JSON or YAML file. The file holds
+// either a list of extensions or a mapping of extension ID to extension, as
+// returned by /extensions/all, using the field names of Extension.
+// The file is validated on every fetch and watched for changes.
+type FileCatalog struct {
+	path string
+}
+
+// NewFileCatalog creates a FileCatalog reading from path. Files with a .yaml or
+// .yml extension are parsed as YAML, anything else as JSON.
+func NewFileCatalog(path string) *FileCatalog {
+	return &FileCatalog{path: path}
+}
+
+// Name returns the description of the catalog
+func (c *FileCatalog) Name() string {
+	return "file:" + c.path
+}
+
+// Fetch reads and parses the catalog file
+func (c *FileCatalog) Fetch(_ context.Context) (Extensions, error) {
+	data, err := readJSONOrYAMLFile(c.path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading catalog file: %w", err)
+	}
+
+	extensions, err := parseCatalogJSON(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ValidateExtensions(extensions); err != nil {
+		return nil, fmt.Errorf("invalid catalog file: %w", err)
+	}
+
+	return extensions, nil
+}
+
+// Watch polls the catalog file every FileCatalogPollInterval and calls onChange
+// when its size or modification time changes. Replacing the file, as most
+// editors and deployment tools do, is detected as well.
+func (c *FileCatalog) Watch(ctx context.Context, onChange func()) {
+	watchFile(ctx, c.path, onChange)
+}
+
+// readJSONOrYAMLFile returns the contents of a JSON file, or of a YAML file
+// converted to JSON for files with a .yaml or .yml extension
+func readJSONOrYAMLFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		// Round-trip YAML through JSON so that both formats share the
+		// field names and types of the JSON encoding.
+		var doc any
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("error parsing YAML: %w", err)
+		}
+		data, err = json.Marshal(doc)
+		if err != nil {
+			return nil, fmt.Errorf("error converting YAML: %w", err)
+		}
+	}
+	return data, nil
+}
+
+// watchFile polls path every FileCatalogPollInterval until ctx is done, and
+// calls onChange when its size or modification time changes
+func watchFile(ctx context.Context, path string, onChange func()) {
+	ticker := time.NewTicker(FileCatalogPollInterval)
+	defer ticker.Stop()
+
+	last, _ := os.Stat(path)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			info, err := os.Stat(path)
+			if err != nil {
+				// Keep serving the last good contents while the file is missing
+				continue
+			}
+			if last == nil || info.Size() != last.Size() || !info.ModTime().Equal(last.ModTime()) {
+				last = info
+				onChange()
+			}
+		}
+	}
+}
+
+func parseCatalogJSON(data []byte) (Extensions, error) {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) == 0 || trimmed[0] != '{' {
+		var extensions Extensions
+		if err := json.Unmarshal(data, &extensions); err != nil {
+			return nil, fmt.Errorf("error parsing catalog: %w", err)
+		}
+		return extensions, nil
+	}
+
+	var extensionsByID map[string]Extension
+	if err := json.Unmarshal(data, &extensionsByID); err != nil {
+		return nil, fmt.Errorf("error parsing catalog: %w", err)
+	}
+	extensions := make(Extensions, 0, len(extensionsByID))
+	for id, extension := range extensionsByID {
+		if extension.ID == "" {
+			extension.ID = id
+		}
+		extensions = append(extensions, extension)
+	}
+	sort.Slice(extensions, func(i, j int) bool {
+		return extensions[i].ID < extensions[j].ID
+	})
+	return extensions, nil
+}
@@ -0,0 +1,334 @@
+package extension
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryCatalog(t *testing.T) {
+	catalog := NewMemoryCatalog(OfferedExtensions)
+	assert.Equal(t, "memory", catalog.Name())
+
+	extensions, err := catalog.Fetch(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, OfferedExtensions, extensions)
+
+	// Fetched extensions are a copy of the catalog contents
+	extensions[0].Version = "9.9.9"
+	extensions, err = catalog.Fetch(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, OfferedExtensions[0].Version, extensions[0].Version)
+
+	catalog.Set(Extensions{OfferedExtensions[1]})
+	extensions, err = catalog.Fetch(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, Extensions{OfferedExtensions[1]}, extensions)
+}
+
+func TestFileCatalog(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(name string, contents string) string {
+		path := filepath.Join(dir, name)
+		assert.Nil(t, os.WriteFile(path, []byte(contents), 0o600))
+		return path
+	}
+
+	// JSON list of extensions
+	path := writeFile("extensions.json", `[
+		{"ID": "ldimlcelhnjgpjjemdjokpgeeikdinbm", "Version": "1.0.0", "SHA256": "abc", "Title": "Brave Light Theme",
+		 "PatchList": {"fp1": {"hashdiff": "def", "namediff": "fp1.puff", "sizediff": 12}}},
+		{"ID": "bfdgpgibhagkpdlnjonhkabjoijopoge", "Version": "1.0.1", "SHA256": "ghi", "Blacklisted": true}
+	]`)
+	catalog := NewFileCatalog(path)
+	assert.Equal(t, "file:"+path, catalog.Name())
+	extensions, err := catalog.Fetch(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(extensions))
+	assert.Equal(t, "ldimlcelhnjgpjjemdjokpgeeikdinbm", extensions[0].ID)
+	assert.Equal(t, "1.0.0", extensions[0].Version)
+	assert.Equal(t, "Brave Light Theme", extensions[0].Title)
+	assert.Equal(t, &PatchInfo{Hashdiff: "def", Namediff: "fp1.puff", Sizediff: 12}, extensions[0].PatchList["fp1"])
+	assert.True(t, extensions[1].Blacklisted)
+
+	// JSON mapping of ID to extension, as served by /extensions/all
+	path = writeFile("all.json", `{
+		"bfdgpgibhagkpdlnjonhkabjoijopoge": {"Version": "1.0.1", "SHA256": "ghi"},
+		"ldimlcelhnjgpjjemdjokpgeeikdinbm": {"ID": "ldimlcelhnjgpjjemdjokpgeeikdinbm", "Version": "1.0.0", "SHA256": "abc"}
+	}`)
+	extensions, err = NewFileCatalog(path).Fetch(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(extensions))
+	assert.Equal(t, "bfdgpgibhagkpdlnjonhkabjoijopoge", extensions[0].ID)
+	assert.Equal(t, "ldimlcelhnjgpjjemdjokpgeeikdinbm", extensions[1].ID)
+
+	// YAML uses the same field names as JSON
+	path = writeFile("extensions.yaml", `
+- ID: ldimlcelhnjgpjjemdjokpgeeikdinbm
+  Version: 1.0.0
+  SHA256: abc
+  Size: 1024
+  PatchList:
+    fp1:
+      hashdiff: def
+      namediff: fp1.puff
+      sizediff: 12
+`)
+	extensions, err = NewFileCatalog(path).Fetch(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(extensions))
+	assert.Equal(t, "1.0.0", extensions[0].Version)
+	assert.Equal(t, uint64(1024), extensions[0].Size)
+	assert.Equal(t, 12, extensions[0].PatchList["fp1"].Sizediff)
+
+	// Malformed files return an error
+	_, err = NewFileCatalog(writeFile("bad.json", `[{"ID": `)).Fetch(context.Background())
+	assert.NotNil(t, err)
+	_, err = NewFileCatalog(writeFile("bad.yml", "- ID: [")).Fetch(context.Background())
+	assert.NotNil(t, err)
+
+	// Missing files return an error
+	_, err = NewFileCatalog(filepath.Join(dir, "missing.json")).Fetch(context.Background())
+	assert.NotNil(t, err)
+}
+
+func TestNewCatalogFromEnv(t *testing.T) {
+	catalog, err := NewCatalogFromEnv()
+	assert.Nil(t, err)
+	assert.Equal(t, "dynamodb:Extensions", catalog.Name())
+
+	t.Setenv("DYNAMODB_EXTENSIONS_TABLE", "StagingExtensions")
+	catalog, err = NewCatalogFromEnv()
+	assert.Nil(t, err)
+	assert.Equal(t, "dynamodb:StagingExtensions", catalog.Name())
+
+	t.Setenv("EXTENSIONS_CATALOG", "memory")
+	catalog, err = NewCatalogFromEnv()
+	assert.Nil(t, err)
+	assert.Equal(t, "memory", catalog.Name())
+
+	t.Setenv("EXTENSIONS_CATALOG", "file")
+	_, err = NewCatalogFromEnv()
+	assert.NotNil(t, err)
+
+	t.Setenv("EXTENSIONS_CATALOG_FILE", "/etc/go-update/extensions.yaml")
+	catalog, err = NewCatalogFromEnv()
+	assert.Nil(t, err)
+	assert.Equal(t, "file:/etc/go-update/extensions.yaml", catalog.Name())
+
+	t.Setenv("EXTENSIONS_CATALOG", "etcd")
+	_, err = NewCatalogFromEnv()
+	assert.NotNil(t, err)
+}
+
+func TestValidateExtensions(t *testing.T) {
+	assert.Nil(t, ValidateExtensions(OfferedExtensions))
+	assert.Nil(t, ValidateExtensions(Extensions{}))
+
+	valid := Extension{
+		ID:        "ldimlcelhnjgpjjemdjokpgeeikdinbm",
+		Version:   "1.0.0",
+		SHA256:    "abc",
+		PatchList: map[string]*PatchInfo{"fp1": {Hashdiff: "def"}},
+	}
+	assert.Nil(t, ValidateExtensions(Extensions{valid}))
+
+	missingID := valid
+	missingID.ID = ""
+	assert.ErrorContains(t, ValidateExtensions(Extensions{missingID}), "empty ID")
+
+	assert.ErrorContains(t, ValidateExtensions(Extensions{valid, valid}), "listed more than once")
+
+	missingVersion := valid
+	missingVersion.Version = ""
+	assert.ErrorContains(t, ValidateExtensions(Extensions{missingVersion}), "empty Version")
+
+	missingSHA256 := valid
+	missingSHA256.SHA256 = ""
+	assert.ErrorContains(t, ValidateExtensions(Extensions{missingSHA256}), "empty SHA256")
+
+	// Blacklisted extensions are never offered, so they don't need a package
+	missingSHA256.Blacklisted = true
+	assert.Nil(t, ValidateExtensions(Extensions{missingSHA256}))
+
+	missingHashdiff := valid
+	missingHashdiff.PatchList = map[string]*PatchInfo{"fp1": {Namediff: "fp1.puff"}}
+	assert.ErrorContains(t, ValidateExtensions(Extensions{missingHashdiff}), "empty Hashdiff")
+	missingHashdiff.PatchList["fp1"] = &PatchInfo{Hashdiff: "def", Alternatives: []*PatchInfo{{Format: PatchFormatZucchini}}}
+	assert.ErrorContains(t, ValidateExtensions(Extensions{missingHashdiff}), "patch from fp1 has empty Hashdiff")
+
+	rollout := valid
+	rollout.RolloutPercentage = 101
+	assert.ErrorContains(t, ValidateExtensions(Extensions{rollout}), "RolloutPercentage")
+	rollout.RolloutPercentage = 5
+	rollout.PreviousRelease = &Release{Version: "0.9.0"}
+	assert.ErrorContains(t, ValidateExtensions(Extensions{rollout}), "incomplete PreviousRelease")
+	rollout.PreviousRelease.SHA256 = "xyz"
+	assert.Nil(t, ValidateExtensions(Extensions{rollout}))
+
+	history := valid
+	history.Releases = []*Release{{Version: "0.9.0"}}
+	assert.ErrorContains(t, ValidateExtensions(Extensions{history}), "incomplete release in its version history")
+	history.Releases[0].SHA256 = "xyz"
+	assert.Nil(t, ValidateExtensions(Extensions{history}))
+	history.Releases[0].State = "draft"
+	assert.ErrorContains(t, ValidateExtensions(Extensions{history}), `unsupported State "draft"`)
+
+	// The current release may be derived from the history alone
+	historyOnly := valid
+	historyOnly.Version = ""
+	historyOnly.SHA256 = ""
+	historyOnly.PatchList = nil
+	historyOnly.Releases = []*Release{{Version: "1.0.0", SHA256: "abc", State: ReleaseStatePulled}}
+	assert.ErrorContains(t, ValidateExtensions(Extensions{historyOnly}), "empty Version")
+	historyOnly.Version = "1.0.0"
+	historyOnly.SHA256 = "abc"
+	assert.ErrorContains(t, ValidateExtensions(Extensions{historyOnly}), "no release which was not pulled")
+	historyOnly.Version = ""
+	historyOnly.SHA256 = ""
+	historyOnly.Releases = append(historyOnly.Releases, &Release{Version: "0.9.0", SHA256: "xyz"})
+	assert.Nil(t, ValidateExtensions(Extensions{historyOnly}))
+
+	channels := valid
+	channels.Channels = map[string]*Release{ChannelStable: {Version: "1.1.0", SHA256: "xyz"}}
+	assert.ErrorContains(t, ValidateExtensions(Extensions{channels}), "unsupported channel")
+	channels.Channels = map[string]*Release{ChannelBeta: {Version: "1.1.0"}}
+	assert.ErrorContains(t, ValidateExtensions(Extensions{channels}), "incomplete release for channel beta")
+	channels.Channels[ChannelBeta].SHA256 = "xyz"
+	assert.Nil(t, ValidateExtensions(Extensions{channels}))
+
+	platforms := valid
+	platforms.OS = []string{"Mac OS X"}
+	assert.ErrorContains(t, ValidateExtensions(Extensions{platforms}), `unsupported OS "Mac OS X"`)
+	platforms.OS = []string{"mac"}
+	platforms.Arch = []string{"x86_64"}
+	assert.ErrorContains(t, ValidateExtensions(Extensions{platforms}), `unsupported Arch "x86_64"`)
+	platforms.Arch = []string{"x64"}
+	platforms.PlatformReleases = []*Release{{Version: "1.0.1", SHA256: "xyz"}}
+	assert.ErrorContains(t, ValidateExtensions(Extensions{platforms}), "without OS or Arch")
+	platforms.PlatformReleases[0].Arch = []string{"arm64"}
+	assert.Nil(t, ValidateExtensions(Extensions{platforms}))
+
+	browserVersions := valid
+	browserVersions.MinBrowserVersion = "137.0.0.0"
+	browserVersions.MaxBrowserVersion = "136.1.0.0"
+	assert.ErrorContains(t, ValidateExtensions(Extensions{browserVersions}), "MinBrowserVersion greater than MaxBrowserVersion")
+	browserVersions.MaxBrowserVersion = "137.1.0.0"
+	assert.Nil(t, ValidateExtensions(Extensions{browserVersions}))
+
+	downloadHosts := valid
+	downloadHosts.DownloadHosts = []string{"cdn.example.com", "https://mirror.example.com"}
+	assert.ErrorContains(t, ValidateExtensions(Extensions{downloadHosts}), `invalid download host "https://mirror.example.com"`)
+	downloadHosts.DownloadHosts[1] = "mirror.example.com"
+	assert.Nil(t, ValidateExtensions(Extensions{downloadHosts}))
+
+	urls := valid
+	urls.URL = "/light-theme.crx"
+	assert.ErrorContains(t, ValidateExtensions(Extensions{urls}), `invalid download URL "/light-theme.crx"`)
+	urls.URL = "https://downloads.example.com/light-theme.crx"
+	assert.Nil(t, ValidateExtensions(Extensions{urls}))
+	urls.URLTemplate = "{host}/release/{id}/{name}"
+	assert.ErrorContains(t, ValidateExtensions(Extensions{urls}), "invalid URLTemplate")
+	urls.URLTemplate = "https://{host}/components/{id}/{name}"
+	assert.Nil(t, ValidateExtensions(Extensions{urls}))
+	urls.Releases = []*Release{{Version: "0.9.0", SHA256: "xyz", URL: "ftp://downloads.example.com/light-theme.crx"}}
+	assert.ErrorContains(t, ValidateExtensions(Extensions{urls}), "release 0.9.0 has invalid download URL")
+
+	cohorts := valid
+	cohorts.Cohorts = []*Cohort{{ID: "experiment", Hint: "opt-in", Percentage: 60}, {ID: "control", Percentage: 60}}
+	assert.ErrorContains(t, ValidateExtensions(Extensions{cohorts}), "adding up to 120")
+	cohorts.Cohorts[1].Percentage = 40
+	assert.Nil(t, ValidateExtensions(Extensions{cohorts}))
+	cohorts.Cohorts[1].ID = "experiment"
+	assert.ErrorContains(t, ValidateExtensions(Extensions{cohorts}), `duplicate or reserved cohort ID "experiment"`)
+	cohorts.Cohorts[1].ID = DefaultCohortPrefix + "control"
+	assert.ErrorContains(t, ValidateExtensions(Extensions{cohorts}), "reserved cohort ID")
+	cohorts.Cohorts[1] = &Cohort{ID: "control", Hint: "opt-in"}
+	assert.ErrorContains(t, ValidateExtensions(Extensions{cohorts}), `duplicate cohort Hint "opt-in"`)
+	cohorts.Cohorts[1] = &Cohort{ID: "control", Release: &Release{Version: "1.1.0"}}
+	assert.ErrorContains(t, ValidateExtensions(Extensions{cohorts}), "cohort control with incomplete Release")
+}
+
+func TestValidateExtension(t *testing.T) {
+	valid := Extension{
+		ID:      "ldimlcelhnjgpjjemdjokpgeeikdinbm",
+		Version: "1.0.0",
+		SHA256:  "abc",
+	}
+	assert.Nil(t, ValidateExtension(valid))
+
+	// Catalogs such as DynamoDB may store null entries, which must not pass
+	nilEntries := valid
+	nilEntries.Cohorts = []*Cohort{nil}
+	assert.ErrorContains(t, ValidateExtension(nilEntries), "cohort with empty ID")
+	nilEntries.Cohorts = nil
+	nilEntries.PlatformReleases = []*Release{nil}
+	assert.ErrorContains(t, ValidateExtension(nilEntries), "incomplete platform release")
+	nilEntries.PlatformReleases = nil
+	nilEntries.Channels = map[string]*Release{ChannelBeta: nil}
+	assert.ErrorContains(t, ValidateExtension(nilEntries), "incomplete release for channel beta")
+	nilEntries.Channels = nil
+	nilEntries.PatchList = map[string]*PatchInfo{"fp1": nil}
+	assert.ErrorContains(t, ValidateExtension(nilEntries), "patch from fp1 has empty Hashdiff")
+	nilEntries.PatchList = nil
+	nilEntries.Releases = []*Release{nil}
+	assert.Nil(t, ValidateExtension(nilEntries))
+}
+
+func TestFileCatalogValidation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "extensions.json")
+	assert.Nil(t, os.WriteFile(path, []byte(`[{"ID": "ldimlcelhnjgpjjemdjokpgeeikdinbm", "Version": "1.0.0"}]`), 0o600))
+
+	_, err := NewFileCatalog(path).Fetch(context.Background())
+	assert.ErrorContains(t, err, "invalid catalog file")
+}
+
+func TestFileCatalogWatch(t *testing.T) {
+	originalPollInterval := FileCatalogPollInterval
+	FileCatalogPollInterval = time.Millisecond * 5
+	defer func() { FileCatalogPollInterval = originalPollInterval }()
+
+	path := filepath.Join(t.TempDir(), "extensions.json")
+	assert.Nil(t, os.WriteFile(path, []byte(`[]`), 0o600))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	changes := make(chan struct{}, 10)
+	done := make(chan struct{})
+	go func() {
+		NewFileCatalog(path).Watch(ctx, func() { changes <- struct{}{} })
+		close(done)
+	}()
+
+	// An unchanged file does not trigger a reload
+	select {
+	case <-changes:
+		t.Fatal("unexpected change notification")
+	case <-time.After(time.Millisecond * 50):
+	}
+
+	assert.Nil(t, os.WriteFile(path, []byte(`[{"ID": "ldimlcelhnjgpjjemdjokpgeeikdinbm", "Version": "1.0.0", "SHA256": "abc"}]`), 0o600))
+	select {
+	case <-changes:
+	case <-time.After(time.Second * 5):
+		t.Fatal("expected a change notification")
+	}
+
+	// A missing file keeps the last good contents without notifications
+	assert.Nil(t, os.Remove(path))
+	select {
+	case <-changes:
+		t.Fatal("unexpected change notification")
+	case <-time.After(time.Millisecond * 50):
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second * 5):
+		t.Fatal("Watch did not return after the context was canceled")
+	}
+}
@@ -0,0 +1,116 @@
+package extension
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+)
+
+// Cohort places clients of an extension in an experiment or rollout group. Clients
+// persist the cohort assigned to them and send it back in later update checks.
+type Cohort struct {
+	// ID is the identifier clients persist. Changing it reassigns the clients of the cohort.
+	ID   string `json:"ID" dynamodbav:"ID"`
+	Name string `json:"Name,omitempty" dynamodbav:"Name,omitempty"`
+
+	// Hint lets clients opt into the cohort by sending it as their cohort hint
+	Hint string `json:"Hint,omitempty" dynamodbav:"Hint,omitempty"`
+
+	// Percentage is the share of new clients assigned to the cohort
+	Percentage int `json:"Percentage,omitzero" dynamodbav:"Percentage,omitempty"`
+
+	// Release is offered to the clients of the cohort when it is newer than the
+	// release they would get otherwise
+	Release *Release `json:"Release,omitempty" dynamodbav:"Release,omitempty"`
+}
+
+// DefaultCohortPrefix starts the ID of the cohort of clients which are assigned to
+// none of the cohorts of an extension
+const DefaultCohortPrefix = "default:"
+
+// DefaultCohort returns the cohort of clients which are assigned to none of the
+// cohorts of the extension. Its ID changes along with the cohorts, so that these
+// clients are assigned again whenever cohorts are added or resized.
+func (e Extension) DefaultCohort() *Cohort {
+	hash := sha256.New()
+	for _, cohort := range e.Cohorts {
+		fmt.Fprintf(hash, "%s:%d;", cohort.ID, cohort.Percentage)
+	}
+	return &Cohort{ID: DefaultCohortPrefix + hex.EncodeToString(hash.Sum(nil))[:8]}
+}
+
+// AssignCohort returns the cohort of the client identified by clientID which sent
+// requested, or nil if the extension has no cohorts. Clients get the cohort matching
+// their cohort hint, or else keep the cohort they sent back. Other clients are
+// assigned to cohorts by the percentages of the cohorts, deterministically when they
+// identify themselves and randomly otherwise, and to the default cohort if none applies.
+func (e Extension) AssignCohort(clientID string, requested Extension) *Cohort {
+	if len(e.Cohorts) == 0 {
+		return nil
+	}
+	if requested.CohortHint != "" {
+		for _, cohort := range e.Cohorts {
+			if cohort.Hint == requested.CohortHint {
+				return cohort
+			}
+		}
+	}
+	defaultCohort := e.DefaultCohort()
+	if requested.Cohort == defaultCohort.ID {
+		return defaultCohort
+	}
+	for _, cohort := range e.Cohorts {
+		if cohort.ID == requested.Cohort {
+			return cohort
+		}
+	}
+
+	bucket := rand.IntN(100) // nosemgrep: go.lang.security.audit.crypto.math_random.math-random-used
+	if clientID != "" {
+		bucket = RolloutBucket(clientID, e.ID+":cohort")
+	}
+	total := 0
+	for _, cohort := range e.Cohorts {
+		total += cohort.Percentage
+		if bucket < total {
+			return cohort
+		}
+	}
+	return defaultCohort
+}
+
+// validateCohorts checks that cohorts have distinct IDs and hints, complete releases,
+// and percentages adding up to at most 100
+func validateCohorts(cohorts []*Cohort) error {
+	ids := map[string]bool{}
+	hints := map[string]bool{}
+	total := 0
+	for _, cohort := range cohorts {
+		if cohort == nil || cohort.ID == "" {
+			return fmt.Errorf("has cohort with empty ID")
+		}
+		if ids[cohort.ID] || strings.HasPrefix(cohort.ID, DefaultCohortPrefix) {
+			return fmt.Errorf("has duplicate or reserved cohort ID %q", cohort.ID)
+		}
+		ids[cohort.ID] = true
+		if cohort.Hint != "" {
+			if hints[cohort.Hint] {
+				return fmt.Errorf("has duplicate cohort Hint %q", cohort.Hint)
+			}
+			hints[cohort.Hint] = true
+		}
+		if cohort.Percentage < 0 || cohort.Percentage > 100 {
+			return fmt.Errorf("has cohort %s with Percentage %d outside of [0, 100]", cohort.ID, cohort.Percentage)
+		}
+		total += cohort.Percentage
+		if release := cohort.Release; release != nil && (release.Version == "" || release.SHA256 == "") {
+			return fmt.Errorf("has cohort %s with incomplete Release", cohort.ID)
+		}
+	}
+	if total > 100 {
+		return fmt.Errorf("has cohorts with Percentage adding up to %d, more than 100", total)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package extension
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAssignCohort(t *testing.T) {
+	extension := Extension{ID: "ldimlcelhnjgpjjemdjokpgeeikdinbm"}
+	assert.Nil(t, extension.AssignCohort("{client}", Extension{}))
+
+	experiment := &Cohort{ID: "experiment", Name: "Experiment", Hint: "opt-in", Percentage: 50}
+	control := &Cohort{ID: "control", Percentage: 50}
+	extension.Cohorts = []*Cohort{experiment, control}
+
+	// Clients are assigned by their bucket
+	assigned := map[string]int{}
+	for i := range 100 {
+		clientID := fmt.Sprintf("{client-%d}", i)
+		cohort := extension.AssignCohort(clientID, Extension{})
+		if RolloutBucket(clientID, extension.ID+":cohort") < 50 {
+			assert.Equal(t, experiment, cohort)
+		} else {
+			assert.Equal(t, control, cohort)
+		}
+		assigned[cohort.ID]++
+		// Assignments are stable
+		assert.Equal(t, cohort, extension.AssignCohort(clientID, Extension{}))
+	}
+	assert.Equal(t, 2, len(assigned))
+
+	// Clients keep their cohort and may opt into a cohort by its hint
+	assert.Equal(t, control, extension.AssignCohort("", Extension{Cohort: "control"}))
+	assert.Equal(t, experiment, extension.AssignCohort("", Extension{Cohort: "control", CohortHint: "opt-in"}))
+
+	// Clients left out of the cohorts get the default cohort, until the cohorts change
+	control.Percentage = 0
+	defaultCohort := extension.DefaultCohort()
+	assert.Regexp(t, "^default:[0-9a-f]{8}$", defaultCohort.ID)
+	for i := range 100 {
+		clientID := fmt.Sprintf("{client-%d}", i)
+		if RolloutBucket(clientID, extension.ID+":cohort") >= 50 {
+			assert.Equal(t, defaultCohort, extension.AssignCohort(clientID, Extension{Cohort: "unknown"}))
+		}
+	}
+	assert.Equal(t, defaultCohort, extension.AssignCohort("", Extension{Cohort: defaultCohort.ID}))
+	control.Percentage = 50
+	assert.NotEqual(t, defaultCohort.ID, extension.DefaultCohort().ID)
+	assert.NotEqual(t, defaultCohort.ID, extension.AssignCohort("", Extension{Cohort: defaultCohort.ID}).ID)
+}
+
+func TestProcessExtensionRequestsCohorts(t *testing.T) {
+	lightThemeExtension := OfferedExtensions[0]
+	lightThemeExtension.Version = "1.0.0"
+	lightThemeExtension.Cohorts = []*Cohort{
+		{ID: "experiment", Name: "Experiment", Hint: "opt-in", Release: &Release{Version: "1.1.0", SHA256: "experiment-sha256"}},
+		{ID: "control", Percentage: 100},
+	}
+	extensionsMap := NewExtensionMap()
+	extensionsMap.StoreExtensions(&Extensions{lightThemeExtension})
+
+	check := func(requested Extension) Extension {
+		requested.ID = lightThemeExtension.ID
+		processed := ProcessExtensionRequests(&UpdateRequest{Extensions: Extensions{requested}}, extensionsMap)
+		assert.Equal(t, 1, len(processed))
+		return processed[0]
+	}
+
+	control := check(Extension{Version: "0.1.0"})
+	assert.Equal(t, "1.0.0", control.Version)
+	assert.Equal(t, "control", control.Cohort)
+	assert.Equal(t, "", control.CohortName)
+
+	experiment := check(Extension{Version: "0.1.0", Cohort: "control", CohortHint: "opt-in"})
+	assert.Equal(t, "1.1.0", experiment.Version)
+	assert.Equal(t, "experiment-sha256", experiment.SHA256)
+	assert.Equal(t, "experiment", experiment.Cohort)
+	assert.Equal(t, "opt-in", experiment.CohortHint)
+	assert.Equal(t, "Experiment", experiment.CohortName)
+
+	// The cohort is also returned without update
+	noUpdate := check(Extension{Version: "1.1.0", Cohort: "experiment"})
+	assert.Equal(t, "noupdate", noUpdate.Status)
+	assert.Equal(t, "experiment", noUpdate.Cohort)
+
+	// The cohort release is only offered when newer
+	lightThemeExtension.Version = "1.2.0"
+	extensionsMap.Store(lightThemeExtension.ID, lightThemeExtension)
+	assert.Equal(t, "1.2.0", check(Extension{Version: "0.1.0", Cohort: "experiment"}).Version)
+}
@@ -0,0 +1,132 @@
+package extension
+
+import (
+	"context"
+	"encoding/json/v2"
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// Reasons for denylisting an extension
+const (
+	DenyReasonMalware = "malware"
+	DenyReasonLegal   = "legal"
+	DenyReasonPolicy  = "policy"
+	DenyReasonOther   = "other"
+)
+
+// DenylistEntry denies updates of an extension we don't host, which would
+// otherwise be passed on to its upstream updater
+type DenylistEntry struct {
+	ID     string `json:"ID"`
+	Reason string `json:"Reason"`
+
+	// Source records where the decision comes from, e.g. the malware report
+	// or the takedown notice
+	Source string `json:"Source,omitempty"`
+
+	// Status is the status clients get, either restricted (default) or an error status
+	Status string `json:"Status,omitempty"`
+}
+
+// UpdateStatus returns the status of update responses for the extension
+func (e DenylistEntry) UpdateStatus() string {
+	if e.Status == "" {
+		return "restricted"
+	}
+	return e.Status
+}
+
+// Denylist is a set of denylisted extensions. It is immutable once created.
+type Denylist struct {
+	entries map[string]DenylistEntry
+}
+
+// NewDenylist validates entries and creates a Denylist holding them
+func NewDenylist(entries []DenylistEntry) (*Denylist, error) {
+	denylist := &Denylist{entries: make(map[string]DenylistEntry, len(entries))}
+	for i, entry := range entries {
+		if entry.ID == "" {
+			return nil, fmt.Errorf("denylist entry at index %d has empty ID", i)
+		}
+		if _, ok := denylist.entries[entry.ID]; ok {
+			return nil, fmt.Errorf("extension %s is denylisted more than once", entry.ID)
+		}
+		switch entry.Reason {
+		case DenyReasonMalware, DenyReasonLegal, DenyReasonPolicy, DenyReasonOther:
+		default:
+			return nil, fmt.Errorf("extension %s is denylisted with unsupported Reason %q", entry.ID, entry.Reason)
+		}
+		if entry.Status != "" && entry.Status != "restricted" && !strings.HasPrefix(entry.Status, "error-") {
+			return nil, fmt.Errorf("extension %s is denylisted with unsupported Status %q", entry.ID, entry.Status)
+		}
+		denylist.entries[entry.ID] = entry
+	}
+	return denylist, nil
+}
+
+// Lookup returns the denylist entry of an extension, if it is denylisted
+func (d *Denylist) Lookup(id string) (DenylistEntry, bool) {
+	entry, ok := d.entries[id]
+	return entry, ok
+}
+
+// Len returns the number of denylisted extensions
+func (d *Denylist) Len() int {
+	return len(d.entries)
+}
+
+var configuredDenylist atomic.Pointer[Denylist]
+
+// CurrentDenylist returns the configured denylist, which is empty unless one is configured
+func CurrentDenylist() *Denylist {
+	if denylist := configuredDenylist.Load(); denylist != nil {
+		return denylist
+	}
+	return &Denylist{}
+}
+
+// SetDenylist replaces the denylist. A nil denylist clears it.
+func SetDenylist(denylist *Denylist) {
+	configuredDenylist.Store(denylist)
+}
+
+// DenylistFile is a JSON or YAML file holding the list of entries of a denylist,
+// using the field names of DenylistEntry
+type DenylistFile struct {
+	path string
+}
+
+// NewDenylistFile creates a DenylistFile reading from path
+func NewDenylistFile(path string) *DenylistFile {
+	return &DenylistFile{path: path}
+}
+
+// Name returns the description of the file
+func (f *DenylistFile) Name() string {
+	return "file:" + f.path
+}
+
+// Load reads, parses and validates the denylist file
+func (f *DenylistFile) Load() (*Denylist, error) {
+	data, err := readJSONOrYAMLFile(f.path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading denylist file: %w", err)
+	}
+
+	var entries []DenylistEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("error parsing denylist file: %w", err)
+	}
+	denylist, err := NewDenylist(entries)
+	if err != nil {
+		return nil, fmt.Errorf("invalid denylist file: %w", err)
+	}
+	return denylist, nil
+}
+
+// Watch polls the denylist file like FileCatalog.Watch
+func (f *DenylistFile) Watch(ctx context.Context, onChange func()) {
+	watchFile(ctx, f.path, onChange)
+}
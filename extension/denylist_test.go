@@ -0,0 +1,62 @@
+package extension
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewDenylist(t *testing.T) {
+	denylist, err := NewDenylist([]DenylistEntry{
+		{ID: "aaaa", Reason: DenyReasonMalware, Source: "malware report"},
+		{ID: "bbbb", Reason: DenyReasonLegal, Status: "error-unknownApplication"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, denylist.Len())
+
+	entry, ok := denylist.Lookup("aaaa")
+	assert.True(t, ok)
+	assert.Equal(t, "malware report", entry.Source)
+	assert.Equal(t, "restricted", entry.UpdateStatus())
+	entry, ok = denylist.Lookup("bbbb")
+	assert.True(t, ok)
+	assert.Equal(t, "error-unknownApplication", entry.UpdateStatus())
+	_, ok = denylist.Lookup("cccc")
+	assert.False(t, ok)
+
+	_, err = NewDenylist([]DenylistEntry{{Reason: DenyReasonMalware}})
+	assert.ErrorContains(t, err, "empty ID")
+	_, err = NewDenylist([]DenylistEntry{{ID: "aaaa", Reason: DenyReasonMalware}, {ID: "aaaa", Reason: DenyReasonLegal}})
+	assert.ErrorContains(t, err, "denylisted more than once")
+	_, err = NewDenylist([]DenylistEntry{{ID: "aaaa", Reason: "dislike"}})
+	assert.ErrorContains(t, err, `unsupported Reason "dislike"`)
+	_, err = NewDenylist([]DenylistEntry{{ID: "aaaa", Reason: DenyReasonPolicy, Status: "ok"}})
+	assert.ErrorContains(t, err, `unsupported Status "ok"`)
+
+	// Nothing is denylisted unless a denylist is configured
+	assert.Equal(t, 0, CurrentDenylist().Len())
+	SetDenylist(denylist)
+	defer SetDenylist(nil)
+	_, ok = CurrentDenylist().Lookup("aaaa")
+	assert.True(t, ok)
+}
+
+func TestDenylistFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "denylist.yaml")
+	assert.Nil(t, os.WriteFile(path, []byte(`
+- ID: aaaa
+  Reason: malware
+  Source: https://example.com/reports/1234
+`), 0o600))
+	denylist, err := NewDenylistFile(path).Load()
+	assert.Nil(t, err)
+	entry, ok := denylist.Lookup("aaaa")
+	assert.True(t, ok)
+	assert.Equal(t, DenylistEntry{ID: "aaaa", Reason: DenyReasonMalware, Source: "https://example.com/reports/1234"}, entry)
+
+	assert.Nil(t, os.WriteFile(path, []byte(`- ID: aaaa`), 0o600))
+	_, err = NewDenylistFile(path).Load()
+	assert.ErrorContains(t, err, "invalid denylist file")
+}
@@ -0,0 +1,71 @@
+package extension
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// DynamoDBCatalog is a Catalog backed by a DynamoDB table. The AWS config is
+// obtained from the host machine, and DYNAMODB_ENDPOINT optionally overrides
+// the service endpoint.
+type DynamoDBCatalog struct {
+	tableName string
+}
+
+// NewDynamoDBCatalog creates a DynamoDBCatalog scanning the named table
+func NewDynamoDBCatalog(tableName string) *DynamoDBCatalog {
+	return &DynamoDBCatalog{tableName: tableName}
+}
+
+// Name returns the description of the catalog
+func (c *DynamoDBCatalog) Name() string {
+	return "dynamodb:" + c.tableName
+}
+
+// Fetch scans the whole table. An item which fails to unmarshal fails the
+// fetch, since skipping it would drop a served extension from the catalog.
+func (c *DynamoDBCatalog) Fetch(ctx context.Context) (Extensions, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	// Create DynamoDB client with optional custom endpoint
+	clientOpts := func(o *dynamodb.Options) {
+		if endpoint := os.Getenv("DYNAMODB_ENDPOINT"); endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+		}
+	}
+	svc := dynamodb.NewFromConfig(cfg, clientOpts)
+
+	// For most use cases, you probably wouldn't want to scan all entries; however,
+	// for our use case we have a read only small number of items, that are infrequently
+	// updated, usually less than daily by an external tool, and very often queried.
+	paginator := dynamodb.NewScanPaginator(svc, &dynamodb.ScanInput{
+		TableName: aws.String(c.tableName),
+	})
+
+	extensions := Extensions{}
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan DynamoDB table %s: %w", c.tableName, err)
+		}
+
+		for _, item := range page.Items {
+			var ext Extension
+			if err := attributevalue.UnmarshalMap(item, &ext); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal DynamoDB item: %w", err)
+			}
+			extensions = append(extensions, ext)
+		}
+	}
+
+	return extensions, nil
+}
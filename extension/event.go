@@ -0,0 +1,337 @@
+package extension
+
+import (
+	"context"
+	"encoding/json/v2"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/brave/go-update/logger"
+)
+
+// Event types sent by clients, see
+// https://github.com/google/omaha/blob/main/doc/ServerProtocolV3.md#event-request
+const (
+	EventTypeInstall   = 2
+	EventTypeUpdate    = 3
+	EventTypeUninstall = 4
+	EventTypeDownload  = 14
+	EventTypeAction    = 42
+)
+
+// Event results sent by clients
+const (
+	EventResultError     = 0
+	EventResultSuccess   = 1
+	EventResultCancelled = 4
+)
+
+// Event is a pingback sent by a client about an extension, such as the outcome
+// of an install or update
+type Event struct {
+	AppID           string `json:"AppID"`
+	AppVersion      string `json:"AppVersion,omitempty"`
+	EventType       int    `json:"EventType"`
+	EventResult     int    `json:"EventResult"`
+	ErrorCode       int    `json:"ErrorCode,omitzero"`
+	ExtraCode1      int    `json:"ExtraCode1,omitzero"`
+	PreviousVersion string `json:"PreviousVersion,omitempty"`
+	NextVersion     string `json:"NextVersion,omitempty"`
+
+	// Details of download events
+	DownloadTimeMs int64 `json:"DownloadTimeMs,omitzero"`
+	Downloaded     int64 `json:"Downloaded,omitzero"`
+	Total          int64 `json:"Total,omitzero"`
+
+	// Details of the client sending the event, which are set from the request,
+	// see UpdateRequest.ClientEvents
+	UpdaterType    string `json:"UpdaterType,omitempty"`
+	OS             string `json:"OS,omitempty"`
+	Arch           string `json:"Arch,omitempty"`
+	Channel        string `json:"Channel,omitempty"`
+	BrowserVersion string `json:"BrowserVersion,omitempty"`
+}
+
+// Succeeded reports whether the event is a success
+func (e Event) Succeeded() bool {
+	return e.EventResult == EventResultSuccess
+}
+
+// Validate checks that the event identifies its extension and type and has no
+// negative values
+func (e Event) Validate() error {
+	if e.AppID == "" {
+		return fmt.Errorf("event has empty appid")
+	}
+	if e.EventType <= 0 {
+		return fmt.Errorf("event of %s has invalid eventtype %d", e.AppID, e.EventType)
+	}
+	if e.EventResult < 0 {
+		return fmt.Errorf("event of %s has invalid eventresult %d", e.AppID, e.EventResult)
+	}
+	if e.DownloadTimeMs < 0 || e.Downloaded < 0 || e.Total < 0 {
+		return fmt.Errorf("event of %s has negative download details", e.AppID)
+	}
+	return nil
+}
+
+// ClientEvents returns the valid events of the request along with the details of
+// the client which sent them, and the number of invalid events left out
+func (r *UpdateRequest) ClientEvents() ([]Event, int) {
+	events := make([]Event, 0, len(r.Events))
+	invalid := 0
+	for _, event := range r.Events {
+		if event.Validate() != nil {
+			invalid++
+			continue
+		}
+		event.UpdaterType = r.UpdaterType
+		event.OS = r.OS
+		event.Arch = r.Arch
+		event.Channel = r.Channel
+		event.BrowserVersion = r.BrowserVersion
+		events = append(events, event)
+	}
+	return events, invalid
+}
+
+// EventSink receives the events sent by clients
+type EventSink interface {
+	// Name returns a description of the sink for logging
+	Name() string
+
+	// Record stores or forwards valid events
+	Record(ctx context.Context, events []Event) error
+}
+
+// LogEventSink logs every event
+type LogEventSink struct{}
+
+// Name returns the description of the sink
+func (LogEventSink) Name() string {
+	return "log"
+}
+
+// Record logs the events with the logger of ctx
+func (LogEventSink) Record(ctx context.Context, events []Event) error {
+	log := logger.FromContext(ctx)
+	for _, event := range events {
+		log.Info("Received event",
+			"appid", event.AppID,
+			"version", event.AppVersion,
+			"eventtype", event.EventType,
+			"eventresult", event.EventResult,
+			"errorcode", event.ErrorCode,
+			"extracode1", event.ExtraCode1,
+			"previousversion", event.PreviousVersion,
+			"nextversion", event.NextVersion,
+			"updater", event.UpdaterType,
+			"os", event.OS,
+			"arch", event.Arch)
+	}
+	return nil
+}
+
+// FileEventSink appends events to a file as JSON lines
+type FileEventSink struct {
+	path  string
+	mutex sync.Mutex
+	file  *os.File
+}
+
+// NewFileEventSink creates a FileEventSink appending to path, which is created if needed
+func NewFileEventSink(path string) (*FileEventSink, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening events file: %w", err)
+	}
+	return &FileEventSink{path: path, file: file}, nil
+}
+
+// Name returns the description of the sink
+func (s *FileEventSink) Name() string {
+	return "file:" + s.path
+}
+
+// Record appends one line per event to the file
+func (s *FileEventSink) Record(_ context.Context, events []Event) error {
+	var lines []byte
+	for _, event := range events {
+		line, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("error encoding event: %w", err)
+		}
+		lines = append(append(lines, line...), '\n')
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, err := s.file.Write(lines); err != nil {
+		return fmt.Errorf("error writing events file: %w", err)
+	}
+	return nil
+}
+
+// Close closes the file
+func (s *FileEventSink) Close() error {
+	return s.file.Close()
+}
+
+// EventCountKey groups the events counted by an EventAggregator
+type EventCountKey struct {
+	AppID       string `json:"AppID"`
+	AppVersion  string `json:"AppVersion"`
+	EventType   int    `json:"EventType"`
+	EventResult int    `json:"EventResult"`
+	ErrorCode   int    `json:"ErrorCode"`
+}
+
+// EventCount is the number of events of a group
+type EventCount struct {
+	EventCountKey
+	Count int64 `json:"Count"`
+}
+
+// EventWindow holds the event counts over a rolling window
+type EventWindow struct {
+	Window string       `json:"Window"`
+	Counts []EventCount `json:"Counts"`
+	// Dropped counts the events left out because buckets were full
+	Dropped int64 `json:"Dropped"`
+}
+
+type eventBucket struct {
+	start   time.Time
+	counts  map[EventCountKey]int64
+	dropped int64
+}
+
+// EventAggregator counts events in memory, per extension, version, type, result
+// and error code, in time buckets reused once they are older than the longest
+// window. Each bucket holds at most maxKeys groups and leaves out events of new
+// groups once full, which bounds the memory used.
+type EventAggregator struct {
+	mutex      sync.Mutex
+	bucketSize time.Duration
+	maxKeys    int
+	buckets    []eventBucket
+	now        func() time.Time
+}
+
+// DefaultEventAggregatorMaxKeys is the number of groups per bucket of event
+// aggregators created by NewEventSinkFromEnv
+const DefaultEventAggregatorMaxKeys = 1000
+
+// NewEventAggregator creates an EventAggregator keeping bucketCount buckets of
+// bucketSize, each holding at most maxKeys groups
+func NewEventAggregator(bucketSize time.Duration, bucketCount int, maxKeys int) *EventAggregator {
+	return &EventAggregator{
+		bucketSize: bucketSize,
+		maxKeys:    maxKeys,
+		buckets:    make([]eventBucket, bucketCount),
+		now:        time.Now,
+	}
+}
+
+// Name returns the description of the sink
+func (a *EventAggregator) Name() string {
+	return "memory"
+}
+
+// Record counts the events in the current bucket
+func (a *EventAggregator) Record(_ context.Context, events []Event) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	start := a.now().Truncate(a.bucketSize)
+	bucket := &a.buckets[int(start.UnixNano()/int64(a.bucketSize))%len(a.buckets)]
+	if !bucket.start.Equal(start) {
+		*bucket = eventBucket{start: start, counts: map[EventCountKey]int64{}}
+	}
+	for _, event := range events {
+		key := EventCountKey{
+			AppID:       event.AppID,
+			AppVersion:  event.AppVersion,
+			EventType:   event.EventType,
+			EventResult: event.EventResult,
+			ErrorCode:   event.ErrorCode,
+		}
+		if _, ok := bucket.counts[key]; !ok && len(bucket.counts) >= a.maxKeys {
+			bucket.dropped++
+			continue
+		}
+		bucket.counts[key]++
+	}
+	return nil
+}
+
+// Window returns the event counts of the last window sorted by group, rounded up
+// to whole buckets and limited to the buckets kept
+func (a *EventAggregator) Window(window time.Duration) EventWindow {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	since := a.now().Add(-window)
+	totals := map[EventCountKey]int64{}
+	result := EventWindow{
+		Window: formatWindow(window),
+		Counts: []EventCount{},
+	}
+	for _, bucket := range a.buckets {
+		if bucket.counts == nil || !bucket.start.Add(a.bucketSize).After(since) {
+			continue
+		}
+		result.Dropped += bucket.dropped
+		for key, count := range bucket.counts {
+			totals[key] += count
+		}
+	}
+
+	for key, count := range totals {
+		result.Counts = append(result.Counts, EventCount{EventCountKey: key, Count: count})
+	}
+	sort.Slice(result.Counts, func(i, j int) bool {
+		a, b := result.Counts[i].EventCountKey, result.Counts[j].EventCountKey
+		if a.AppID != b.AppID {
+			return a.AppID < b.AppID
+		}
+		if a.AppVersion != b.AppVersion {
+			return a.AppVersion < b.AppVersion
+		}
+		if a.EventType != b.EventType {
+			return a.EventType < b.EventType
+		}
+		if a.EventResult != b.EventResult {
+			return a.EventResult < b.EventResult
+		}
+		return a.ErrorCode < b.ErrorCode
+	})
+	return result
+}
+
+// NewEventSinkFromEnv creates the event sink configured by the EVENTS_SINK
+// environment variable:
+//   - "" or "none" drops events, returning a nil sink
+//   - "log" logs every event
+//   - "file" appends events to the file at EVENTS_FILE as JSON lines
+//   - "memory" counts events in memory, see EventAggregator
+func NewEventSinkFromEnv() (EventSink, error) {
+	switch sink := os.Getenv("EVENTS_SINK"); sink {
+	case "", "none":
+		return nil, nil
+	case "log":
+		return LogEventSink{}, nil
+	case "file":
+		path := os.Getenv("EVENTS_FILE")
+		if path == "" {
+			return nil, fmt.Errorf("EVENTS_FILE must be set when EVENTS_SINK is file")
+		}
+		return NewFileEventSink(path)
+	case "memory":
+		return NewEventAggregator(DefaultStatsBucketSize, DefaultStatsBucketCount, DefaultEventAggregatorMaxKeys), nil
+	default:
+		return nil, fmt.Errorf("unsupported EVENTS_SINK %q", sink)
+	}
+}
@@ -0,0 +1,108 @@
+package extension
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientEvents(t *testing.T) {
+	request := &UpdateRequest{
+		UpdaterType:    "BraveComponentUpdater",
+		OS:             "linux",
+		Arch:           "x64",
+		Channel:        "stable",
+		BrowserVersion: "140.1.82.1",
+		Events: []Event{
+			{AppID: "aaaa", AppVersion: "1.0.1", EventType: EventTypeUpdate, EventResult: EventResultSuccess},
+			{EventType: EventTypeUpdate},
+			{AppID: "aaaa", EventType: 0},
+			{AppID: "aaaa", EventType: EventTypeDownload, DownloadTimeMs: -1},
+		},
+	}
+	events, invalid := request.ClientEvents()
+	assert.Equal(t, 3, invalid)
+	assert.Equal(t, []Event{{
+		AppID: "aaaa", AppVersion: "1.0.1", EventType: EventTypeUpdate, EventResult: EventResultSuccess,
+		UpdaterType: "BraveComponentUpdater", OS: "linux", Arch: "x64", Channel: "stable", BrowserVersion: "140.1.82.1",
+	}}, events)
+	assert.True(t, events[0].Succeeded())
+}
+
+func TestEventAggregator(t *testing.T) {
+	aggregator := NewEventAggregator(time.Hour, 24, 2)
+	now := time.Date(2026, 5, 1, 10, 30, 0, 0, time.UTC)
+	aggregator.now = func() time.Time { return now }
+	assert.Nil(t, aggregator.Record(context.Background(), []Event{
+		{AppID: "bbbb", AppVersion: "1.0", EventType: EventTypeUpdate, EventResult: EventResultSuccess},
+		{AppID: "aaaa", AppVersion: "2.0", EventType: EventTypeUpdate, EventResult: EventResultError, ErrorCode: 12},
+		{AppID: "bbbb", AppVersion: "1.0", EventType: EventTypeUpdate, EventResult: EventResultSuccess},
+		// A third group doesn't fit
+		{AppID: "cccc", AppVersion: "1.0", EventType: EventTypeInstall, EventResult: EventResultSuccess},
+	}))
+
+	window := aggregator.Window(time.Hour)
+	assert.Equal(t, "1h", window.Window)
+	assert.Equal(t, int64(1), window.Dropped)
+	assert.Equal(t, []EventCount{
+		{EventCountKey: EventCountKey{AppID: "aaaa", AppVersion: "2.0", EventType: EventTypeUpdate, EventResult: EventResultError, ErrorCode: 12}, Count: 1},
+		{EventCountKey: EventCountKey{AppID: "bbbb", AppVersion: "1.0", EventType: EventTypeUpdate, EventResult: EventResultSuccess}, Count: 2},
+	}, window.Counts)
+
+	// New buckets have room for new groups, and older buckets leave the window
+	now = now.Add(time.Hour * 2)
+	assert.Nil(t, aggregator.Record(context.Background(), []Event{
+		{AppID: "cccc", AppVersion: "1.0", EventType: EventTypeInstall, EventResult: EventResultSuccess},
+	}))
+	window = aggregator.Window(time.Hour)
+	assert.Equal(t, int64(0), window.Dropped)
+	assert.Equal(t, []EventCount{
+		{EventCountKey: EventCountKey{AppID: "cccc", AppVersion: "1.0", EventType: EventTypeInstall, EventResult: EventResultSuccess}, Count: 1},
+	}, window.Counts)
+	assert.Equal(t, 3, len(aggregator.Window(time.Hour*24).Counts))
+
+	now = now.Add(time.Hour * 25)
+	assert.Equal(t, []EventCount{}, aggregator.Window(time.Hour*24).Counts)
+}
+
+func TestFileEventSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	sink, err := NewFileEventSink(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "file:"+path, sink.Name())
+	assert.Nil(t, sink.Record(context.Background(), []Event{
+		{AppID: "aaaa", EventType: EventTypeUpdate, EventResult: EventResultSuccess, NextVersion: "1.0.1"},
+		{AppID: "bbbb", EventType: EventTypeInstall, EventResult: EventResultError, ErrorCode: 3},
+	}))
+	assert.Nil(t, sink.Close())
+
+	data, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"AppID":"aaaa","EventType":3,"EventResult":1,"NextVersion":"1.0.1"}
+{"AppID":"bbbb","EventType":2,"EventResult":0,"ErrorCode":3}
+`, string(data))
+}
+
+func TestNewEventSinkFromEnv(t *testing.T) {
+	t.Setenv("EVENTS_SINK", "")
+	sink, err := NewEventSinkFromEnv()
+	assert.Nil(t, err)
+	assert.Nil(t, sink)
+
+	t.Setenv("EVENTS_SINK", "memory")
+	sink, err = NewEventSinkFromEnv()
+	assert.Nil(t, err)
+	assert.Equal(t, "memory", sink.Name())
+
+	t.Setenv("EVENTS_SINK", "file")
+	_, err = NewEventSinkFromEnv()
+	assert.ErrorContains(t, err, "EVENTS_FILE must be set")
+
+	t.Setenv("EVENTS_SINK", "kafka")
+	_, err = NewEventSinkFromEnv()
+	assert.ErrorContains(t, err, `unsupported EVENTS_SINK "kafka"`)
+}
@@ -2,6 +2,7 @@ package extension
 
 import (
 	"encoding/json/v2"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -11,6 +12,11 @@ type PatchInfo struct {
 	Hashdiff string `json:"hashdiff" dynamodbav:"Hashdiff"`
 	Namediff string `json:"namediff" dynamodbav:"Namediff"`
 	Sizediff int    `json:"sizediff" dynamodbav:"Sizediff"`
+
+	// Format is the format of the patch, PatchFormatPuff unless set, and
+	// Alternatives the patches from the same package in other formats
+	Format       string       `json:"format,omitempty" dynamodbav:"Format,omitempty"`
+	Alternatives []*PatchInfo `json:"alternatives,omitempty" dynamodbav:"Alternatives,omitempty"`
 }
 
 // Extension represents an extension which is both used in update checks
@@ -26,6 +32,79 @@ type Extension struct {
 	Blacklisted bool                  `json:"Blacklisted" dynamodbav:"Disabled"`
 	Status      string                `json:"Status" dynamodbav:"Status,omitempty"`
 	PatchList   map[string]*PatchInfo `json:"PatchList" dynamodbav:"PatchList,omitempty"`
+
+	// RolloutPercentage is the share of clients offered Version while a staged
+	// rollout is in progress. A rollout is in progress while PreviousRelease is set,
+	// and the remaining clients are offered PreviousRelease instead.
+	RolloutPercentage int      `json:"RolloutPercentage,omitzero" dynamodbav:"RolloutPercentage,omitempty"`
+	PreviousRelease   *Release `json:"PreviousRelease,omitempty" dynamodbav:"PreviousRelease,omitempty"`
+
+	// Channels holds the releases offered to clients on the beta, dev and nightly
+	// channels. Version is the stable release.
+	Channels map[string]*Release `json:"Channels,omitempty" dynamodbav:"Channels,omitempty"`
+
+	// OS and Arch limit the extension to clients on these operating systems
+	// ("mac", "win", "linux", ...) and architectures ("x86", "x64", "arm", "arm64").
+	// Empty lists allow every platform.
+	OS   []string `json:"OS,omitempty" dynamodbav:"OS,omitempty"`
+	Arch []string `json:"Arch,omitempty" dynamodbav:"Arch,omitempty"`
+
+	// PlatformReleases holds packages built for specific platforms, which are
+	// offered instead of the extension's own package to clients they support
+	PlatformReleases []*Release `json:"PlatformReleases,omitempty" dynamodbav:"PlatformReleases,omitempty"`
+
+	// MinBrowserVersion and MaxBrowserVersion limit the package to browsers which
+	// can load it. Empty values leave the range open.
+	MinBrowserVersion string `json:"MinBrowserVersion,omitempty" dynamodbav:"MinBrowserVersion,omitempty"`
+	MaxBrowserVersion string `json:"MaxBrowserVersion,omitempty" dynamodbav:"MaxBrowserVersion,omitempty"`
+
+	// DownloadHosts replaces the hosts serving the packages of the extension, in
+	// the order clients try them
+	DownloadHosts []string `json:"DownloadHosts,omitempty" dynamodbav:"DownloadHosts,omitempty"`
+
+	// URLTemplate and PackageName replace the default layout of packages on the
+	// download hosts, and URL replaces the URLs built from the download hosts. URL
+	// only applies to Version and is replaced along with the release. See
+	// GetPackageURLs and GetPackageName.
+	URLTemplate string `json:"URLTemplate,omitempty" dynamodbav:"URLTemplate,omitempty"`
+	PackageName string `json:"PackageName,omitempty" dynamodbav:"PackageName,omitempty"`
+
+	// SignedURLs makes the download URLs of the extension expire, for packages which
+	// aren't publicly downloadable, see URLSigner
+	SignedURLs bool `json:"SignedURLs,omitzero" dynamodbav:"SignedURLs,omitempty"`
+
+	// Releases holds the version history of the extension, which clients pinned to
+	// a version prefix or allowing rollbacks can be offered. Catalogs may store only
+	// the history, in which case the current release is derived from it, see WithHistory.
+	Releases []*Release `json:"Releases,omitempty" dynamodbav:"Releases,omitempty"`
+
+	// TargetVersionPrefix and RollbackAllowed are only set on extensions of update
+	// requests, for clients pinned to a version prefix (e.g. "1.2.") by policy and
+	// clients accepting downgrades
+	TargetVersionPrefix string `json:"-" dynamodbav:"-"`
+	RollbackAllowed     bool   `json:"-" dynamodbav:"-"`
+
+	// CachedFPs holds the fingerprints of every package the client has cached, FP
+	// being the one it runs. It is only set on extensions of update requests and
+	// responses, by protocols listing cached packages, see GetCachedPatches.
+	CachedFPs []string `json:"-" dynamodbav:"-"`
+
+	// Ping is only set on extensions of update requests, for counting active clients
+	Ping *Ping `json:"-" dynamodbav:"-"`
+
+	// Cohorts are the groups clients of the extension are assigned to, see AssignCohort
+	Cohorts []*Cohort `json:"Cohorts,omitempty" dynamodbav:"Cohorts,omitempty"`
+
+	// Cohort, CohortHint and CohortName are the cohort sent back by the client on
+	// extensions of update requests, and the cohort assigned to the client on
+	// extensions of update responses
+	Cohort     string `json:"-" dynamodbav:"-"`
+	CohortHint string `json:"-" dynamodbav:"-"`
+	CohortName string `json:"-" dynamodbav:"-"`
+
+	// AcceptFormats is only set on extensions of update responses, to the formats
+	// the client accepts, see UpdateRequest
+	AcceptFormats []string `json:"-" dynamodbav:"-"`
 }
 
 // Extensions is type for a slice of Extension.
@@ -35,6 +114,27 @@ type Extensions []Extension
 type UpdateRequest struct {
 	Extensions  Extensions
 	UpdaterType string // "chromiumcrx" for extensions, "BraveComponentUpdater" for components
+	SessionID   string
+	UserID      string
+	Channel     string // The client's release channel, see NormalizeChannel
+	OS          string // The client's operating system, see NormalizeOS
+	Arch        string // The client's architecture, see NormalizeArch
+	// The version of the browser sending the request (prodversion)
+	BrowserVersion string
+	// Events holds the events of pingbacks, see ClientEvents
+	Events []Event
+	// The package and patch formats the client accepts (acceptformat), in its
+	// order of preference. Empty if the client didn't list them.
+	AcceptFormats []string
+}
+
+// ClientID returns the stable identifier of the client sending the request, or an
+// empty string if the client did not identify itself. Session IDs change with every
+// update session, so clients only sending a session ID are not identified. Chromium's
+// update clients send no user ID, see InRollout for how unidentified clients are offered
+// staged rollouts.
+func (r *UpdateRequest) ClientID() string {
+	return r.UserID
 }
 
 // ExtensionsMap is safe for use across goroutines.
@@ -76,11 +176,11 @@ func CompareVersions(version1 string, version2 string) int {
 
 // ProcessExtensionRequests processes extension update requests and returns all requested extensions
 // with their appropriate update status (either available update, "noupdate", or error status).
-func ProcessExtensionRequests(extensions Extensions, allExtensionsMap *ExtensionsMap) Extensions {
+func ProcessExtensionRequests(updateRequest *UpdateRequest, allExtensionsMap *ExtensionsMap) Extensions {
 	processedExtensions := Extensions{}
 	allExtensionsMap.RLock()
 	defer allExtensionsMap.RUnlock()
-	for _, extensionBeingChecked := range extensions {
+	for _, extensionBeingChecked := range updateRequest.Extensions {
 		foundExtension, ok := allExtensionsMap.data[extensionBeingChecked.ID]
 		if !ok {
 			// Extension not found
@@ -96,16 +196,44 @@ func ProcessExtensionRequests(extensions Extensions, allExtensionsMap *Extension
 			blacklistedExtension.Status = "restricted"
 			blacklistedExtension.FP = extensionBeingChecked.FP
 			processedExtensions = append(processedExtensions, blacklistedExtension)
+		} else if platformExtension, status := forPlatform(foundExtension, updateRequest.OS, updateRequest.Arch); status != "" {
+			// No package for the client's platform
+			unsupportedExtension := foundExtension
+			unsupportedExtension.Status = status
+			unsupportedExtension.FP = extensionBeingChecked.FP
+			processedExtensions = append(processedExtensions, unsupportedExtension)
 		} else {
 			// Extension found and not blacklisted
+			cohort := platformExtension.AssignCohort(updateRequest.ClientID(), extensionBeingChecked)
+			selectedExtension, compatible := selectRelease(platformExtension, updateRequest, extensionBeingChecked, cohort)
+			foundExtension = selectedExtension
 			status := CompareVersions(extensionBeingChecked.Version, foundExtension.Version)
-			// Set status to "noupdate" if client has equal or newer version than server
-			if status >= 0 {
+			// Clients newer than the release they should get are only rolled back when
+			// they accept rollbacks and their version doesn't match their target prefix
+			rollback := extensionBeingChecked.RollbackAllowed &&
+				!MatchesVersionPrefix(extensionBeingChecked.Version, extensionBeingChecked.TargetVersionPrefix)
+			// Set status to "noupdate" if client has equal or newer version than server,
+			// unless the client is rolled back to an older version,
+			// or if no release can be loaded by the client's browser
+			if status == 0 || (status > 0 && !rollback) || !compatible {
 				foundExtension.Status = "noupdate"
 			}
-			// Status remains empty when client version is older (status < 0), indicating an update is available
+			// Status remains empty when an update (or rollback) is available
+			if foundExtension.Status == "" && !AcceptsPackage(updateRequest.AcceptFormats) {
+				foundExtension.Status = UnsupportedFormatStatus
+			}
+			if foundExtension.Status == "" && !foundExtension.CanOfferURLs() {
+				foundExtension.Status = MissingSignerStatus
+			}
 
 			foundExtension.FP = extensionBeingChecked.FP
+			foundExtension.CachedFPs = extensionBeingChecked.CachedFPs
+			foundExtension.AcceptFormats = updateRequest.AcceptFormats
+			if cohort != nil {
+				foundExtension.Cohort = cohort.ID
+				foundExtension.CohortHint = cohort.Hint
+				foundExtension.CohortName = cohort.Name
+			}
 			processedExtensions = append(processedExtensions, foundExtension)
 		}
 	}
@@ -143,6 +271,30 @@ func (m *ExtensionsMap) StoreExtensions(extensions *Extensions) {
 	}
 }
 
+// Replace swaps the contents of the map with the contents of other in a single
+// step, so readers never observe a partially refreshed map. It returns the
+// sorted IDs which were present before but are missing from other.
+func (m *ExtensionsMap) Replace(other *ExtensionsMap) []string {
+	other.RLock()
+	data := make(map[string]Extension, len(other.data))
+	for id, extension := range other.data {
+		data[id] = extension
+	}
+	other.RUnlock()
+
+	m.Lock()
+	defer m.Unlock()
+	removed := []string{}
+	for id := range m.data {
+		if _, ok := data[id]; !ok {
+			removed = append(removed, id)
+		}
+	}
+	sort.Strings(removed)
+	m.data = data
+	return removed
+}
+
 // MarshalJSON marshals the Extension map into a JSON byte slice
 func (m *ExtensionsMap) MarshalJSON() ([]byte, error) {
 	m.RLock()
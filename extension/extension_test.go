@@ -39,14 +39,14 @@ func TestProcessExtensionRequests(t *testing.T) {
 
 	// No updates when nothing to check
 	emptyExtensions := Extensions{}
-	check := ProcessExtensionRequests(emptyExtensions, testExtensionsMap)
+	check := ProcessExtensionRequests(&UpdateRequest{Extensions: emptyExtensions}, testExtensionsMap)
 	assert.Equal(t, 0, len(check))
 
 	olderExtensionCheck1 := lightThemeExtension
 	olderExtensionCheck1.Version = "0.1.0"
 	outdatedExtensionCheck := Extensions{olderExtensionCheck1}
 
-	check = ProcessExtensionRequests(outdatedExtensionCheck, testExtensionsMap)
+	check = ProcessExtensionRequests(&UpdateRequest{Extensions: outdatedExtensionCheck}, testExtensionsMap)
 	assert.Equal(t, 1, len(check))
 
 	assert.Equal(t, lightThemeExtension.ID, check[0].ID)
@@ -61,7 +61,7 @@ func TestProcessExtensionRequests(t *testing.T) {
 	newerExtensionCheck := lightThemeExtension
 	newerExtensionCheck.Version = "2.1.0"
 	extensions := Extensions{newerExtensionCheck}
-	check = ProcessExtensionRequests(extensions, testExtensionsMap)
+	check = ProcessExtensionRequests(&UpdateRequest{Extensions: extensions}, testExtensionsMap)
 	assert.Equal(t, 1, len(check))
 	assert.Equal(t, "noupdate", check[0].Status)
 
@@ -69,7 +69,7 @@ func TestProcessExtensionRequests(t *testing.T) {
 	olderExtensionCheck2 := darkThemeExtension
 	olderExtensionCheck2.Version = "0.1.0"
 	extensions = Extensions{olderExtensionCheck1, olderExtensionCheck2}
-	check = ProcessExtensionRequests(extensions, testExtensionsMap)
+	check = ProcessExtensionRequests(&UpdateRequest{Extensions: extensions}, testExtensionsMap)
 	assert.Equal(t, 2, len(check))
 	assert.Equal(t, olderExtensionCheck1.ID, check[0].ID)
 	assert.Equal(t, olderExtensionCheck2.ID, check[1].ID)
@@ -81,7 +81,7 @@ func TestProcessExtensionRequests(t *testing.T) {
 		elem.Blacklisted = true
 		allExtensionsBlacklistedMap.data[k] = elem
 	}
-	check = ProcessExtensionRequests(outdatedExtensionCheck, allExtensionsBlacklistedMap)
+	check = ProcessExtensionRequests(&UpdateRequest{Extensions: outdatedExtensionCheck}, allExtensionsBlacklistedMap)
 	assert.Equal(t, 1, len(check))
 	assert.Equal(t, "restricted", check[0].Status)
 
@@ -92,7 +92,7 @@ func TestProcessExtensionRequests(t *testing.T) {
 		FP:      "fingerprint123",
 	}
 	unknownExtensionCheck := Extensions{unknownExtension}
-	check = ProcessExtensionRequests(unknownExtensionCheck, testExtensionsMap)
+	check = ProcessExtensionRequests(&UpdateRequest{Extensions: unknownExtensionCheck}, testExtensionsMap)
 	assert.Equal(t, 1, len(check))
 	assert.Equal(t, "unknown-extension-id", check[0].ID)
 	assert.Equal(t, "error-unknownApplication", check[0].Status)
@@ -110,7 +110,7 @@ func TestProcessExtensionRequests(t *testing.T) {
 	restrictedExtensionCheck.FP = "restricted-fingerprint"
 	restrictedCheck := Extensions{restrictedExtensionCheck}
 
-	check = ProcessExtensionRequests(restrictedCheck, restrictedExtensionsMap)
+	check = ProcessExtensionRequests(&UpdateRequest{Extensions: restrictedCheck}, restrictedExtensionsMap)
 	assert.Equal(t, 1, len(check))
 	assert.Equal(t, lightThemeExtension.ID, check[0].ID)
 	assert.Equal(t, "restricted", check[0].Status)
@@ -134,6 +134,53 @@ func TestS3BucketForExtension(t *testing.T) {
 	assert.Equal(t, GetS3ExtensionBucketHost(lightThemeExtension.ID), "brave-core-ext.s3.brave.com")
 }
 
+func TestGetDownloadHosts(t *testing.T) {
+	lightThemeExtension := OfferedExtensions[0]
+	assert.Equal(t, []string{"brave-core-ext.s3.brave.com"}, GetDownloadHosts(lightThemeExtension))
+
+	// Mirrors follow the default host, but not the hosts of the routing table
+	t.Setenv("EXTENSIONS_MIRROR_HOSTS", "mirror1.example.com, mirror2.example.com,,brave-core-ext.s3.brave.com")
+	assert.Equal(t, []string{"brave-core-ext.s3.brave.com", "mirror1.example.com", "mirror2.example.com"}, GetDownloadHosts(lightThemeExtension))
+	assert.Equal(t, []string{"tor.bravesoftware.com"}, GetS3ExtensionBucketHosts("cldoidikboihgcjfkhdeidbpclkineef"))
+
+	// Extensions may list their own hosts
+	lightThemeExtension.DownloadHosts = []string{"cdn.example.com", "mirror1.example.com"}
+	assert.Equal(t, []string{"cdn.example.com", "mirror1.example.com"}, GetDownloadHosts(lightThemeExtension))
+}
+
+func TestGetPackageURLs(t *testing.T) {
+	lightThemeExtension := OfferedExtensions[0]
+	lightThemeExtension.SHA256 = "abc"
+	lightThemeExtension.DownloadHosts = []string{"cdn.example.com", "mirror.example.com"}
+	assert.Equal(t, "extension_1_0_0.crx", GetPackageName(lightThemeExtension))
+	assert.Equal(t, []string{
+		"https://cdn.example.com/release/ldimlcelhnjgpjjemdjokpgeeikdinbm/extension_1_0_0.crx",
+		"https://mirror.example.com/release/ldimlcelhnjgpjjemdjokpgeeikdinbm/extension_1_0_0.crx",
+	}, GetPackageURLs(lightThemeExtension))
+	assert.Equal(t, []string{
+		"https://cdn.example.com/release/ldimlcelhnjgpjjemdjokpgeeikdinbm/patches/abc/",
+		"https://mirror.example.com/release/ldimlcelhnjgpjjemdjokpgeeikdinbm/patches/abc/",
+	}, GetPatchURLs(lightThemeExtension))
+
+	// Templates replace the layout on every host
+	lightThemeExtension.URLTemplate = "https://{host}/components/{id}/{version}/{name}"
+	lightThemeExtension.PackageName = "light-theme-{version}.crx"
+	assert.Equal(t, "light-theme-1.0.0.crx", GetPackageName(lightThemeExtension))
+	assert.Equal(t, []string{
+		"https://cdn.example.com/components/ldimlcelhnjgpjjemdjokpgeeikdinbm/1.0.0/light-theme-1.0.0.crx",
+		"https://mirror.example.com/components/ldimlcelhnjgpjjemdjokpgeeikdinbm/1.0.0/light-theme-1.0.0.crx",
+	}, GetPackageURLs(lightThemeExtension))
+
+	// An explicit URL replaces all of them, but only for its own release
+	lightThemeExtension.URL = "https://downloads.example.com/light-theme.crx"
+	assert.Equal(t, []string{"https://downloads.example.com/light-theme.crx"}, GetPackageURLs(lightThemeExtension))
+	older := lightThemeExtension.WithRelease(Release{Version: "0.9.0", SHA256: "def"})
+	assert.Equal(t, []string{
+		"https://cdn.example.com/components/ldimlcelhnjgpjjemdjokpgeeikdinbm/0.9.0/light-theme-0.9.0.crx",
+		"https://mirror.example.com/components/ldimlcelhnjgpjjemdjokpgeeikdinbm/0.9.0/light-theme-0.9.0.crx",
+	}, GetPackageURLs(older))
+}
+
 func TestGetUpdaterHostByType(t *testing.T) {
 	host := GetUpdaterHostByType("chromiumcrx")
 	assert.Equal(t, "extensionupdater.brave.com", host)
@@ -147,3 +194,38 @@ func TestGetUpdaterHostByType(t *testing.T) {
 	host = GetUpdaterHostByType("")
 	assert.Equal(t, "componentupdater.brave.com", host)
 }
+
+func TestExtensionsMapReplace(t *testing.T) {
+	allExtensionsMap := NewExtensionMap()
+	allExtensionsMap.StoreExtensions(&OfferedExtensions)
+	assert.Equal(t, len(OfferedExtensions), allExtensionsMap.Len())
+
+	// Only the light and dark themes remain after the refresh
+	refreshed := Extensions{OfferedExtensions[0], OfferedExtensions[1]}
+	refreshed[0].Version = "2.0.0"
+	refreshedMap := NewExtensionMap()
+	refreshedMap.StoreExtensions(&refreshed)
+
+	removed := allExtensionsMap.Replace(refreshedMap)
+	assert.Equal(t, len(OfferedExtensions)-2, len(removed))
+	assert.NotContains(t, removed, OfferedExtensions[0].ID)
+	assert.NotContains(t, removed, OfferedExtensions[1].ID)
+	assert.Contains(t, removed, OfferedExtensions[2].ID)
+	assert.IsIncreasing(t, removed)
+	assert.Equal(t, 2, allExtensionsMap.Len())
+
+	lightThemeExtension, ok := allExtensionsMap.Load(OfferedExtensions[0].ID)
+	assert.True(t, ok)
+	assert.Equal(t, "2.0.0", lightThemeExtension.Version)
+	_, ok = allExtensionsMap.Load(OfferedExtensions[2].ID)
+	assert.False(t, ok)
+
+	// Later changes to the source map are not visible in the replaced map
+	refreshedMap.Store("unknown-extension-id", Extension{ID: "unknown-extension-id"})
+	_, ok = allExtensionsMap.Load("unknown-extension-id")
+	assert.False(t, ok)
+
+	// Replacing with identical contents removes nothing
+	removed = allExtensionsMap.Replace(allExtensionsMap)
+	assert.Empty(t, removed)
+}
@@ -0,0 +1,169 @@
+package extension
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Patch formats, named after the operations applying them
+const (
+	PatchFormatPuff      = "puff"
+	PatchFormatZucchini  = "zucc"
+	PatchFormatCourgette = "courgette"
+	PatchFormatBsdiff    = "bsdiff"
+)
+
+// PackageFormatCRX3 is the format of the packages served
+const PackageFormatCRX3 = "crx3"
+
+// UnsupportedFormatStatus is the status of update checks from clients which
+// accept none of the package formats served
+const UnsupportedFormatStatus = "error-unsupportedProtocol"
+
+// AcceptsPackage reports whether a client accepting acceptFormats can install the
+// packages served. Clients which don't list formats accept all of them.
+func AcceptsPackage(acceptFormats []string) bool {
+	return len(acceptFormats) == 0 || slices.Contains(acceptFormats, PackageFormatCRX3)
+}
+
+// DefaultPatchFormats lists the supported patch formats from the most to the
+// least preferred
+var DefaultPatchFormats = []string{PatchFormatPuff, PatchFormatZucchini, PatchFormatCourgette, PatchFormatBsdiff}
+
+// PatchFormatsIn returns the supported patch formats listed in acceptFormats, in
+// their order. Clients which list none of them, such as those only listing package
+// formats, are offered patches in every format.
+func PatchFormatsIn(acceptFormats []string) []string {
+	var formats []string
+	for _, format := range acceptFormats {
+		if slices.Contains(DefaultPatchFormats, format) {
+			formats = append(formats, format)
+		}
+	}
+	return formats
+}
+
+// PatchFormat returns the format of the patch
+func (p PatchInfo) PatchFormat() string {
+	if p.Format == "" {
+		return PatchFormatPuff
+	}
+	return p.Format
+}
+
+// ParseAcceptFormats splits the comma separated acceptformat of a request
+func ParseAcceptFormats(acceptFormat string) []string {
+	var formats []string
+	for format := range strings.SplitSeq(acceptFormat, ",") {
+		if format = strings.ToLower(strings.TrimSpace(format)); format != "" && !slices.Contains(formats, format) {
+			formats = append(formats, format)
+		}
+	}
+	return formats
+}
+
+// GetPatches returns the patches from the package of the client to the package
+// offered by the extension which the client can apply, in the order it should try
+// them: the patch formats the client accepts, in its order, or every format in the
+// order of DefaultPatchFormats if it didn't list any, see PatchFormatsIn. It returns nil if the client has
+// no patch.
+func GetPatches(extension Extension) []*PatchInfo {
+	return getPatchesFrom(extension, extension.FP)
+}
+
+// getPatchesFrom returns the patches from the package with fingerprint fp, see GetPatches
+func getPatchesFrom(extension Extension, fp string) []*PatchInfo {
+	if fp == "" {
+		return nil
+	}
+	patch, ok := extension.PatchList[fp]
+	if !ok || patch == nil {
+		return nil
+	}
+
+	formats := DefaultPatchFormats
+	if accepted := PatchFormatsIn(extension.AcceptFormats); len(accepted) > 0 {
+		formats = accepted
+	}
+	var patches []*PatchInfo
+	for _, p := range append([]*PatchInfo{patch}, patch.Alternatives...) {
+		if p != nil && slices.Contains(formats, p.PatchFormat()) {
+			patches = append(patches, p)
+		}
+	}
+	sort.SliceStable(patches, func(i, j int) bool {
+		return slices.Index(formats, patches[i].PatchFormat()) < slices.Index(formats, patches[j].PatchFormat())
+	})
+	return patches
+}
+
+// CachedPatch is a patch from a package cached by the client
+type CachedPatch struct {
+	FP    string
+	Patch *PatchInfo
+}
+
+// GetCachedPatches returns the patches from every package cached by the client, see
+// CachedFPs, to the package offered by the extension. The patches from a package are
+// ordered as by GetPatches, and the packages by the size of their first patch,
+// smallest first. Packages without patches the client can apply are left out.
+func GetCachedPatches(extension Extension) []CachedPatch {
+	fps := extension.CachedFPs
+	if len(fps) == 0 {
+		fps = []string{extension.FP}
+	}
+	var packages [][]*PatchInfo
+	var packageFPs []string
+	for _, fp := range fps {
+		if slices.Contains(packageFPs, fp) {
+			continue
+		}
+		if patches := getPatchesFrom(extension, fp); len(patches) > 0 {
+			packages = append(packages, patches)
+			packageFPs = append(packageFPs, fp)
+		}
+	}
+	order := make([]int, len(packages))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return packages[order[i]][0].Sizediff < packages[order[j]][0].Sizediff
+	})
+
+	var cached []CachedPatch
+	for _, i := range order {
+		for _, patch := range packages[i] {
+			cached = append(cached, CachedPatch{FP: packageFPs[i], Patch: patch})
+		}
+	}
+	return cached
+}
+
+// validatePatch checks that the patch and its alternatives have a hash and
+// distinct supported formats
+func validatePatch(patch *PatchInfo) error {
+	if patch == nil {
+		return fmt.Errorf("has empty Hashdiff")
+	}
+	formats := map[string]bool{}
+	for _, p := range append([]*PatchInfo{patch}, patch.Alternatives...) {
+		if p == nil || p.Hashdiff == "" {
+			return fmt.Errorf("has empty Hashdiff")
+		}
+		if len(p.Alternatives) > 0 && p != patch {
+			return fmt.Errorf("has nested alternatives")
+		}
+		format := p.PatchFormat()
+		if !slices.Contains(DefaultPatchFormats, format) {
+			return fmt.Errorf("has unsupported format %q", format)
+		}
+		if formats[format] {
+			return fmt.Errorf("has more than one %s patch", format)
+		}
+		formats[format] = true
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package extension
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAcceptFormats(t *testing.T) {
+	assert.Nil(t, ParseAcceptFormats(""))
+	assert.Equal(t, []string{"crx3", "zucc", "puff"}, ParseAcceptFormats("crx3, ZUCC,puff,,zucc"))
+}
+
+func TestGetPatches(t *testing.T) {
+	puff := &PatchInfo{Hashdiff: "puff-sha256"}
+	zucc := &PatchInfo{Hashdiff: "zucc-sha256", Format: PatchFormatZucchini}
+	bsdiff := &PatchInfo{Hashdiff: "bsdiff-sha256", Format: PatchFormatBsdiff}
+	puff.Alternatives = []*PatchInfo{bsdiff, zucc}
+	lightThemeExtension := OfferedExtensions[0]
+	lightThemeExtension.PatchList = map[string]*PatchInfo{"fp1": puff}
+
+	// Clients without a patch get none
+	assert.Nil(t, GetPatches(lightThemeExtension))
+	lightThemeExtension.FP = "fp2"
+	assert.Nil(t, GetPatches(lightThemeExtension))
+
+	// Formats are ordered by preference, the client's if it lists the patch formats
+	// it accepts, in which case it only gets these
+	lightThemeExtension.FP = "fp1"
+	assert.Equal(t, []*PatchInfo{puff, zucc, bsdiff}, GetPatches(lightThemeExtension))
+	lightThemeExtension.AcceptFormats = []string{"crx3", "bsdiff", "zucc"}
+	assert.Equal(t, []*PatchInfo{bsdiff, zucc}, GetPatches(lightThemeExtension))
+	lightThemeExtension.AcceptFormats = []string{"crx3", "courgette"}
+	assert.Nil(t, GetPatches(lightThemeExtension))
+
+	// Clients which only list package formats get every patch
+	lightThemeExtension.AcceptFormats = []string{"crx2", "crx3"}
+	assert.Equal(t, []*PatchInfo{puff, zucc, bsdiff}, GetPatches(lightThemeExtension))
+	lightThemeExtension.AcceptFormats = []string{"crx3"}
+	assert.Equal(t, []*PatchInfo{puff, zucc, bsdiff}, GetPatches(lightThemeExtension))
+}
+
+func TestPatchFormatsIn(t *testing.T) {
+	assert.Nil(t, PatchFormatsIn(nil))
+	assert.Nil(t, PatchFormatsIn([]string{"crx2", "crx3"}))
+	assert.Equal(t, []string{"zucc", "puff"}, PatchFormatsIn([]string{"crx3", "zucc", "xz", "puff"}))
+}
+
+func TestGetCachedPatches(t *testing.T) {
+	puff := &PatchInfo{Hashdiff: "puff-sha256", Sizediff: 100}
+	zucc := &PatchInfo{Hashdiff: "zucc-sha256", Sizediff: 120, Format: PatchFormatZucchini}
+	puff.Alternatives = []*PatchInfo{zucc}
+	older := &PatchInfo{Hashdiff: "older-sha256", Sizediff: 50}
+	lightThemeExtension := OfferedExtensions[0]
+	lightThemeExtension.PatchList = map[string]*PatchInfo{"fp1": puff, "fp0": older}
+
+	// Clients which don't list cached packages get the patches from the one they run
+	lightThemeExtension.FP = "fp1"
+	assert.Equal(t, []CachedPatch{{"fp1", puff}, {"fp1", zucc}}, GetCachedPatches(lightThemeExtension))
+
+	// Cached packages without patches are left out, the others are ordered by size
+	lightThemeExtension.CachedFPs = []string{"fp1", "fp2", "fp0", "fp1"}
+	assert.Equal(t, []CachedPatch{{"fp0", older}, {"fp1", puff}, {"fp1", zucc}}, GetCachedPatches(lightThemeExtension))
+	lightThemeExtension.AcceptFormats = []string{"crx3", "zucc"}
+	assert.Equal(t, []CachedPatch{{"fp1", zucc}}, GetCachedPatches(lightThemeExtension))
+}
+
+func TestProcessExtensionRequestsAcceptFormats(t *testing.T) {
+	assert.True(t, AcceptsPackage(nil))
+	assert.True(t, AcceptsPackage([]string{"crx2", "crx3"}))
+	assert.False(t, AcceptsPackage([]string{"crx2"}))
+
+	extensionsMap := NewExtensionMap()
+	extensionsMap.StoreExtensions(&OfferedExtensions)
+	check := func(version string, acceptFormats []string) Extension {
+		updateRequest := &UpdateRequest{
+			Extensions:    Extensions{{ID: OfferedExtensions[0].ID, Version: version}},
+			AcceptFormats: acceptFormats,
+		}
+		return ProcessExtensionRequests(updateRequest, extensionsMap)[0]
+	}
+
+	assert.Equal(t, "", check("0.1.0", []string{"crx3", "puff"}).Status)
+	assert.Equal(t, []string{"crx3", "puff"}, check("0.1.0", []string{"crx3", "puff"}).AcceptFormats)
+	assert.Equal(t, UnsupportedFormatStatus, check("0.1.0", []string{"crx2"}).Status)
+	// Clients which are up to date don't need a package
+	assert.Equal(t, "noupdate", check(OfferedExtensions[0].Version, []string{"crx2"}).Status)
+}
+
+func TestValidatePatch(t *testing.T) {
+	patch := &PatchInfo{Hashdiff: "puff-sha256", Alternatives: []*PatchInfo{{Hashdiff: "zucc-sha256", Format: PatchFormatZucchini}}}
+	assert.Nil(t, validatePatch(patch))
+
+	patch.Alternatives[0].Hashdiff = ""
+	assert.ErrorContains(t, validatePatch(patch), "has empty Hashdiff")
+	patch.Alternatives[0] = &PatchInfo{Hashdiff: "zucc-sha256", Format: "xdelta"}
+	assert.ErrorContains(t, validatePatch(patch), `has unsupported format "xdelta"`)
+	patch.Alternatives[0] = &PatchInfo{Hashdiff: "other-sha256", Format: PatchFormatPuff}
+	assert.ErrorContains(t, validatePatch(patch), "has more than one puff patch")
+	patch.Alternatives[0] = &PatchInfo{Hashdiff: "zucc-sha256", Format: PatchFormatZucchini, Alternatives: []*PatchInfo{{Hashdiff: "x"}}}
+	assert.ErrorContains(t, validatePatch(patch), "has nested alternatives")
+}
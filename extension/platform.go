@@ -0,0 +1,95 @@
+package extension
+
+import (
+	"slices"
+	"strings"
+)
+
+// knownOS maps the operating system names reported by clients, either as @os or
+// as os.platform, to the names used by the catalog
+var knownOS = map[string]string{
+	"mac":       "mac",
+	"mac os x":  "mac",
+	"macos":     "mac",
+	"win":       "win",
+	"windows":   "win",
+	"linux":     "linux",
+	"android":   "android",
+	"cros":      "cros",
+	"chromeos":  "cros",
+	"chrome os": "cros",
+	"ios":       "ios",
+	"fuchsia":   "fuchsia",
+	"openbsd":   "openbsd",
+	"freebsd":   "freebsd",
+}
+
+// knownArch maps the architecture names reported by clients, either as arch,
+// os.arch or nacl_arch, to the names used by the catalog
+var knownArch = map[string]string{
+	"x86":     "x86",
+	"x86-32":  "x86",
+	"i386":    "x86",
+	"i686":    "x86",
+	"x64":     "x64",
+	"x86_64":  "x64",
+	"x86-64":  "x64",
+	"amd64":   "x64",
+	"arm":     "arm",
+	"armv7l":  "arm",
+	"arm64":   "arm64",
+	"aarch64": "arm64",
+}
+
+// NormalizeOS returns the catalog name of the first of the given operating system
+// names which is known, or an empty string if none is
+func NormalizeOS(names ...string) string {
+	return normalizeName(knownOS, names)
+}
+
+// NormalizeArch returns the catalog name of the first of the given architecture
+// names which is known, or an empty string if none is
+func NormalizeArch(names ...string) string {
+	return normalizeName(knownArch, names)
+}
+
+func normalizeName(known map[string]string, names []string) string {
+	for _, name := range names {
+		if normalized, ok := known[strings.ToLower(strings.TrimSpace(name))]; ok {
+			return normalized
+		}
+	}
+	return ""
+}
+
+// platformStatus returns the update status for a client on os and arch of a package
+// limited to osList and archList, which is empty if the client is supported.
+// An empty list supports every client, including clients which don't report their platform.
+func platformStatus(osList []string, archList []string, os string, arch string) string {
+	if len(osList) > 0 && !slices.Contains(osList, os) {
+		return "error-osnotsupported"
+	}
+	if len(archList) > 0 && !slices.Contains(archList, arch) {
+		return "error-hwnotsupported"
+	}
+	return ""
+}
+
+// forPlatform returns a copy of the extension offering the package built for the
+// client's platform along with an empty status, or an error status if there is none.
+// Platform specific releases take precedence over the extension's own package and
+// are not subject to channels or staged rollouts.
+func forPlatform(extension Extension, os string, arch string) (Extension, string) {
+	for _, release := range extension.PlatformReleases {
+		if release != nil && platformStatus(release.OS, release.Arch, os, arch) == "" {
+			platformExtension := extension.WithRelease(*release)
+			platformExtension.OS = release.OS
+			platformExtension.Arch = release.Arch
+			platformExtension.RolloutPercentage = 0
+			platformExtension.PreviousRelease = nil
+			platformExtension.Channels = nil
+			return platformExtension, ""
+		}
+	}
+	return extension, platformStatus(extension.OS, extension.Arch, os, arch)
+}
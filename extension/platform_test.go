@@ -0,0 +1,77 @@
+package extension
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizePlatform(t *testing.T) {
+	assert.Equal(t, "mac", NormalizeOS("mac"))
+	assert.Equal(t, "mac", NormalizeOS("", "Mac OS X"))
+	assert.Equal(t, "win", NormalizeOS("Windows"))
+	assert.Equal(t, "cros", NormalizeOS("", "Chrome OS"))
+	assert.Equal(t, "linux", NormalizeOS("plan9", "Linux"))
+	assert.Equal(t, "", NormalizeOS("", ""))
+
+	assert.Equal(t, "x64", NormalizeArch("x64"))
+	assert.Equal(t, "x64", NormalizeArch("", "x86_64"))
+	assert.Equal(t, "x64", NormalizeArch("", "", "x86-64"))
+	assert.Equal(t, "arm64", NormalizeArch("", "aarch64", "arm"))
+	assert.Equal(t, "x86", NormalizeArch("", "", "x86-32"))
+	assert.Equal(t, "", NormalizeArch("mips"))
+}
+
+func TestProcessExtensionRequestsPlatforms(t *testing.T) {
+	torClient := Extension{
+		ID:      "cldoidikboihgcjfkhdeidbpclkineef",
+		Version: "1.0.0",
+		SHA256:  "mac-x64-sha256",
+		OS:      []string{"mac"},
+		Arch:    []string{"x64"},
+		PlatformReleases: []*Release{
+			{Version: "1.0.1", SHA256: "mac-arm64-sha256", OS: []string{"mac"}, Arch: []string{"arm64"}},
+			{Version: "1.0.2", SHA256: "win-sha256", OS: []string{"win"}},
+		},
+	}
+	extensionsMap := NewExtensionMap()
+	extensionsMap.StoreExtensions(&Extensions{torClient})
+
+	check := func(os string, arch string) Extension {
+		updateRequest := &UpdateRequest{
+			Extensions: Extensions{{ID: torClient.ID, Version: "0.1.0", FP: "fp"}},
+			OS:         os,
+			Arch:       arch,
+		}
+		processed := ProcessExtensionRequests(updateRequest, extensionsMap)
+		assert.Equal(t, 1, len(processed))
+		assert.Equal(t, "fp", processed[0].FP)
+		return processed[0]
+	}
+
+	macX64 := check("mac", "x64")
+	assert.Equal(t, "", macX64.Status)
+	assert.Equal(t, "mac-x64-sha256", macX64.SHA256)
+
+	macArm64 := check("mac", "arm64")
+	assert.Equal(t, "", macArm64.Status)
+	assert.Equal(t, "1.0.1", macArm64.Version)
+	assert.Equal(t, "mac-arm64-sha256", macArm64.SHA256)
+
+	for _, arch := range []string{"x86", "x64", "arm64"} {
+		win := check("win", arch)
+		assert.Equal(t, "", win.Status)
+		assert.Equal(t, "win-sha256", win.SHA256)
+	}
+
+	assert.Equal(t, "error-osnotsupported", check("linux", "x64").Status)
+	assert.Equal(t, "error-hwnotsupported", check("mac", "x86").Status)
+
+	// Clients which don't report their platform can't get a platform specific package
+	assert.Equal(t, "error-osnotsupported", check("", "").Status)
+
+	// Extensions without constraints are offered to every platform
+	extensionsMap.Store(torClient.ID, Extension{ID: torClient.ID, Version: "1.0.0", SHA256: "any-sha256"})
+	assert.Equal(t, "", check("", "").Status)
+	assert.Equal(t, "", check("linux", "arm").Status)
+}
@@ -0,0 +1,203 @@
+package extension
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// Release channels, from the most to the least stable
+const (
+	ChannelStable  = "stable"
+	ChannelBeta    = "beta"
+	ChannelDev     = "dev"
+	ChannelNightly = "nightly"
+)
+
+// channelAliases maps other names clients use for a channel to the channel
+var channelAliases = map[string]string{
+	"":        ChannelStable,
+	"release": ChannelStable,
+	"canary":  ChannelNightly,
+}
+
+// moreStableChannels lists the channels whose releases a client on the channel
+// also accepts, in addition to the stable release
+var moreStableChannels = map[string][]string{
+	ChannelBeta:    {ChannelBeta},
+	ChannelDev:     {ChannelDev, ChannelBeta},
+	ChannelNightly: {ChannelNightly, ChannelDev, ChannelBeta},
+}
+
+// Release states. Releases without a state are released.
+const (
+	ReleaseStateReleased = "released"
+	ReleaseStatePulled   = "pulled"
+)
+
+// Release describes a single published package of an extension
+type Release struct {
+	Version   string                `json:"Version" dynamodbav:"Version"`
+	SHA256    string                `json:"SHA256" dynamodbav:"SHA256"`
+	Size      uint64                `json:"Size" dynamodbav:"Size,omitempty"`
+	PatchList map[string]*PatchInfo `json:"PatchList" dynamodbav:"PatchList,omitempty"`
+
+	// URL is the download URL of the package, see Extension
+	URL string `json:"URL,omitempty" dynamodbav:"URL,omitempty"`
+
+	// OS and Arch limit the release to clients on these platforms, see Extension
+	OS   []string `json:"OS,omitempty" dynamodbav:"OS,omitempty"`
+	Arch []string `json:"Arch,omitempty" dynamodbav:"Arch,omitempty"`
+
+	// MinBrowserVersion and MaxBrowserVersion limit the release to compatible browsers, see Extension
+	MinBrowserVersion string `json:"MinBrowserVersion,omitempty" dynamodbav:"MinBrowserVersion,omitempty"`
+	MaxBrowserVersion string `json:"MaxBrowserVersion,omitempty" dynamodbav:"MaxBrowserVersion,omitempty"`
+
+	// ReleaseTime is when the release was published
+	ReleaseTime time.Time `json:"ReleaseTime,omitzero" dynamodbav:"ReleaseTime,omitempty"`
+
+	// State is ReleaseStateReleased (or empty) for releases which may be served, or
+	// ReleaseStatePulled for releases which were withdrawn and are never served again
+	State string `json:"State,omitempty" dynamodbav:"State,omitempty"`
+}
+
+// Served reports whether the release may be offered to clients
+func (r Release) Served() bool {
+	return r.State == "" || r.State == ReleaseStateReleased
+}
+
+// WithHistory returns a copy of the extension whose version history is sorted from
+// the oldest to the newest release, and whose current release is the newest release
+// of the history which was not pulled. The current release of extensions stored
+// without a history, or missing from their history, is added to the history first.
+func (e Extension) WithHistory() Extension {
+	releases := make([]*Release, 0, len(e.Releases)+1)
+	currentInHistory := false
+	for _, release := range e.Releases {
+		if release == nil {
+			continue
+		}
+		if release.Version == e.Version {
+			currentInHistory = true
+		}
+		releaseCopy := *release
+		releases = append(releases, &releaseCopy)
+	}
+	if e.Version != "" && !currentInHistory {
+		releases = append(releases, &Release{
+			Version:           e.Version,
+			SHA256:            e.SHA256,
+			Size:              e.Size,
+			PatchList:         e.PatchList,
+			URL:               e.URL,
+			MinBrowserVersion: e.MinBrowserVersion,
+			MaxBrowserVersion: e.MaxBrowserVersion,
+		})
+	}
+	sort.SliceStable(releases, func(i, j int) bool {
+		return CompareVersions(releases[i].Version, releases[j].Version) < 0
+	})
+	e.Releases = releases
+
+	for i := len(releases) - 1; i >= 0; i-- {
+		if releases[i].Served() {
+			return e.WithRelease(*releases[i])
+		}
+	}
+	return e
+}
+
+// WithRelease returns a copy of the extension which offers release instead of
+// the extension's own package
+func (e Extension) WithRelease(release Release) Extension {
+	e.Version = release.Version
+	e.SHA256 = release.SHA256
+	e.Size = release.Size
+	e.PatchList = release.PatchList
+	e.URL = release.URL
+	e.MinBrowserVersion = release.MinBrowserVersion
+	e.MaxBrowserVersion = release.MaxBrowserVersion
+	return e
+}
+
+// SupportsBrowser reports whether the package offered by the extension can be
+// loaded by the given browser version. Clients which don't report their browser
+// version are treated as version 0 and are only offered packages without a minimum.
+func (e Extension) SupportsBrowser(browserVersion string) bool {
+	if e.MinBrowserVersion != "" && CompareVersions(browserVersion, e.MinBrowserVersion) < 0 {
+		return false
+	}
+	if e.MaxBrowserVersion != "" && CompareVersions(browserVersion, e.MaxBrowserVersion) > 0 {
+		return false
+	}
+	return true
+}
+
+// NormalizeChannel maps the channel reported by a client to one of the release
+// channels. Unknown channels are treated as stable.
+func NormalizeChannel(channel string) string {
+	channel = strings.ToLower(strings.TrimSpace(channel))
+	if alias, ok := channelAliases[channel]; ok {
+		return alias
+	}
+	if _, ok := moreStableChannels[channel]; ok {
+		return channel
+	}
+	return ChannelStable
+}
+
+// MatchesVersionPrefix reports whether version starts with the given components,
+// e.g. "1.2.3" matches the prefixes "1", "1.2" and "1.2." but not "1.20".
+// Every version matches an empty prefix.
+func MatchesVersionPrefix(version string, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, ".")
+	if prefix == "" {
+		return true
+	}
+	return version == prefix || strings.HasPrefix(version, prefix+".")
+}
+
+// selectRelease returns a copy of the extension which offers the release the client
+// sending updateRequest should get for the requested extension, or false if no release
+// is suitable. Clients get the newest release compatible with their browser and matching
+// their target version prefix among the stable release, which is subject to staged
+// rollouts, the releases of their channel and of the more stable channels, the release
+// of their cohort, and the older releases of the version history which were not pulled.
+func selectRelease(extension Extension, updateRequest *UpdateRequest, requested Extension, cohort *Cohort) (Extension, bool) {
+	candidates := Extensions{}
+	if extension.InRollout(updateRequest.ClientID()) {
+		candidates = append(candidates, extension)
+	}
+	if extension.PreviousRelease != nil {
+		candidates = append(candidates, extension.WithRelease(*extension.PreviousRelease))
+	}
+	for _, channel := range moreStableChannels[NormalizeChannel(updateRequest.Channel)] {
+		if release, ok := extension.Channels[channel]; ok && release != nil {
+			candidates = append(candidates, extension.WithRelease(*release))
+		}
+	}
+	if cohort != nil && cohort.Release != nil {
+		candidates = append(candidates, extension.WithRelease(*cohort.Release))
+	}
+	for _, release := range extension.Releases {
+		// The current release is only offered subject to staged rollouts
+		if release != nil && release.Served() && CompareVersions(release.Version, extension.Version) < 0 {
+			candidates = append(candidates, extension.WithRelease(*release))
+		}
+	}
+
+	selected := -1
+	for i, candidate := range candidates {
+		if !candidate.SupportsBrowser(updateRequest.BrowserVersion) ||
+			!MatchesVersionPrefix(candidate.Version, requested.TargetVersionPrefix) {
+			continue
+		}
+		if selected < 0 || CompareVersions(candidate.Version, candidates[selected].Version) > 0 {
+			selected = i
+		}
+	}
+	if selected < 0 {
+		return extension, false
+	}
+	return candidates[selected], true
+}
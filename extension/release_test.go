@@ -0,0 +1,256 @@
+package extension
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeChannel(t *testing.T) {
+	assert.Equal(t, ChannelStable, NormalizeChannel(""))
+	assert.Equal(t, ChannelStable, NormalizeChannel("stable"))
+	assert.Equal(t, ChannelStable, NormalizeChannel("Release"))
+	assert.Equal(t, ChannelBeta, NormalizeChannel("beta"))
+	assert.Equal(t, ChannelDev, NormalizeChannel("DEV"))
+	assert.Equal(t, ChannelNightly, NormalizeChannel("nightly"))
+	assert.Equal(t, ChannelNightly, NormalizeChannel("canary"))
+	assert.Equal(t, ChannelStable, NormalizeChannel("extended"))
+}
+
+func TestProcessExtensionRequestsChannels(t *testing.T) {
+	lightThemeExtension := OfferedExtensions[0]
+	lightThemeExtension.Version = "1.0.0"
+	lightThemeExtension.Channels = map[string]*Release{
+		ChannelBeta:    {Version: "1.1.0", SHA256: "beta-sha256"},
+		ChannelNightly: {Version: "1.2.0", SHA256: "nightly-sha256", Size: 2048},
+	}
+	extensionsMap := NewExtensionMap()
+	extensionsMap.StoreExtensions(&Extensions{lightThemeExtension})
+
+	outdatedExtensionCheck := Extensions{{ID: lightThemeExtension.ID, Version: "0.1.0"}}
+	check := func(channel string) Extension {
+		processed := ProcessExtensionRequests(&UpdateRequest{Extensions: outdatedExtensionCheck, Channel: channel}, extensionsMap)
+		assert.Equal(t, 1, len(processed))
+		return processed[0]
+	}
+
+	assert.Equal(t, "1.0.0", check("").Version)
+	assert.Equal(t, "1.0.0", check("stable").Version)
+	assert.Equal(t, "1.1.0", check("beta").Version)
+	assert.Equal(t, "beta-sha256", check("beta").SHA256)
+	nightly := check("nightly")
+	assert.Equal(t, "1.2.0", nightly.Version)
+	assert.Equal(t, "nightly-sha256", nightly.SHA256)
+	assert.Equal(t, uint64(2048), nightly.Size)
+
+	// Dev has no release of its own and falls back to beta
+	assert.Equal(t, "1.1.0", check("dev").Version)
+
+	// Channels never get a release older than the more stable channels
+	lightThemeExtension.Version = "1.3.0"
+	extensionsMap.Store(lightThemeExtension.ID, lightThemeExtension)
+	assert.Equal(t, "1.3.0", check("beta").Version)
+	assert.Equal(t, "1.3.0", check("nightly").Version)
+
+	// Clients on a channel release get no update
+	processed := ProcessExtensionRequests(&UpdateRequest{Extensions: Extensions{{ID: lightThemeExtension.ID, Version: "1.3.0"}}, Channel: "nightly"}, extensionsMap)
+	assert.Equal(t, "noupdate", processed[0].Status)
+}
+
+func TestProcessExtensionRequestsBrowserVersion(t *testing.T) {
+	lightThemeExtension := OfferedExtensions[0]
+	lightThemeExtension.Version = "2.0.0"
+	lightThemeExtension.SHA256 = "new-sha256"
+	lightThemeExtension.MinBrowserVersion = "130.0.0.0"
+	lightThemeExtension.PreviousRelease = &Release{
+		Version:           "1.5.0",
+		SHA256:            "previous-sha256",
+		MinBrowserVersion: "120.0.0.0",
+	}
+	lightThemeExtension.RolloutPercentage = 100
+	extensionsMap := NewExtensionMap()
+	extensionsMap.StoreExtensions(&Extensions{lightThemeExtension})
+
+	check := func(browserVersion string, version string) Extension {
+		updateRequest := &UpdateRequest{
+			Extensions:     Extensions{{ID: lightThemeExtension.ID, Version: version}},
+			UserID:         "{client}",
+			BrowserVersion: browserVersion,
+		}
+		processed := ProcessExtensionRequests(updateRequest, extensionsMap)
+		assert.Equal(t, 1, len(processed))
+		return processed[0]
+	}
+
+	// Browsers new enough get the newest version
+	current := check("137.0.7115.0", "0.1.0")
+	assert.Equal(t, "", current.Status)
+	assert.Equal(t, "2.0.0", current.Version)
+	assert.Equal(t, "new-sha256", current.SHA256)
+
+	// Older browsers get the newest version they support
+	older := check("125.1.2.3", "0.1.0")
+	assert.Equal(t, "", older.Status)
+	assert.Equal(t, "1.5.0", older.Version)
+	assert.Equal(t, "previous-sha256", older.SHA256)
+	assert.Equal(t, "noupdate", check("125.1.2.3", "1.5.0").Status)
+
+	// Browsers too old for every version get no update
+	assert.Equal(t, "noupdate", check("110.0.0.0", "0.1.0").Status)
+	assert.Equal(t, "noupdate", check("", "0.1.0").Status)
+
+	// Browsers too new for a version skip it
+	lightThemeExtension.MaxBrowserVersion = "136"
+	extensionsMap.Store(lightThemeExtension.ID, lightThemeExtension)
+	assert.Equal(t, "1.5.0", check("137.0.7115.0", "0.1.0").Version)
+	assert.Equal(t, "2.0.0", check("136.0.1.0", "0.1.0").Version)
+}
+
+func TestMatchesVersionPrefix(t *testing.T) {
+	assert.True(t, MatchesVersionPrefix("1.2.3", ""))
+	assert.True(t, MatchesVersionPrefix("1.2.3", "1"))
+	assert.True(t, MatchesVersionPrefix("1.2.3", "1.2"))
+	assert.True(t, MatchesVersionPrefix("1.2.3", "1.2."))
+	assert.True(t, MatchesVersionPrefix("1.2.3", "1.2.3"))
+	assert.False(t, MatchesVersionPrefix("1.20.3", "1.2"))
+	assert.False(t, MatchesVersionPrefix("1.2.3", "1.2.3.4"))
+	assert.False(t, MatchesVersionPrefix("2.2.3", "1."))
+}
+
+func TestProcessExtensionRequestsVersionPinning(t *testing.T) {
+	lightThemeExtension := OfferedExtensions[0]
+	lightThemeExtension.Version = "2.1.0"
+	lightThemeExtension.SHA256 = "current-sha256"
+	lightThemeExtension.Releases = []*Release{
+		{Version: "1.9.0", SHA256: "old-sha256"},
+		{Version: "2.0.0", SHA256: "pinned-sha256", Size: 4096},
+		{Version: "1.10.0", SHA256: "newer-old-sha256"},
+	}
+	extensionsMap := NewExtensionMap()
+	extensionsMap.StoreExtensions(&Extensions{lightThemeExtension})
+
+	check := func(version string, prefix string, rollbackAllowed bool) Extension {
+		updateRequest := &UpdateRequest{Extensions: Extensions{{
+			ID:                  lightThemeExtension.ID,
+			Version:             version,
+			TargetVersionPrefix: prefix,
+			RollbackAllowed:     rollbackAllowed,
+		}}}
+		processed := ProcessExtensionRequests(updateRequest, extensionsMap)
+		assert.Equal(t, 1, len(processed))
+		return processed[0]
+	}
+
+	// Unpinned clients get the current release
+	processed := check("1.0.0", "", false)
+	assert.Equal(t, "2.1.0", processed.Version)
+	assert.Equal(t, "", processed.Status)
+
+	// Pinned clients get the newest release matching their prefix
+	processed = check("1.0.0", "2.0.", false)
+	assert.Equal(t, "2.0.0", processed.Version)
+	assert.Equal(t, "pinned-sha256", processed.SHA256)
+	assert.Equal(t, uint64(4096), processed.Size)
+	assert.Equal(t, "", processed.Status)
+	assert.Equal(t, "1.10.0", check("1.0.0", "1", false).Version)
+
+	// Pinned clients already past their prefix only downgrade if rollbacks are allowed
+	assert.Equal(t, "noupdate", check("2.1.0", "2.0", false).Status)
+	processed = check("2.1.0", "2.0", true)
+	assert.Equal(t, "2.0.0", processed.Version)
+	assert.Equal(t, "", processed.Status)
+
+	// No release matches the prefix
+	processed = check("1.0.0", "3.", true)
+	assert.Equal(t, "noupdate", processed.Status)
+
+	// Allowing rollbacks doesn't downgrade clients on the current release, clients
+	// without a prefix, or clients matching their prefix
+	assert.Equal(t, "noupdate", check("2.1.0", "", true).Status)
+	assert.Equal(t, "noupdate", check("3.0.0", "", true).Status)
+	assert.Equal(t, "noupdate", check("2.0.5", "2.0", true).Status)
+}
+
+func TestExtensionWithHistory(t *testing.T) {
+	// Extensions stored without a history get their current release as history
+	legacy := Extension{ID: "ldimlcelhnjgpjjemdjokpgeeikdinbm", Version: "1.0.0", SHA256: "abc", Size: 10}
+	normalized := legacy.WithHistory()
+	assert.Equal(t, "1.0.0", normalized.Version)
+	assert.Equal(t, []*Release{{Version: "1.0.0", SHA256: "abc", Size: 10}}, normalized.Releases)
+
+	// The current release is derived from the history, skipping pulled releases
+	releaseTime := time.Date(2026, time.March, 1, 0, 0, 0, 0, time.UTC)
+	history := Extension{
+		ID: "ldimlcelhnjgpjjemdjokpgeeikdinbm",
+		Releases: []*Release{
+			{Version: "1.10.0", SHA256: "pulled-sha256", State: ReleaseStatePulled},
+			{Version: "1.2.0", SHA256: "old-sha256"},
+			{Version: "1.9.0", SHA256: "current-sha256", Size: 20, ReleaseTime: releaseTime, State: ReleaseStateReleased},
+		},
+	}
+	normalized = history.WithHistory()
+	assert.Equal(t, "1.9.0", normalized.Version)
+	assert.Equal(t, "current-sha256", normalized.SHA256)
+	assert.Equal(t, uint64(20), normalized.Size)
+	assert.Equal(t, 3, len(normalized.Releases))
+	assert.Equal(t, "1.2.0", normalized.Releases[0].Version)
+	assert.Equal(t, "1.9.0", normalized.Releases[1].Version)
+	assert.Equal(t, releaseTime, normalized.Releases[1].ReleaseTime)
+	assert.Equal(t, "1.10.0", normalized.Releases[2].Version)
+	assert.Equal(t, "1.2.0", history.Releases[1].Version, "the original history is left untouched")
+
+	// A pulled current release is replaced by the newest release which was not pulled
+	history.Version = "1.10.0"
+	history.SHA256 = "pulled-sha256"
+	normalized = history.WithHistory()
+	assert.Equal(t, "1.9.0", normalized.Version)
+	assert.Equal(t, 3, len(normalized.Releases))
+
+	// A current release missing from the history is added to it
+	history.Version = "2.0.0"
+	history.SHA256 = "new-sha256"
+	normalized = history.WithHistory()
+	assert.Equal(t, "2.0.0", normalized.Version)
+	assert.Equal(t, "new-sha256", normalized.SHA256)
+	assert.Equal(t, 4, len(normalized.Releases))
+	assert.Equal(t, "2.0.0", normalized.Releases[3].Version)
+}
+
+func TestProcessExtensionRequestsHistory(t *testing.T) {
+	lightThemeExtension := OfferedExtensions[0]
+	lightThemeExtension.Version = ""
+	lightThemeExtension.SHA256 = ""
+	lightThemeExtension.Releases = []*Release{
+		{Version: "1.0.0", SHA256: "first-sha256"},
+		{Version: "1.1.0", SHA256: "pulled-sha256", State: ReleaseStatePulled},
+		{Version: "1.2.0", SHA256: "current-sha256"},
+	}
+	lightThemeExtension.PreviousRelease = &Release{Version: "1.0.0", SHA256: "first-sha256"}
+	lightThemeExtension.RolloutPercentage = 0
+	extensionsMap := NewExtensionMap()
+	extensionsMap.StoreExtensions(&Extensions{lightThemeExtension.WithHistory()})
+
+	check := func(version string, prefix string) Extension {
+		updateRequest := &UpdateRequest{
+			Extensions: Extensions{{ID: lightThemeExtension.ID, Version: version, TargetVersionPrefix: prefix}},
+			UserID:     "{client}",
+		}
+		processed := ProcessExtensionRequests(updateRequest, extensionsMap)
+		assert.Equal(t, 1, len(processed))
+		return processed[0]
+	}
+
+	// The current release found in the history is still subject to staged rollouts
+	assert.Equal(t, "1.0.0", check("0.9.0", "").Version)
+
+	// Pulled releases are never offered
+	assert.Equal(t, "noupdate", check("0.9.0", "1.1").Status)
+	assert.Equal(t, "noupdate", check("1.0.0", "").Status)
+
+	lightThemeExtension.RolloutPercentage = 100
+	extensionsMap.Store(lightThemeExtension.ID, lightThemeExtension.WithHistory())
+	processed := check("1.0.0", "")
+	assert.Equal(t, "1.2.0", processed.Version)
+	assert.Equal(t, "current-sha256", processed.SHA256)
+}
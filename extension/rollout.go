@@ -0,0 +1,32 @@
+package extension
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"math/rand/v2"
+)
+
+// InRollout reports whether the client identified by clientID is offered Version
+// of the extension. Every client is offered Version unless a staged rollout is in
+// progress, in which case clients are deterministically bucketed by their ID and the
+// ID of the extension. Clients which don't identify themselves by a user ID, see
+// UpdateRequest.ClientID, are offered Version with the rollout percentage as the
+// chance on every update check.
+func (e Extension) InRollout(clientID string) bool {
+	if e.PreviousRelease == nil {
+		return true
+	}
+	bucket := rand.IntN(100) // nosemgrep: go.lang.security.audit.crypto.math_random.math-random-used
+	if clientID != "" {
+		bucket = RolloutBucket(clientID, e.ID)
+	}
+	return bucket < e.RolloutPercentage
+}
+
+// RolloutBucket maps a client and an extension to a bucket in the range [0, 100).
+// The same client always lands in the same bucket for a given extension, while
+// buckets of different extensions are independent of each other.
+func RolloutBucket(clientID string, extensionID string) int {
+	sum := sha256.Sum256([]byte(clientID + ":" + extensionID))
+	return int(binary.BigEndian.Uint64(sum[:8]) % 100)
+}
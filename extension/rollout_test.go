@@ -0,0 +1,101 @@
+package extension
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRolloutBucket(t *testing.T) {
+	// Buckets are deterministic
+	assert.Equal(t, RolloutBucket("client", "extension"), RolloutBucket("client", "extension"))
+
+	// Buckets are spread evenly across clients
+	counts := make([]int, 100)
+	for i := 0; i < 100000; i++ {
+		bucket := RolloutBucket(fmt.Sprintf("{client-%d}", i), "ldimlcelhnjgpjjemdjokpgeeikdinbm")
+		assert.True(t, bucket >= 0 && bucket < 100)
+		counts[bucket]++
+	}
+	for _, count := range counts {
+		assert.InDelta(t, 1000, count, 200)
+	}
+}
+
+func TestProcessExtensionRequestsRollout(t *testing.T) {
+	lightThemeExtension := OfferedExtensions[0]
+	lightThemeExtension.Version = "2.0.0"
+	lightThemeExtension.SHA256 = "new-sha256"
+	lightThemeExtension.RolloutPercentage = 5
+	lightThemeExtension.PreviousRelease = &Release{
+		Version: "1.0.0",
+		SHA256:  "previous-sha256",
+		Size:    1024,
+	}
+	extensionsMap := NewExtensionMap()
+	extensionsMap.StoreExtensions(&Extensions{lightThemeExtension})
+
+	outdatedExtensionCheck := Extensions{{ID: lightThemeExtension.ID, Version: "0.1.0"}}
+
+	// Find one client inside and one outside of the 5% rollout
+	var clientInRollout, clientOutsideRollout string
+	for i := 0; clientInRollout == "" || clientOutsideRollout == ""; i++ {
+		clientID := fmt.Sprintf("{client-%d}", i)
+		if RolloutBucket(clientID, lightThemeExtension.ID) < 5 {
+			clientInRollout = clientID
+		} else {
+			clientOutsideRollout = clientID
+		}
+	}
+
+	check := ProcessExtensionRequests(&UpdateRequest{Extensions: outdatedExtensionCheck, UserID: clientInRollout}, extensionsMap)
+	assert.Equal(t, 1, len(check))
+	assert.Equal(t, "", check[0].Status)
+	assert.Equal(t, "2.0.0", check[0].Version)
+	assert.Equal(t, "new-sha256", check[0].SHA256)
+
+	check = ProcessExtensionRequests(&UpdateRequest{Extensions: outdatedExtensionCheck, UserID: clientOutsideRollout}, extensionsMap)
+	assert.Equal(t, 1, len(check))
+	assert.Equal(t, "", check[0].Status)
+	assert.Equal(t, "1.0.0", check[0].Version)
+	assert.Equal(t, "previous-sha256", check[0].SHA256)
+	assert.Equal(t, uint64(1024), check[0].Size)
+
+	// Clients which don't identify themselves are offered the new version by chance
+	// on every check. Session IDs change with every update session, so they don't
+	// identify clients either.
+	offered := 0
+	for i := 0; i < 1000; i++ {
+		check = ProcessExtensionRequests(&UpdateRequest{Extensions: outdatedExtensionCheck, SessionID: clientOutsideRollout}, extensionsMap)
+		if check[0].Version == "2.0.0" {
+			offered++
+		}
+	}
+	assert.InDelta(t, 50, offered, 40)
+
+	// Clients outside of the rollout already on the previous release get no update
+	currentExtensionCheck := Extensions{{ID: lightThemeExtension.ID, Version: "1.0.0"}}
+	check = ProcessExtensionRequests(&UpdateRequest{Extensions: currentExtensionCheck, UserID: clientOutsideRollout}, extensionsMap)
+	assert.Equal(t, "noupdate", check[0].Status)
+
+	// Completing the rollout offers the new version to everyone
+	lightThemeExtension.RolloutPercentage = 100
+	extensionsMap.Store(lightThemeExtension.ID, lightThemeExtension)
+	check = ProcessExtensionRequests(&UpdateRequest{Extensions: outdatedExtensionCheck, UserID: clientOutsideRollout}, extensionsMap)
+	assert.Equal(t, "2.0.0", check[0].Version)
+	check = ProcessExtensionRequests(&UpdateRequest{Extensions: outdatedExtensionCheck}, extensionsMap)
+	assert.Equal(t, "2.0.0", check[0].Version)
+
+	// Halted rollouts offer the previous release to everyone
+	lightThemeExtension.RolloutPercentage = 0
+	extensionsMap.Store(lightThemeExtension.ID, lightThemeExtension)
+	check = ProcessExtensionRequests(&UpdateRequest{Extensions: outdatedExtensionCheck}, extensionsMap)
+	assert.Equal(t, "1.0.0", check[0].Version)
+
+	lightThemeExtension.RolloutPercentage = 0
+	lightThemeExtension.PreviousRelease = nil
+	extensionsMap.Store(lightThemeExtension.ID, lightThemeExtension)
+	check = ProcessExtensionRequests(&UpdateRequest{Extensions: outdatedExtensionCheck}, extensionsMap)
+	assert.Equal(t, "2.0.0", check[0].Version)
+}
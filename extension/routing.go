@@ -0,0 +1,185 @@
+package extension
+
+import (
+	"context"
+	"encoding/json/v2"
+	"fmt"
+	"path"
+	"sync"
+	"sync/atomic"
+)
+
+// WidevineExtensionID is the ID of the Widevine CDM component, which is updated
+// by Google's update servers
+const WidevineExtensionID = "oimompecagnajdejgnnjijobebaeigek"
+
+// Routing actions
+const (
+	// RouteLocal serves the extension from the catalog, even if it is missing
+	RouteLocal = "local"
+	// RouteRedirect redirects requests for the extension alone to the upstream
+	// updater. The extension is proxied within requests for other extensions
+	// too when proxying is enabled, or served from the catalog otherwise.
+	RouteRedirect = "redirect"
+	// RouteProxy always forwards the extension to the upstream updater
+	RouteProxy = "proxy"
+	// RouteDeny never serves the extension, answering with a restricted status
+	RouteDeny = "deny"
+)
+
+// RoutingRule routes the extensions whose ID matches AppID, a pattern as used by
+// path.Match, and which are checked by UpdaterType. Empty fields match everything.
+type RoutingRule struct {
+	AppID       string `json:"AppID,omitempty"`
+	UpdaterType string `json:"UpdaterType,omitempty"`
+	Action      string `json:"Action"`
+
+	// Host is the upstream updater of redirected and proxied extensions, which
+	// defaults to the updater host of the updater type
+	Host string `json:"Host,omitempty"`
+
+	// DownloadHost replaces the host serving the packages of local extensions
+	DownloadHost string `json:"DownloadHost,omitempty"`
+}
+
+// Matches reports whether the rule applies to the extension checked by updaterType
+func (r RoutingRule) Matches(appID string, updaterType string) bool {
+	if r.UpdaterType != "" && r.UpdaterType != updaterType {
+		return false
+	}
+	if r.AppID == "" {
+		return true
+	}
+	matched, err := path.Match(r.AppID, appID)
+	return err == nil && matched
+}
+
+// UpstreamHost returns the host of the upstream updater for updaterType
+func (r RoutingRule) UpstreamHost(updaterType string) string {
+	if r.Host != "" {
+		return r.Host
+	}
+	return GetUpdaterHostByType(updaterType)
+}
+
+// RoutingTable decides how requests for each extension are handled. The first
+// matching rule applies. Extensions which no rule matches are served from the
+// catalog when they are in it, and redirected to their upstream updater otherwise.
+type RoutingTable struct {
+	Rules []RoutingRule
+}
+
+// Route returns the first rule matching the extension checked by updaterType, or
+// a rule for the default handling if none does
+func (t *RoutingTable) Route(appID string, updaterType string, inCatalog bool) RoutingRule {
+	for _, rule := range t.Rules {
+		if rule.Matches(appID, updaterType) {
+			return rule
+		}
+	}
+	if inCatalog {
+		return RoutingRule{Action: RouteLocal}
+	}
+	return RoutingRule{Action: RouteRedirect}
+}
+
+// DownloadHost returns the host serving the packages of the extension, or an
+// empty string if the default host serves them
+func (t *RoutingTable) DownloadHost(appID string) string {
+	for _, rule := range t.Rules {
+		if rule.DownloadHost != "" && rule.Action == RouteLocal && rule.Matches(appID, "") {
+			return rule.DownloadHost
+		}
+	}
+	return ""
+}
+
+// Validate checks that every rule has a supported action and a valid pattern
+func (t *RoutingTable) Validate() error {
+	for i, rule := range t.Rules {
+		switch rule.Action {
+		case RouteLocal, RouteRedirect, RouteProxy, RouteDeny:
+		default:
+			return fmt.Errorf("routing rule %d has unsupported Action %q", i, rule.Action)
+		}
+		if _, err := path.Match(rule.AppID, ""); err != nil {
+			return fmt.Errorf("routing rule %d has invalid AppID pattern %q: %w", i, rule.AppID, err)
+		}
+	}
+	return nil
+}
+
+// DefaultRoutingTable returns the routing table used unless one is configured:
+// Widevine is redirected to Google, and the Tor packages are downloaded from
+// their dedicated host.
+func DefaultRoutingTable() *RoutingTable {
+	table := &RoutingTable{
+		Rules: []RoutingRule{
+			{AppID: WidevineExtensionID, Action: RouteRedirect, Host: "update.googleapis.com"},
+		},
+	}
+	for _, id := range append(append([]string{}, TorClientExtensionIDs...), TorPluggableTransportsExtensionIDs...) {
+		table.Rules = append(table.Rules, RoutingRule{
+			AppID:        id,
+			Action:       RouteLocal,
+			DownloadHost: GetS3TorExtensionBucketHost(),
+		})
+	}
+	return table
+}
+
+var configuredRoutingTable atomic.Pointer[RoutingTable]
+
+// defaultRoutingTable is the default routing table, built once on first use
+var defaultRoutingTable = sync.OnceValue(DefaultRoutingTable)
+
+// CurrentRoutingTable returns the configured routing table, or the default one
+func CurrentRoutingTable() *RoutingTable {
+	if table := configuredRoutingTable.Load(); table != nil {
+		return table
+	}
+	return defaultRoutingTable()
+}
+
+// SetRoutingTable replaces the routing table. A nil table restores the default one.
+func SetRoutingTable(table *RoutingTable) {
+	configuredRoutingTable.Store(table)
+}
+
+// RoutingFile is a JSON or YAML file holding the list of rules of a routing table,
+// using the field names of RoutingRule. The file replaces the default rules.
+type RoutingFile struct {
+	path string
+}
+
+// NewRoutingFile creates a RoutingFile reading from path
+func NewRoutingFile(path string) *RoutingFile {
+	return &RoutingFile{path: path}
+}
+
+// Name returns the description of the file
+func (f *RoutingFile) Name() string {
+	return "file:" + f.path
+}
+
+// Load reads, parses and validates the routing file
+func (f *RoutingFile) Load() (*RoutingTable, error) {
+	data, err := readJSONOrYAMLFile(f.path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading routing file: %w", err)
+	}
+
+	table := &RoutingTable{}
+	if err := json.Unmarshal(data, &table.Rules); err != nil {
+		return nil, fmt.Errorf("error parsing routing file: %w", err)
+	}
+	if err := table.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid routing file: %w", err)
+	}
+	return table, nil
+}
+
+// Watch polls the routing file like FileCatalog.Watch
+func (f *RoutingFile) Watch(ctx context.Context, onChange func()) {
+	watchFile(ctx, f.path, onChange)
+}
@@ -0,0 +1,86 @@
+package extension
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoutingTableRoute(t *testing.T) {
+	table := &RoutingTable{Rules: []RoutingRule{
+		{AppID: "aaaa*", UpdaterType: "chromiumcrx", Action: RouteDeny},
+		{AppID: "aaaa*", Action: RouteProxy, Host: "upstream.example.com"},
+		{AppID: "bbbbbbbb", Action: RouteLocal},
+	}}
+
+	assert.Equal(t, RouteDeny, table.Route("aaaa1234", "chromiumcrx", true).Action)
+	proxied := table.Route("aaaa1234", "BraveComponentUpdater", true)
+	assert.Equal(t, RouteProxy, proxied.Action)
+	assert.Equal(t, "upstream.example.com", proxied.UpstreamHost("BraveComponentUpdater"))
+	assert.Equal(t, RouteLocal, table.Route("bbbbbbbb", "", false).Action)
+
+	// Extensions no rule matches are served if they are in the catalog
+	assert.Equal(t, RouteLocal, table.Route("cccccccc", "chromiumcrx", true).Action)
+	redirected := table.Route("cccccccc", "chromiumcrx", false)
+	assert.Equal(t, RouteRedirect, redirected.Action)
+	assert.Equal(t, GetExtensionUpdaterHost(), redirected.UpstreamHost("chromiumcrx"))
+}
+
+func TestDefaultRoutingTable(t *testing.T) {
+	table := DefaultRoutingTable()
+	assert.Nil(t, table.Validate())
+
+	widevine := table.Route(WidevineExtensionID, "BraveComponentUpdater", false)
+	assert.Equal(t, RouteRedirect, widevine.Action)
+	assert.Equal(t, "update.googleapis.com", widevine.UpstreamHost("BraveComponentUpdater"))
+
+	assert.Equal(t, "tor.bravesoftware.com", table.DownloadHost(torClientMacExtensionID))
+	assert.Equal(t, "tor.bravesoftware.com", table.DownloadHost(torPluggableTransportsLinuxExtensionID))
+	assert.Equal(t, "", table.DownloadHost("ldimlcelhnjgpjjemdjokpgeeikdinbm"))
+
+	// The configured table replaces the default one
+	SetRoutingTable(&RoutingTable{Rules: []RoutingRule{
+		{AppID: "ldimlcelhnjgpjjemdjokpgeeikdinbm", Action: RouteLocal, DownloadHost: "cdn.example.com"},
+	}})
+	defer SetRoutingTable(nil)
+	assert.Equal(t, "cdn.example.com", GetS3ExtensionBucketHost("ldimlcelhnjgpjjemdjokpgeeikdinbm"))
+	assert.Equal(t, "brave-core-ext.s3.brave.com", GetS3ExtensionBucketHost(torClientMacExtensionID))
+
+	// The default table is built once
+	SetRoutingTable(nil)
+	assert.Same(t, CurrentRoutingTable(), CurrentRoutingTable())
+}
+
+func TestRoutingFile(t *testing.T) {
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "routing.yaml")
+	assert.Nil(t, os.WriteFile(path, []byte(`
+- AppID: "oimompecagnajdejgnnjijobebaeigek"
+  Action: redirect
+  Host: update.googleapis.com
+- AppID: "aaaa*"
+  UpdaterType: chromiumcrx
+  Action: deny
+`), 0o600))
+	table, err := NewRoutingFile(path).Load()
+	assert.Nil(t, err)
+	assert.Equal(t, []RoutingRule{
+		{AppID: WidevineExtensionID, Action: RouteRedirect, Host: "update.googleapis.com"},
+		{AppID: "aaaa*", UpdaterType: "chromiumcrx", Action: RouteDeny},
+	}, table.Rules)
+
+	path = filepath.Join(dir, "routing.json")
+	assert.Nil(t, os.WriteFile(path, []byte(`[{"AppID": "aaaa*", "Action": "drop"}]`), 0o600))
+	_, err = NewRoutingFile(path).Load()
+	assert.ErrorContains(t, err, `unsupported Action "drop"`)
+
+	assert.Nil(t, os.WriteFile(path, []byte(`[{"AppID": "[", "Action": "deny"}]`), 0o600))
+	_, err = NewRoutingFile(path).Load()
+	assert.ErrorContains(t, err, "invalid AppID pattern")
+
+	_, err = NewRoutingFile(filepath.Join(dir, "missing.json")).Load()
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,122 @@
+package extension
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultSignedURLTTL is how long signed download URLs are valid unless
+// DOWNLOAD_URL_TTL says otherwise
+const DefaultSignedURLTTL = time.Hour
+
+// URLSigner signs the download URLs of private packages so that they expire. The
+// Expires query parameter holds the Unix time the URL expires at, and Signature the
+// unpadded base64url HMAC-SHA256 of the host, path and expiry time, see Verify.
+type URLSigner struct {
+	key []byte
+	ttl time.Duration
+	now func() time.Time
+}
+
+// NewURLSigner creates a URLSigner signing with key URLs valid for ttl
+func NewURLSigner(key []byte, ttl time.Duration) *URLSigner {
+	return &URLSigner{key: key, ttl: ttl, now: time.Now}
+}
+
+// NewURLSignerFromEnv creates a URLSigner with the key read from the file named by
+// DOWNLOAD_URL_SIGNING_KEY_FILE, signing URLs valid for DOWNLOAD_URL_TTL (default 1h).
+// It returns nil if DOWNLOAD_URL_SIGNING_KEY_FILE is not set.
+func NewURLSignerFromEnv() (*URLSigner, error) {
+	path := os.Getenv("DOWNLOAD_URL_SIGNING_KEY_FILE")
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading download URL signing key: %w", err)
+	}
+	key := []byte(strings.TrimSpace(string(data)))
+	if len(key) == 0 {
+		return nil, fmt.Errorf("download URL signing key %s is empty", path)
+	}
+	ttl, err := time.ParseDuration(lookupEnvFallback("DOWNLOAD_URL_TTL", DefaultSignedURLTTL.String()))
+	if err != nil || ttl <= 0 {
+		return nil, fmt.Errorf("invalid DOWNLOAD_URL_TTL %q", os.Getenv("DOWNLOAD_URL_TTL"))
+	}
+	return NewURLSigner(key, ttl), nil
+}
+
+// signature returns the signature of the URL at host and path expiring at expires
+func (s *URLSigner) signature(host string, path string, expires string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(host + path + "\n" + expires))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Sign returns rawURL with the query parameters making it valid until the TTL of
+// the signer elapses. URLs which can't be parsed are returned as is.
+func (s *URLSigner) Sign(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	expires := strconv.FormatInt(s.now().Add(s.ttl).Unix(), 10)
+	query := parsed.Query()
+	query.Set("Expires", expires)
+	query.Set("Signature", s.signature(parsed.Host, parsed.Path, expires))
+	parsed.RawQuery = query.Encode()
+	return parsed.String()
+}
+
+// Verify checks that rawURL was signed by the signer and has not expired yet
+func (s *URLSigner) Verify(rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid URL: %w", err)
+	}
+	query := parsed.Query()
+	expires, err := strconv.ParseInt(query.Get("Expires"), 10, 64)
+	if err != nil {
+		return fmt.Errorf("missing or invalid Expires")
+	}
+	if s.now().Unix() > expires {
+		return fmt.Errorf("URL expired at %s", time.Unix(expires, 0).UTC().Format(time.RFC3339))
+	}
+	expected := s.signature(parsed.Host, parsed.Path, query.Get("Expires"))
+	if !hmac.Equal([]byte(expected), []byte(query.Get("Signature"))) {
+		return fmt.Errorf("invalid Signature")
+	}
+	return nil
+}
+
+var configuredURLSigner atomic.Pointer[URLSigner]
+
+// MissingSignerStatus is the status of update checks of extensions with SignedURLs
+// while no URLSigner is configured
+const MissingSignerStatus = "error-internal"
+
+// CanOfferURLs reports whether the download URLs of the extension may be offered.
+// Private packages are never offered with URLs which don't expire, so extensions
+// with SignedURLs can't be offered while no URLSigner is configured.
+func (e Extension) CanOfferURLs() bool {
+	return !e.SignedURLs || CurrentURLSigner() != nil
+}
+
+// CurrentURLSigner returns the signer of the download URLs of extensions with
+// SignedURLs, or nil if none is configured
+func CurrentURLSigner() *URLSigner {
+	return configuredURLSigner.Load()
+}
+
+// SetURLSigner replaces the signer of download URLs
+func SetURLSigner(signer *URLSigner) {
+	configuredURLSigner.Store(signer)
+}
@@ -0,0 +1,86 @@
+package extension
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestURLSigner(t *testing.T) {
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	signer := NewURLSigner([]byte("secret"), time.Hour)
+	signer.now = func() time.Time { return now }
+
+	signed := signer.Sign("https://cdn.example.com/release/aaaa/extension_1_0_0.crx")
+	assert.True(t, strings.HasPrefix(signed, "https://cdn.example.com/release/aaaa/extension_1_0_0.crx?Expires=1792242000&Signature="))
+	assert.Nil(t, signer.Verify(signed))
+
+	// Existing query parameters are kept
+	assert.Nil(t, signer.Verify(signer.Sign("https://cdn.example.com/aaaa.crx?v=1")))
+	assert.Contains(t, signer.Sign("https://cdn.example.com/aaaa.crx?v=1"), "&v=1")
+
+	// Other paths, hosts and keys don't match the signature
+	assert.ErrorContains(t, signer.Verify(strings.Replace(signed, "1_0_0", "1_0_1", 1)), "invalid Signature")
+	assert.ErrorContains(t, signer.Verify(strings.Replace(signed, "cdn.", "mirror.", 1)), "invalid Signature")
+	assert.ErrorContains(t, NewURLSigner([]byte("other"), time.Hour).Verify(signed), "invalid Signature")
+	assert.ErrorContains(t, signer.Verify("https://cdn.example.com/release/aaaa/extension_1_0_0.crx"), "missing or invalid Expires")
+
+	now = now.Add(time.Hour + time.Second)
+	assert.ErrorContains(t, signer.Verify(signed), "URL expired at 2026-10-17T13:00:00Z")
+}
+
+func TestNewURLSignerFromEnv(t *testing.T) {
+	t.Setenv("DOWNLOAD_URL_SIGNING_KEY_FILE", "")
+	signer, err := NewURLSignerFromEnv()
+	assert.Nil(t, err)
+	assert.Nil(t, signer)
+
+	keyPath := filepath.Join(t.TempDir(), "key")
+	assert.Nil(t, os.WriteFile(keyPath, []byte("secret\n"), 0600))
+	t.Setenv("DOWNLOAD_URL_SIGNING_KEY_FILE", keyPath)
+	t.Setenv("DOWNLOAD_URL_TTL", "15m")
+	signer, err = NewURLSignerFromEnv()
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("secret"), signer.key)
+	assert.Equal(t, time.Minute*15, signer.ttl)
+
+	t.Setenv("DOWNLOAD_URL_TTL", "soon")
+	_, err = NewURLSignerFromEnv()
+	assert.ErrorContains(t, err, "invalid DOWNLOAD_URL_TTL")
+
+	assert.Nil(t, os.WriteFile(keyPath, []byte("\n"), 0600))
+	_, err = NewURLSignerFromEnv()
+	assert.ErrorContains(t, err, "is empty")
+}
+
+func TestSignedExtensionURLs(t *testing.T) {
+	lightThemeExtension := OfferedExtensions[0]
+	lightThemeExtension.SignedURLs = true
+	extensionsMap := NewExtensionMap()
+	extensionsMap.StoreExtensions(&Extensions{lightThemeExtension})
+	updateRequest := &UpdateRequest{Extensions: Extensions{{ID: lightThemeExtension.ID, Version: "0.1.0"}}}
+
+	// Private packages are not offered without a signer
+	assert.Equal(t, "error-internal", ProcessExtensionRequests(updateRequest, extensionsMap)[0].Status)
+
+	signer := NewURLSigner([]byte("secret"), time.Hour)
+	SetURLSigner(signer)
+	defer SetURLSigner(nil)
+	processed := ProcessExtensionRequests(updateRequest, extensionsMap)[0]
+	assert.Equal(t, "", processed.Status)
+
+	urls := GetPackageURLs(processed)
+	assert.Equal(t, 1, len(urls))
+	assert.Contains(t, urls[0], "/extension_1_0_0.crx?Expires=")
+	assert.Nil(t, signer.Verify(urls[0]))
+	patchURLs := GetPatchFileURLs(processed, "abc.puff")
+	assert.Contains(t, patchURLs[0], "/abc.puff?Expires=")
+	assert.Nil(t, signer.Verify(patchURLs[0]))
+
+	// Public packages are never signed
+	assert.NotContains(t, GetPackageURLs(OfferedExtensions[0])[0], "Signature")
+}
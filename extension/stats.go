@@ -0,0 +1,217 @@
+package extension
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults of the stats aggregator of the server: 10 minute buckets over a day,
+// each counting at most 1000 extension versions
+const (
+	DefaultStatsBucketSize  = 10 * time.Minute
+	DefaultStatsBucketCount = 144
+	DefaultStatsMaxKeys     = 1000
+)
+
+// UnknownAppID is the app ID the stats of apps which aren't in the catalog are
+// counted under, so that made up app IDs can't push out the extensions served
+const UnknownAppID = "unknown"
+
+// UpdateStats counts the update checks and events of an extension version
+type UpdateStats struct {
+	UpdateChecks   int64 `json:"UpdateChecks"`
+	UpdatesOffered int64 `json:"UpdatesOffered"`
+	NoUpdate       int64 `json:"NoUpdate"`
+	Restricted     int64 `json:"Restricted"`
+	// Errors counts the update checks answered with an error status
+	Errors int64 `json:"Errors"`
+
+	// EventSuccesses and EventFailures count the install and update events
+	EventSuccesses int64 `json:"EventSuccesses"`
+	EventFailures  int64 `json:"EventFailures"`
+}
+
+func (s *UpdateStats) add(other *UpdateStats) {
+	s.UpdateChecks += other.UpdateChecks
+	s.UpdatesOffered += other.UpdatesOffered
+	s.NoUpdate += other.NoUpdate
+	s.Restricted += other.Restricted
+	s.Errors += other.Errors
+	s.EventSuccesses += other.EventSuccesses
+	s.EventFailures += other.EventFailures
+}
+
+// StatsKey identifies the extension version counted by UpdateStats. Version is
+// the version of the client.
+type StatsKey struct {
+	AppID   string `json:"AppID"`
+	Version string `json:"Version"`
+}
+
+// VersionStats holds the stats of an extension version
+type VersionStats struct {
+	StatsKey
+	UpdateStats
+}
+
+// StatsWindow holds the stats of the extension versions over a rolling window
+type StatsWindow struct {
+	Window string         `json:"Window"`
+	Stats  []VersionStats `json:"Stats"`
+	// Dropped counts the checks and events left out because buckets were full
+	Dropped int64 `json:"Dropped"`
+}
+
+type statsBucket struct {
+	start   time.Time
+	stats   map[StatsKey]*UpdateStats
+	dropped int64
+}
+
+// StatsAggregator counts update checks and events in memory, in time buckets
+// reused once they are older than the longest window. Each bucket holds at most
+// maxKeys extension versions and leaves out the checks and events of new ones
+// once full, which bounds the memory used.
+type StatsAggregator struct {
+	mutex      sync.Mutex
+	bucketSize time.Duration
+	maxKeys    int
+	buckets    []statsBucket
+	now        func() time.Time
+}
+
+// NewStatsAggregator creates a StatsAggregator keeping bucketCount buckets of
+// bucketSize, each holding at most maxKeys extension versions
+func NewStatsAggregator(bucketSize time.Duration, bucketCount int, maxKeys int) *StatsAggregator {
+	return &StatsAggregator{
+		bucketSize: bucketSize,
+		maxKeys:    maxKeys,
+		buckets:    make([]statsBucket, bucketCount),
+		now:        time.Now,
+	}
+}
+
+// record applies update to the stats of the extension version in the current bucket
+func (a *StatsAggregator) record(appID string, version string, update func(*UpdateStats)) {
+	start := a.now().Truncate(a.bucketSize)
+	bucket := &a.buckets[int(start.UnixNano()/int64(a.bucketSize))%len(a.buckets)]
+	if !bucket.start.Equal(start) {
+		*bucket = statsBucket{start: start, stats: map[StatsKey]*UpdateStats{}}
+	}
+
+	key := StatsKey{AppID: appID, Version: version}
+	stats, ok := bucket.stats[key]
+	if !ok {
+		if len(bucket.stats) >= a.maxKeys {
+			bucket.dropped++
+			return
+		}
+		stats = &UpdateStats{}
+		bucket.stats[key] = stats
+	}
+	update(stats)
+}
+
+// RecordUpdateCheck counts an update check of the extension by a client on
+// version, answered with status as returned by GetUpdateStatus
+func (a *StatsAggregator) RecordUpdateCheck(appID string, version string, status string) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.record(appID, version, func(stats *UpdateStats) {
+		stats.UpdateChecks++
+		switch status {
+		case "ok":
+			stats.UpdatesOffered++
+		case "noupdate":
+			stats.NoUpdate++
+		case "restricted":
+			stats.Restricted++
+		default:
+			stats.Errors++
+		}
+	})
+}
+
+// Name returns the description of the aggregator as an EventSink
+func (a *StatsAggregator) Name() string {
+	return "stats"
+}
+
+// Record counts the successes and failures of install and update events
+func (a *StatsAggregator) Record(_ context.Context, events []Event) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	for _, event := range events {
+		if event.EventType != EventTypeInstall && event.EventType != EventTypeUpdate {
+			continue
+		}
+		if !event.Succeeded() && event.EventResult != EventResultError {
+			continue
+		}
+		a.record(event.AppID, event.AppVersion, func(stats *UpdateStats) {
+			if event.Succeeded() {
+				stats.EventSuccesses++
+			} else {
+				stats.EventFailures++
+			}
+		})
+	}
+	return nil
+}
+
+// Window returns the stats of the last window, rounded up to whole buckets and
+// limited to the buckets kept
+func (a *StatsAggregator) Window(window time.Duration) StatsWindow {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	since := a.now().Add(-window)
+	totals := map[StatsKey]*UpdateStats{}
+	result := StatsWindow{
+		Window: formatWindow(window),
+		Stats:  []VersionStats{},
+	}
+	for _, bucket := range a.buckets {
+		if bucket.stats == nil || !bucket.start.Add(a.bucketSize).After(since) {
+			continue
+		}
+		result.Dropped += bucket.dropped
+		for key, stats := range bucket.stats {
+			if totals[key] == nil {
+				totals[key] = &UpdateStats{}
+			}
+			totals[key].add(stats)
+		}
+	}
+
+	for key, stats := range totals {
+		result.Stats = append(result.Stats, VersionStats{StatsKey: key, UpdateStats: *stats})
+	}
+	sort.Slice(result.Stats, func(i, j int) bool {
+		a, b := result.Stats[i].StatsKey, result.Stats[j].StatsKey
+		if a.AppID != b.AppID {
+			return a.AppID < b.AppID
+		}
+		if comparison := CompareVersions(a.Version, b.Version); comparison != 0 {
+			return comparison < 0
+		}
+		return a.Version < b.Version
+	})
+	return result
+}
+
+// formatWindow formats a window like time.Duration.String without its zero
+// units, e.g. "24h" or "1h30m"
+func formatWindow(window time.Duration) string {
+	formatted := window.String()
+	if strings.HasSuffix(formatted, "m0s") {
+		formatted = strings.TrimSuffix(formatted, "0s")
+	}
+	if strings.HasSuffix(formatted, "h0m") {
+		formatted = strings.TrimSuffix(formatted, "0m")
+	}
+	return formatted
+}
@@ -0,0 +1,64 @@
+package extension
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatsAggregator(t *testing.T) {
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	aggregator := NewStatsAggregator(time.Hour, 24, 2)
+	aggregator.now = func() time.Time { return now }
+
+	aggregator.RecordUpdateCheck("aaaa", "1.0.0", "ok")
+	aggregator.RecordUpdateCheck("aaaa", "1.0.0", "noupdate")
+	aggregator.RecordUpdateCheck("bbbb", "2.0.0", "restricted")
+	// A third extension version doesn't fit in the bucket
+	aggregator.RecordUpdateCheck("cccc", "1.0.0", "ok")
+
+	now = now.Add(time.Hour * 2)
+	aggregator.RecordUpdateCheck("aaaa", "1.0.0", "error-unknownApplication")
+	assert.Nil(t, aggregator.Record(context.Background(), []Event{
+		{AppID: "aaaa", AppVersion: "1.0.0", EventType: EventTypeUpdate, EventResult: EventResultSuccess},
+		{AppID: "aaaa", AppVersion: "0.9.0", EventType: EventTypeUpdate, EventResult: EventResultError},
+		// Only the outcome of installs and updates is counted
+		{AppID: "aaaa", AppVersion: "1.0.0", EventType: EventTypeDownload, EventResult: EventResultError},
+		{AppID: "aaaa", AppVersion: "1.0.0", EventType: EventTypeUpdate, EventResult: EventResultCancelled},
+	}))
+
+	assert.Equal(t, StatsWindow{
+		Window: "1h",
+		Stats: []VersionStats{
+			{StatsKey: StatsKey{AppID: "aaaa", Version: "0.9.0"}, UpdateStats: UpdateStats{EventFailures: 1}},
+			{StatsKey: StatsKey{AppID: "aaaa", Version: "1.0.0"}, UpdateStats: UpdateStats{UpdateChecks: 1, Errors: 1, EventSuccesses: 1}},
+		},
+	}, aggregator.Window(time.Hour))
+
+	assert.Equal(t, StatsWindow{
+		Window: "24h",
+		Stats: []VersionStats{
+			{StatsKey: StatsKey{AppID: "aaaa", Version: "0.9.0"}, UpdateStats: UpdateStats{EventFailures: 1}},
+			{StatsKey: StatsKey{AppID: "aaaa", Version: "1.0.0"}, UpdateStats: UpdateStats{UpdateChecks: 3, UpdatesOffered: 1, NoUpdate: 1, Errors: 1, EventSuccesses: 1}},
+			{StatsKey: StatsKey{AppID: "bbbb", Version: "2.0.0"}, UpdateStats: UpdateStats{UpdateChecks: 1, Restricted: 1}},
+		},
+		Dropped: 1,
+	}, aggregator.Window(time.Hour*24))
+
+	// Buckets are reused once they fall out of the longest window
+	now = now.Add(time.Hour * 22)
+	aggregator.RecordUpdateCheck("bbbb", "2.0.0", "ok")
+	assert.Equal(t, StatsWindow{
+		Window: "24h",
+		Stats: []VersionStats{
+			{StatsKey: StatsKey{AppID: "aaaa", Version: "0.9.0"}, UpdateStats: UpdateStats{EventFailures: 1}},
+			{StatsKey: StatsKey{AppID: "aaaa", Version: "1.0.0"}, UpdateStats: UpdateStats{UpdateChecks: 1, Errors: 1, EventSuccesses: 1}},
+			{StatsKey: StatsKey{AppID: "bbbb", Version: "2.0.0"}, UpdateStats: UpdateStats{UpdateChecks: 1, UpdatesOffered: 1}},
+		},
+	}, aggregator.Window(time.Hour*24))
+
+	assert.Equal(t, "1h30m", aggregator.Window(time.Minute*90).Window)
+	assert.Equal(t, "10m", aggregator.Window(time.Minute*10).Window)
+}
@@ -2,6 +2,8 @@ package extension
 
 import (
 	"os"
+	"slices"
+	"strings"
 )
 
 var (
@@ -17,27 +19,13 @@ var (
 	torPluggableTransportsLinuxExtensionID   = "apfggiafobakjahnkchiecbomjgigkkn"
 )
 
-// TorClientExtensionIDs is used to add an exception to return the dedicated
-// proxy url for downloading the tor client crx
+// TorClientExtensionIDs and TorPluggableTransportsExtensionIDs are downloaded
+// from a dedicated host by the default routing table
 var (
 	TorClientExtensionIDs              = []string{torClientMacExtensionID, torClientWindowsExtensionID, torClientLinuxExtensionID, torClientLinuxArm64ExtensionID}
 	TorPluggableTransportsExtensionIDs = []string{torPluggableTransportsMacExtensionID, torPluggableTransportsWindowsExtensionID, torPluggableTransportsLinuxExtensionID}
 )
 
-func isTorExtension(id string) bool {
-	for _, torID := range TorClientExtensionIDs {
-		if torID == id {
-			return true
-		}
-	}
-	for _, torPtID := range TorPluggableTransportsExtensionIDs {
-		if torPtID == id {
-			return true
-		}
-	}
-	return false
-}
-
 func lookupEnvFallback(key, fallback string) string {
 	if value, ok := os.LookupEnv(key); ok {
 		return value
@@ -47,24 +35,125 @@ func lookupEnvFallback(key, fallback string) string {
 
 // GetS3ExtensionBucketHost returns the url to use for accessing crx files
 func GetS3ExtensionBucketHost(id string) string {
-	if isTorExtension(id) {
-		return GetS3TorExtensionBucketHost()
+	if host := CurrentRoutingTable().DownloadHost(id); host != "" {
+		return host
 	}
 
 	return lookupEnvFallback("S3_EXTENSIONS_BUCKET_HOST", "brave-core-ext.s3.brave.com")
 }
 
+// GetS3ExtensionBucketHosts returns the hosts to use for accessing crx files, in
+// the order clients try them. The mirrors listed in EXTENSIONS_MIRROR_HOSTS follow
+// the default host, but not the hosts the routing table replaces it with, which
+// they don't mirror.
+func GetS3ExtensionBucketHosts(id string) []string {
+	if host := CurrentRoutingTable().DownloadHost(id); host != "" {
+		return []string{host}
+	}
+
+	hosts := []string{GetS3ExtensionBucketHost(id)}
+	for _, host := range strings.Split(os.Getenv("EXTENSIONS_MIRROR_HOSTS"), ",") {
+		if host = strings.TrimSpace(host); host != "" && !slices.Contains(hosts, host) {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// GetDownloadHosts returns the hosts serving the packages of the extension, in the
+// order clients try them: its own DownloadHosts, or else the bucket hosts
+func GetDownloadHosts(extension Extension) []string {
+	if len(extension.DownloadHosts) > 0 {
+		return extension.DownloadHosts
+	}
+	return GetS3ExtensionBucketHosts(extension.ID)
+}
+
+// DefaultURLTemplate is the layout of packages on the download hosts
+const DefaultURLTemplate = "https://{host}/release/{id}/{name}"
+
+// GetPackageName returns the file name of the package offered by the extension,
+// its PackageName with {version} replaced, or extension_<version>.crx with the dots
+// of the version replaced by underscores
+func GetPackageName(extension Extension) string {
+	if extension.PackageName != "" {
+		return strings.ReplaceAll(extension.PackageName, "{version}", extension.Version)
+	}
+	return "extension_" + strings.ReplaceAll(extension.Version, ".", "_") + ".crx"
+}
+
+// signURLs signs the download URLs of extensions with SignedURLs. Extensions
+// whose URLs can't be signed must not be offered, see CanOfferURLs.
+func signURLs(extension Extension, urls []string) []string {
+	signer := CurrentURLSigner()
+	if !extension.SignedURLs || signer == nil {
+		return urls
+	}
+	for i, url := range urls {
+		urls[i] = signer.Sign(url)
+	}
+	return urls
+}
+
+// GetPackageURLs returns the URLs of the package offered by the extension, in the
+// order clients try them: its URL if set, or else its URLTemplate or the default
+// template filled in for every download host. They are signed for extensions
+// with SignedURLs.
+func GetPackageURLs(extension Extension) []string {
+	if extension.URL != "" {
+		return signURLs(extension, []string{extension.URL})
+	}
+	template := extension.URLTemplate
+	if template == "" {
+		template = DefaultURLTemplate
+	}
+	urls := []string{}
+	for _, host := range GetDownloadHosts(extension) {
+		urls = append(urls, strings.NewReplacer(
+			"{host}", host,
+			"{id}", extension.ID,
+			"{version}", extension.Version,
+			"{name}", GetPackageName(extension),
+		).Replace(template))
+	}
+	return signURLs(extension, urls)
+}
+
+// GetPatchURLs returns the URLs of the directory holding the patches to the package
+// offered by the extension, for every download host. Patches always follow the
+// default layout. Directories can't be signed, see GetPatchFileURLs.
+func GetPatchURLs(extension Extension) []string {
+	urls := []string{}
+	for _, host := range GetDownloadHosts(extension) {
+		urls = append(urls, "https://"+host+"/release/"+extension.ID+"/patches/"+extension.SHA256+"/")
+	}
+	return urls
+}
+
+// GetPatchFileURLs returns the URLs of the patch named name to the package offered
+// by the extension, for every download host. They are signed for extensions with
+// SignedURLs.
+func GetPatchFileURLs(extension Extension, name string) []string {
+	urls := GetPatchURLs(extension)
+	for i, url := range urls {
+		urls[i] = url + name
+	}
+	return signURLs(extension, urls)
+}
+
 // GetS3TorExtensionBucketHost returns the url to use for accessing tor client crx
 func GetS3TorExtensionBucketHost() string {
 	return lookupEnvFallback("S3_EXTENSIONS_BUCKET_HOST_TOR", "tor.bravesoftware.com")
 }
 
-// GetUpdateStatus returns the status of an update response for an extension
+// GetUpdateStatus determines the update status based on extension data
 func GetUpdateStatus(extension Extension) string {
-	if extension.Status == "" {
-		return "ok"
+	// Return the existing status if already set (indicates no update available or an error)
+	if extension.Status != "" {
+		return extension.Status
 	}
-	return extension.Status
+	// Unassigned status implies an available update
+	return "ok"
 }
 
 // GetComponentUpdaterHost returns the url to use for component updates (@updater=BraveComponentUpdater)
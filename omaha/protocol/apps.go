@@ -0,0 +1,284 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/json/jsontext"
+	"encoding/json/v2"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+)
+
+// RawApp is an app entry of an update request or response, kept exactly as it
+// was encoded so that it can be passed along without knowing all of its fields
+type RawApp struct {
+	ID   string
+	Data []byte
+}
+
+// FilterRequestApps returns the update request in body without the apps for which
+// keep returns false, leaving everything else as it was
+func FilterRequestApps(body []byte, contentType string, keep func(appID string) bool) ([]byte, error) {
+	if IsJSONContentType(contentType) {
+		start, end, err := findJSONApps(body, "request")
+		if err != nil || start < 0 {
+			return body, err
+		}
+		apps, err := parseJSONApps(body[start:end])
+		if err != nil {
+			return nil, err
+		}
+		kept := []jsontext.Value{}
+		for _, app := range apps {
+			if keep(app.ID) {
+				kept = append(kept, jsontext.Value(app.Data))
+			}
+		}
+		return replaceJSONApps(body, start, end, kept)
+	}
+
+	var filtered bytes.Buffer
+	last := 0
+	err := scanXMLApps(body, func(app RawApp, start int, end int) {
+		if !keep(app.ID) {
+			filtered.Write(body[last:start])
+			last = end
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	filtered.Write(body[last:])
+	return filtered.Bytes(), nil
+}
+
+// protocolAttr matches the protocol attribute of an XML start tag
+var protocolAttr = regexp.MustCompile(`(\sprotocol\s*=\s*["'])[^"']*(["'])`)
+
+// SetRequestProtocol returns the protocol v3 update request in body as a request of
+// protocol version. Fingerprints which protocol 3.0 sends on the package of an app
+// are copied to the app, where protocol 3.1 expects them.
+func SetRequestProtocol(body []byte, contentType string, version string) ([]byte, error) {
+	if IsJSONContentType(contentType) {
+		var envelope map[string]map[string]jsontext.Value
+		if err := json.Unmarshal(body, &envelope); err != nil {
+			return nil, fmt.Errorf("error parsing JSON: %v", err)
+		}
+		if envelope["request"] == nil {
+			return nil, fmt.Errorf("request object not found")
+		}
+		protocol, err := json.Marshal(version)
+		if err != nil {
+			return nil, err
+		}
+		envelope["request"]["protocol"] = protocol
+		return json.Marshal(envelope)
+	}
+
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	for {
+		start := int(dec.InputOffset())
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, fmt.Errorf("error parsing XML: %v", err)
+		}
+		if _, ok := tok.(xml.StartElement); ok {
+			end := int(dec.InputOffset())
+			tag := protocolAttr.ReplaceAll(body[start:end], []byte("${1}"+version+"${2}"))
+			body = slices.Concat(body[:start], tag, body[end:])
+			break
+		}
+	}
+
+	var updated bytes.Buffer
+	last := 0
+	err := scanXMLApps(body, func(app RawApp, start int, _ int) {
+		type Package struct {
+			FP string `xml:"fp,attr"`
+		}
+		var fps struct {
+			FP       string    `xml:"fp,attr"`
+			Packages []Package `xml:"packages>package"`
+		}
+		if xml.Unmarshal(app.Data, &fps) != nil || fps.FP != "" || len(fps.Packages) == 0 || fps.Packages[0].FP == "" {
+			return
+		}
+		at := start + len("<app")
+		updated.Write(body[last:at])
+		updated.WriteString(` fp="`)
+		_ = xml.EscapeText(&updated, []byte(fps.Packages[0].FP))
+		updated.WriteString(`"`)
+		last = at
+	})
+	if err != nil {
+		return nil, err
+	}
+	updated.Write(body[last:])
+	return updated.Bytes(), nil
+}
+
+// ResponseApps returns the app entries of the update response in body, which may
+// start with the safe JSON prefix
+func ResponseApps(body []byte, contentType string) ([]RawApp, error) {
+	if IsJSONContentType(contentType) {
+		body = bytes.TrimPrefix(bytes.TrimSpace(body), []byte(")]}'"))
+		start, end, err := findJSONApps(body, "response")
+		if err != nil || start < 0 {
+			return nil, err
+		}
+		return parseJSONApps(body[start:end])
+	}
+
+	var apps []RawApp
+	err := scanXMLApps(body, func(app RawApp, _ int, _ int) {
+		apps = append(apps, app)
+	})
+	return apps, err
+}
+
+// AppendResponseApps returns the update response in body with apps added after
+// its own app entries
+func AppendResponseApps(body []byte, contentType string, apps []RawApp) ([]byte, error) {
+	if len(apps) == 0 {
+		return body, nil
+	}
+
+	if IsJSONContentType(contentType) {
+		start, end, err := findJSONApps(body, "response")
+		if err != nil {
+			return nil, err
+		}
+		if start < 0 {
+			return nil, fmt.Errorf("response has no list of apps")
+		}
+		existing, err := parseJSONApps(body[start:end])
+		if err != nil {
+			return nil, err
+		}
+		merged := make([]jsontext.Value, 0, len(existing)+len(apps))
+		for _, app := range slices.Concat(existing, apps) {
+			merged = append(merged, jsontext.Value(app.Data))
+		}
+		return replaceJSONApps(body, start, end, merged)
+	}
+
+	closing := bytes.LastIndex(body, []byte("</response>"))
+	if closing < 0 {
+		return nil, fmt.Errorf("response element not found")
+	}
+	merged := make([]byte, 0, len(body)+len(apps)*256)
+	merged = append(merged, body[:closing]...)
+	for _, app := range apps {
+		merged = append(merged, app.Data...)
+	}
+	return append(merged, body[closing:]...), nil
+}
+
+// findJSONApps returns the offsets in body of the list of apps of the root object,
+// named "app" in protocol v3 and "apps" in protocol v4, or -1 if there is none
+func findJSONApps(body []byte, root string) (int, int, error) {
+	dec := jsontext.NewDecoder(bytes.NewReader(body))
+	if tok, err := dec.ReadToken(); err != nil || tok.Kind() != '{' {
+		return -1, -1, fmt.Errorf("error parsing JSON: expected an object")
+	}
+
+	inRoot := false
+	for {
+		switch dec.PeekKind() {
+		case '}':
+			return -1, -1, nil
+		case '"':
+		default:
+			return -1, -1, fmt.Errorf("error parsing JSON at offset %d", dec.InputOffset())
+		}
+
+		name, err := dec.ReadToken()
+		if err != nil {
+			return -1, -1, fmt.Errorf("error parsing JSON: %v", err)
+		}
+		switch {
+		case !inRoot && name.String() == root:
+			if tok, err := dec.ReadToken(); err != nil || tok.Kind() != '{' {
+				return -1, -1, fmt.Errorf("error parsing JSON: expected %q to be an object", root)
+			}
+			inRoot = true
+		case inRoot && (name.String() == "app" || name.String() == "apps"):
+			value, err := dec.ReadValue()
+			if err != nil {
+				return -1, -1, fmt.Errorf("error parsing JSON: %v", err)
+			}
+			end := int(dec.InputOffset())
+			return end - len(value), end, nil
+		default:
+			if err := dec.SkipValue(); err != nil {
+				return -1, -1, fmt.Errorf("error parsing JSON: %v", err)
+			}
+		}
+	}
+}
+
+func parseJSONApps(data []byte) ([]RawApp, error) {
+	var entries []jsontext.Value
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("error parsing JSON apps: %v", err)
+	}
+	apps := make([]RawApp, 0, len(entries))
+	for _, entry := range entries {
+		var app struct {
+			AppID string `json:"appid"`
+		}
+		if err := json.Unmarshal(entry, &app); err != nil {
+			return nil, fmt.Errorf("error parsing JSON app: %v", err)
+		}
+		apps = append(apps, RawApp{ID: app.AppID, Data: bytes.Clone(entry)})
+	}
+	return apps, nil
+}
+
+func replaceJSONApps(body []byte, start int, end int, apps []jsontext.Value) ([]byte, error) {
+	data, err := json.Marshal(apps)
+	if err != nil {
+		return nil, err
+	}
+	return slices.Concat(body[:start], data, body[end:]), nil
+}
+
+// scanXMLApps calls fn with every app element directly within the root element
+// of body, along with its offsets in body
+func scanXMLApps(body []byte, fn func(app RawApp, start int, end int)) error {
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	depth := 0
+	for {
+		start := int(dec.InputOffset())
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error parsing XML: %v", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if depth != 1 || t.Name.Local != "app" {
+				depth++
+				continue
+			}
+			if err := dec.Skip(); err != nil {
+				return fmt.Errorf("error parsing XML: %v", err)
+			}
+			end := int(dec.InputOffset())
+			app := RawApp{Data: bytes.Clone(body[start:end])}
+			for _, attr := range t.Attr {
+				if attr.Name.Local == "appid" {
+					app.ID = attr.Value
+				}
+			}
+			fn(app, start, end)
+		case xml.EndElement:
+			depth--
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package protocol
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterRequestApps(t *testing.T) {
+	keepB := func(appID string) bool { return appID == "b" }
+
+	// JSON requests keep every other field as is, for either protocol version,
+	// while the apps kept are compacted
+	v3 := []byte(`{"request":{"protocol":"3.1","@updater":"BraveComponentUpdater","app":[{"appid":"a","version":"1.0"},{"appid":"b","version":"2.0","updatecheck":{}}],"os":{"platform":"Mac OS X"}}}`)
+	filtered, err := FilterRequestApps(v3, "application/json", keepB)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"request":{"protocol":"3.1","@updater":"BraveComponentUpdater","app":[{"appid":"b","version":"2.0","updatecheck":{}}],"os":{"platform":"Mac OS X"}}}`, string(filtered))
+
+	v4 := []byte(`{"request": {"protocol": "4.0", "apps": [{"appid": "a"}, {"appid": "b", "cached_items": [{"sha256": "abc"}]}]}}`)
+	filtered, err = FilterRequestApps(v4, "application/json", keepB)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"request": {"protocol": "4.0", "apps": [{"appid":"b","cached_items":[{"sha256":"abc"}]}]}}`, string(filtered))
+
+	_, err = FilterRequestApps([]byte(`{"request":{"app":[{"appid":1}]}}`), "application/json", keepB)
+	assert.NotNil(t, err)
+
+	// XML requests drop the app elements, including their children
+	xmlRequest := []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<request protocol="3.1" updater="BraveComponentUpdater"><os platform="Linux"/><app appid="a" version="1.0"><updatecheck/></app><app appid="b" version="2.0"/></request>`)
+	filtered, err = FilterRequestApps(xmlRequest, "application/xml", keepB)
+	assert.Nil(t, err)
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
+<request protocol="3.1" updater="BraveComponentUpdater"><os platform="Linux"/><app appid="b" version="2.0"/></request>`, string(filtered))
+
+	_, err = FilterRequestApps([]byte(`<request><app appid="a">`), "application/xml", keepB)
+	assert.NotNil(t, err)
+}
+
+func TestSetRequestProtocol(t *testing.T) {
+	// XML requests move fingerprints of packages to their app
+	xmlRequest := []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<request protocol="3.0" updater="BraveComponentUpdater"><app appid="a" version="1.0"><updatecheck/><packages><package fp="a&amp;fp"/></packages></app><app appid="b" version="2.0"/><app appid="c" fp="c-fp"><packages><package fp="other"/></packages></app></request>`)
+	updated, err := SetRequestProtocol(xmlRequest, "application/xml", "3.1")
+	assert.Nil(t, err)
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
+<request protocol="3.1" updater="BraveComponentUpdater"><app fp="a&amp;fp" appid="a" version="1.0"><updatecheck/><packages><package fp="a&amp;fp"/></packages></app><app appid="b" version="2.0"/><app appid="c" fp="c-fp"><packages><package fp="other"/></packages></app></request>`, string(updated))
+
+	_, err = SetRequestProtocol([]byte(`<request protocol='3.0'><app appid="a">`), "application/xml", "3.1")
+	assert.NotNil(t, err)
+
+	updated, err = SetRequestProtocol([]byte(`{"request":{"protocol":"3.0","app":[{"appid":"a"}]}}`), "application/json", "3.1")
+	assert.Nil(t, err)
+	assert.Contains(t, string(updated), `"protocol":"3.1"`)
+	assert.Contains(t, string(updated), `"app":[{"appid":"a"}]`)
+
+	_, err = SetRequestProtocol([]byte(`{"response":{}}`), "application/json", "3.1")
+	assert.NotNil(t, err)
+}
+
+func TestResponseApps(t *testing.T) {
+	apps, err := ResponseApps([]byte(")]}'\n"+`{"response":{"protocol":"3.1","server":"prod","app":[{"appid":"a","status":"ok"},{"appid":"b","status":"error-unknownApplication"}]}}`), "application/json")
+	assert.Nil(t, err)
+	assert.Equal(t, []RawApp{
+		{ID: "a", Data: []byte(`{"appid":"a","status":"ok"}`)},
+		{ID: "b", Data: []byte(`{"appid":"b","status":"error-unknownApplication"}`)},
+	}, apps)
+
+	apps, err = ResponseApps([]byte(`{"response":{"protocol":"4.0","apps":[{"appid":"a","status":"ok"}]}}`), "application/json")
+	assert.Nil(t, err)
+	assert.Equal(t, []RawApp{{ID: "a", Data: []byte(`{"appid":"a","status":"ok"}`)}}, apps)
+
+	apps, err = ResponseApps([]byte(`<response protocol="3.1" server="prod">
+  <daystart elapsed_seconds="100"/>
+  <app appid="a" status="ok"><updatecheck status="noupdate"/></app>
+</response>`), "application/xml")
+	assert.Nil(t, err)
+	assert.Equal(t, []RawApp{{ID: "a", Data: []byte(`<app appid="a" status="ok"><updatecheck status="noupdate"/></app>`)}}, apps)
+
+	_, err = ResponseApps([]byte(`<html>`), "application/xml")
+	assert.NotNil(t, err)
+}
+
+func TestAppendResponseApps(t *testing.T) {
+	proxied := []RawApp{{ID: "b", Data: []byte(`{"appid":"b","status":"ok"}`)}}
+	merged, err := AppendResponseApps([]byte(`{"response":{"protocol":"3.1","server":"prod","app":[{"appid":"a","status":"ok"}]}}`), "application/json", proxied)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"response":{"protocol":"3.1","server":"prod","app":[{"appid":"a","status":"ok"},{"appid":"b","status":"ok"}]}}`, string(merged))
+
+	// Responses without apps of their own get the proxied apps only
+	merged, err = AppendResponseApps([]byte(`{"response":{"protocol":"4.0","apps":[]}}`), "application/json", proxied)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"response":{"protocol":"4.0","apps":[{"appid":"b","status":"ok"}]}}`, string(merged))
+
+	merged, err = AppendResponseApps([]byte(`<response protocol="3.1" server="prod"><app appid="a"></app></response>`), "application/xml",
+		[]RawApp{{ID: "b", Data: []byte(`<app appid="b"/>`)}})
+	assert.Nil(t, err)
+	assert.Equal(t, `<response protocol="3.1" server="prod"><app appid="a"></app><app appid="b"/></response>`, string(merged))
+
+	// Nothing to append leaves the response untouched
+	merged, err = AppendResponseApps([]byte(`not parsed`), "application/json", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "not parsed", string(merged))
+}
@@ -102,12 +102,13 @@ func AcceptsJSON(accept string) bool {
 	return false
 }
 
-// IsPingbackRequest checks if the request body is a pingback.
-// For now, it only checks JSON requests for an "events" field.
+// IsPingbackRequest checks if the request body is a pingback, that is a request
+// whose apps carry events: a non-empty "event" (3.x) or "events" (4.0) field in
+// JSON requests, or an <event> element of an <app> in XML requests.
 // Uses streaming token parsing for performance - avoids full unmarshal.
 func IsPingbackRequest(body []byte, contentType string) bool {
 	if !IsJSONContentType(contentType) {
-		return false
+		return isXMLPingbackRequest(body)
 	}
 
 	dec := jsontext.NewDecoder(bytes.NewReader(body))
@@ -118,15 +119,46 @@ func IsPingbackRequest(body []byte, contentType string) bool {
 			return false
 		}
 
-		if tok.Kind() == '"' && tok.String() == "events" {
-			val, err := dec.ReadValue()
-			if err != nil {
-				return false
-			}
-			// Check if events array has content (length > 2 means more than just "[]")
-			if len(val) > 2 {
+		if tok.Kind() != '"' || (tok.String() != "events" && tok.String() != "event") {
+			continue
+		}
+		// Only object names are fields, after which the object holds an odd number of tokens
+		kind, length := dec.StackIndex(dec.StackDepth())
+		if kind != '{' || length%2 == 0 {
+			continue
+		}
+		val, err := dec.ReadValue()
+		if err != nil {
+			return false
+		}
+		// Check if events array has content (length > 2 means more than just "[]")
+		if val.Kind() == '[' && len(val) > 2 {
+			return true
+		}
+	}
+}
+
+// isXMLPingbackRequest checks if an XML request has an <event> element within an <app>
+func isXMLPingbackRequest(body []byte) bool {
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	depth := 0
+	parent := ""
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return false
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			depth++
+			if depth == 3 && parent == "app" && t.Name.Local == "event" {
 				return true
 			}
+			if depth == 2 {
+				parent = t.Name.Local
+			}
+		case xml.EndElement:
+			depth--
 		}
 	}
 }
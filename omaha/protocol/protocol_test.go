@@ -197,6 +197,42 @@ func TestIsPingbackRequest(t *testing.T) {
 			contentType: "application/json; charset=utf-8",
 			want:        true,
 		},
+		{
+			name:        "Protocol 3 event field",
+			body:        []byte(`{"request":{"protocol":"3.1","app":[{"appid":"test-app-id","event":[{"eventtype":3,"eventresult":1}]}]}}`),
+			contentType: "application/json",
+			want:        true,
+		},
+		{
+			name:        "Events as a value rather than a field",
+			body:        []byte(`{"request":{"protocol":"3.1","@updater":"events","app":[{"appid":"event","version":"1.0.0"}]}}`),
+			contentType: "application/json",
+			want:        false,
+		},
+		{
+			name: "XML event",
+			body: []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<request protocol="3.1" updater="BraveComponentUpdater">
+  <os platform="Linux"/>
+  <app appid="test-app-id" version="1.0.1">
+    <event eventtype="3" eventresult="1" previousversion="1.0.0" nextversion="1.0.1"/>
+  </app>
+</request>`),
+			contentType: "application/xml",
+			want:        true,
+		},
+		{
+			name:        "XML update check",
+			body:        []byte(`<request protocol="3.1"><app appid="test-app-id" version="1.0.0"><updatecheck/></app></request>`),
+			contentType: "application/xml",
+			want:        false,
+		},
+		{
+			name:        "XML event outside of an app",
+			body:        []byte(`<request protocol="3.1"><event eventtype="3"/><app appid="test-app-id"/></request>`),
+			contentType: "application/xml",
+			want:        false,
+		},
 	}
 
 	for _, tt := range tests {
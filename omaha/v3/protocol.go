@@ -48,6 +48,14 @@ func (h *VersionedHandler) ParseRequest(data []byte, contentType string) (*exten
 		return req.UpdateRequest, nil
 	}
 
+	return ParseXMLRequest(data)
+}
+
+// ParseXMLRequest parses an XML update request, laid out as in protocol 3.0 if it
+// says so and as in protocol 3.1 otherwise
+func ParseXMLRequest(data []byte) (*extension.UpdateRequest, error) {
+	var req Request
+
 	// Set up XML decoder
 	decoder := xml.NewDecoder(strings.NewReader(string(data)))
 	var start xml.StartElement
@@ -77,7 +85,13 @@ func (h *VersionedHandler) FormatUpdateResponse(extensions extension.Extensions,
 		return response.MarshalJSON()
 	}
 
-	// XML response
+	return FormatXMLUpdateResponse(extensions)
+}
+
+// FormatXMLUpdateResponse formats a standard protocol 3.1 update response in XML
+func FormatXMLUpdateResponse(extensions extension.Extensions) ([]byte, error) {
+	response := UpdateResponse(extensions)
+
 	var buf strings.Builder
 	encoder := xml.NewEncoder(&buf)
 
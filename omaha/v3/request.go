@@ -14,6 +14,55 @@ type Request struct {
 	*extension.UpdateRequest
 }
 
+// pingEvent is an event object of a pingback
+type pingEvent struct {
+	EventType       int    `json:"eventtype" xml:"eventtype,attr"`
+	EventResult     int    `json:"eventresult" xml:"eventresult,attr"`
+	ErrorCode       int    `json:"errorcode" xml:"errorcode,attr"`
+	ExtraCode1      int    `json:"extracode1" xml:"extracode1,attr"`
+	PreviousVersion string `json:"previousversion" xml:"previousversion,attr"`
+	NextVersion     string `json:"nextversion" xml:"nextversion,attr"`
+	DownloadTimeMs  int64  `json:"download_time_ms" xml:"download_time_ms,attr"`
+	Downloaded      int64  `json:"downloaded" xml:"downloaded,attr"`
+	Total           int64  `json:"total" xml:"total,attr"`
+}
+
+// ping is the ping object of an app
+type ping struct {
+	R  *int `json:"r" xml:"r,attr"`
+	A  *int `json:"a" xml:"a,attr"`
+	RD *int `json:"rd" xml:"rd,attr"`
+	AD *int `json:"ad" xml:"ad,attr"`
+}
+
+// toPing returns the ping of an app, or nil if the app has no ping object
+func (p *ping) toPing() *extension.Ping {
+	if p == nil {
+		return nil
+	}
+	return &extension.Ping{RollCallDays: p.R, ActiveDays: p.A, RollCallDate: p.RD, ActiveDate: p.AD}
+}
+
+// appendEvents appends the events of an app to events
+func appendEvents(events []extension.Event, appID string, version string, appEvents []pingEvent) []extension.Event {
+	for _, event := range appEvents {
+		events = append(events, extension.Event{
+			AppID:           appID,
+			AppVersion:      version,
+			EventType:       event.EventType,
+			EventResult:     event.EventResult,
+			ErrorCode:       event.ErrorCode,
+			ExtraCode1:      event.ExtraCode1,
+			PreviousVersion: event.PreviousVersion,
+			NextVersion:     event.NextVersion,
+			DownloadTimeMs:  event.DownloadTimeMs,
+			Downloaded:      event.Downloaded,
+			Total:           event.Total,
+		})
+	}
+	return events
+}
+
 // UnmarshalJSON implements the json.Unmarshaler interface
 func (r *Request) UnmarshalJSON(b []byte) error {
 	type Package struct {
@@ -22,17 +71,44 @@ func (r *Request) UnmarshalJSON(b []byte) error {
 	type Packages struct {
 		Package []Package `json:"package"`
 	}
+	type UpdateCheck struct {
+		TargetVersionPrefix string `json:"targetversionprefix"`
+		RollbackAllowed     bool   `json:"rollback_allowed"`
+	}
 	type App struct {
-		AppID    string   `json:"appid"`
-		FP       string   `json:"fp"`
-		Version  string   `json:"version"`
-		Packages Packages `json:"packages"`
+		AppID       string      `json:"appid"`
+		FP          string      `json:"fp"`
+		Version     string      `json:"version"`
+		Packages    Packages    `json:"packages"`
+		UpdateCheck UpdateCheck `json:"updatecheck"`
+		Ping        *ping       `json:"ping"`
+		Event       []pingEvent `json:"event"`
+		Cohort      string      `json:"cohort"`
+		CohortHint  string      `json:"cohorthint"`
+		CohortName  string      `json:"cohortname"`
+		// Some clients send the events of protocol 4 instead
+		Events []pingEvent `json:"events"`
+	}
+	type OS struct {
+		Platform string `json:"platform"`
+		Arch     string `json:"arch"`
 	}
 	type RequestWrapper struct {
-		OS       string `json:"@os"`
-		Updater  string `json:"@updater"`
-		App      []App  `json:"app"`
-		Protocol string `json:"protocol" validate:"required"`
+		OS           string `json:"@os"`
+		Updater      string `json:"@updater"`
+		App          []App  `json:"app"`
+		Protocol     string `json:"protocol" validate:"required"`
+		AcceptFormat string `json:"acceptformat"`
+		SessionID    string `json:"sessionid"`
+		UserID       string `json:"userid"`
+		Arch         string `json:"arch"`
+		NaClArch     string `json:"nacl_arch"`
+		OSInfo       OS     `json:"os"`
+		// The version of the browser, as opposed to the version of the updater
+		ProdVersion string `json:"prodversion"`
+		// The browser's channel takes precedence over the updater's channel
+		ProdChannel    string `json:"prodchannel"`
+		UpdaterChannel string `json:"updaterchannel"`
 	}
 	type JSONRequest struct {
 		Request RequestWrapper `json:"request" validate:"required"`
@@ -51,7 +127,18 @@ func (r *Request) UnmarshalJSON(b []byte) error {
 
 	r.UpdateRequest = &extension.UpdateRequest{
 		UpdaterType: request.Request.Updater,
+		SessionID:   request.Request.SessionID,
+		UserID:      request.Request.UserID,
+		Channel:     request.Request.ProdChannel,
+		OS:          extension.NormalizeOS(request.Request.OS, request.Request.OSInfo.Platform),
+		Arch:        extension.NormalizeArch(request.Request.Arch, request.Request.OSInfo.Arch, request.Request.NaClArch),
 		Extensions:  extension.Extensions{},
+
+		BrowserVersion: request.Request.ProdVersion,
+		AcceptFormats:  extension.ParseAcceptFormats(request.Request.AcceptFormat),
+	}
+	if r.Channel == "" {
+		r.Channel = request.Request.UpdaterChannel
 	}
 
 	for _, app := range request.Request.App {
@@ -66,7 +153,17 @@ func (r *Request) UnmarshalJSON(b []byte) error {
 			ID:      app.AppID,
 			FP:      fp,
 			Version: app.Version,
+
+			TargetVersionPrefix: app.UpdateCheck.TargetVersionPrefix,
+			RollbackAllowed:     app.UpdateCheck.RollbackAllowed,
+			Ping:                app.Ping.toPing(),
+
+			Cohort:     app.Cohort,
+			CohortHint: app.CohortHint,
+			CohortName: app.CohortName,
 		})
+		r.Events = appendEvents(r.Events, app.AppID, app.Version, app.Event)
+		r.Events = appendEvents(r.Events, app.AppID, app.Version, app.Events)
 	}
 
 	return nil
@@ -76,22 +173,58 @@ func (r *Request) UnmarshalJSON(b []byte) error {
 func (r *Request) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 	// Common XML elements
 	type UpdateCheck struct {
-		XMLName xml.Name `xml:"updatecheck"`
+		XMLName             xml.Name `xml:"updatecheck"`
+		TargetVersionPrefix string   `xml:"targetversionprefix,attr"`
+		RollbackAllowed     bool     `xml:"rollback_allowed,attr"`
+	}
+	type OS struct {
+		Platform string `xml:"platform,attr"`
+		Arch     string `xml:"arch,attr"`
 	}
 
-	// Check request for protocol version and updater type
+	// Check request for protocol version, updater type and client information
 	var protocol string
 	var updaterType string
+	var sessionID string
+	var userID string
+	var prodChannel string
+	var updaterChannel string
+	var osName string
+	var arch string
+	var naclArch string
+	var prodVersion string
+	var acceptFormat string
 	for _, attr := range start.Attr {
-		if attr.Name.Local == "protocol" {
+		switch attr.Name.Local {
+		case "protocol":
 			protocol = attr.Value
-		} else if attr.Name.Local == "updater" {
+		case "updater":
 			updaterType = attr.Value
+		case "sessionid":
+			sessionID = attr.Value
+		case "userid":
+			userID = attr.Value
+		case "prodchannel":
+			prodChannel = attr.Value
+		case "updaterchannel":
+			updaterChannel = attr.Value
+		case "os":
+			osName = attr.Value
+		case "arch":
+			arch = attr.Value
+		case "nacl_arch":
+			naclArch = attr.Value
+		case "prodversion":
+			prodVersion = attr.Value
+		case "acceptformat":
+			acceptFormat = attr.Value
 		}
 	}
 
 	// Version-specific types
 	var apps []extension.Extension
+	var events []extension.Event
+	var osInfo OS
 
 	if protocol == "3.0" {
 		type Package struct {
@@ -106,13 +239,19 @@ func (r *Request) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 			XMLName     xml.Name `xml:"app"`
 			AppID       string   `xml:"appid,attr"`
 			UpdateCheck UpdateCheck
-			Version     string   `xml:"version,attr"`
-			Packages    Packages `xml:"packages"`
+			Version     string      `xml:"version,attr"`
+			Packages    Packages    `xml:"packages"`
+			Ping        *ping       `xml:"ping"`
+			Events      []pingEvent `xml:"event"`
+			Cohort      string      `xml:"cohort,attr"`
+			CohortHint  string      `xml:"cohorthint,attr"`
+			CohortName  string      `xml:"cohortname,attr"`
 		}
 		type RequestWrapper struct {
 			XMLName  xml.Name `xml:"request"`
 			App      []App    `xml:"app"`
 			Protocol string   `xml:"protocol,attr"`
+			OS       OS       `xml:"os"`
 		}
 
 		request := RequestWrapper{}
@@ -120,6 +259,7 @@ func (r *Request) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 		if err != nil {
 			return err
 		}
+		osInfo = request.OS
 
 		for _, app := range request.App {
 			fp := ""
@@ -130,7 +270,16 @@ func (r *Request) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 				ID:      app.AppID,
 				FP:      fp,
 				Version: app.Version,
+
+				TargetVersionPrefix: app.UpdateCheck.TargetVersionPrefix,
+				RollbackAllowed:     app.UpdateCheck.RollbackAllowed,
+				Ping:                app.Ping.toPing(),
+
+				Cohort:     app.Cohort,
+				CohortHint: app.CohortHint,
+				CohortName: app.CohortName,
 			})
+			events = appendEvents(events, app.AppID, app.Version, app.Events)
 		}
 	} else if protocol == "3.1" {
 		type App struct {
@@ -138,12 +287,18 @@ func (r *Request) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 			AppID       string   `xml:"appid,attr"`
 			FP          string   `xml:"fp,attr"`
 			UpdateCheck UpdateCheck
-			Version     string `xml:"version,attr"`
+			Version     string      `xml:"version,attr"`
+			Ping        *ping       `xml:"ping"`
+			Events      []pingEvent `xml:"event"`
+			Cohort      string      `xml:"cohort,attr"`
+			CohortHint  string      `xml:"cohorthint,attr"`
+			CohortName  string      `xml:"cohortname,attr"`
 		}
 		type RequestWrapper struct {
 			XMLName  xml.Name `xml:"request"`
 			App      []App    `xml:"app"`
 			Protocol string   `xml:"protocol,attr"`
+			OS       OS       `xml:"os"`
 		}
 
 		request := RequestWrapper{}
@@ -151,13 +306,23 @@ func (r *Request) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 		if err != nil {
 			return err
 		}
+		osInfo = request.OS
 
 		for _, app := range request.App {
 			apps = append(apps, extension.Extension{
 				ID:      app.AppID,
 				FP:      app.FP,
 				Version: app.Version,
+
+				TargetVersionPrefix: app.UpdateCheck.TargetVersionPrefix,
+				RollbackAllowed:     app.UpdateCheck.RollbackAllowed,
+				Ping:                app.Ping.toPing(),
+
+				Cohort:     app.Cohort,
+				CohortHint: app.CohortHint,
+				CohortName: app.CohortName,
 			})
+			events = appendEvents(events, app.AppID, app.Version, app.Events)
 		}
 	} else {
 		// Default to the simplest structure
@@ -166,12 +331,18 @@ func (r *Request) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 			AppID       string   `xml:"appid,attr"`
 			FP          string   `xml:"fp,attr"`
 			UpdateCheck UpdateCheck
-			Version     string `xml:"version,attr"`
+			Version     string      `xml:"version,attr"`
+			Ping        *ping       `xml:"ping"`
+			Events      []pingEvent `xml:"event"`
+			Cohort      string      `xml:"cohort,attr"`
+			CohortHint  string      `xml:"cohorthint,attr"`
+			CohortName  string      `xml:"cohortname,attr"`
 		}
 		type RequestWrapper struct {
 			XMLName  xml.Name `xml:"request"`
 			App      []App    `xml:"app"`
 			Protocol string   `xml:"protocol,attr"`
+			OS       OS       `xml:"os"`
 		}
 
 		request := RequestWrapper{}
@@ -179,19 +350,42 @@ func (r *Request) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 		if err != nil {
 			return err
 		}
+		osInfo = request.OS
 
 		for _, app := range request.App {
 			apps = append(apps, extension.Extension{
 				ID:      app.AppID,
 				FP:      app.FP,
 				Version: app.Version,
+
+				TargetVersionPrefix: app.UpdateCheck.TargetVersionPrefix,
+				RollbackAllowed:     app.UpdateCheck.RollbackAllowed,
+				Ping:                app.Ping.toPing(),
+
+				Cohort:     app.Cohort,
+				CohortHint: app.CohortHint,
+				CohortName: app.CohortName,
 			})
+			events = appendEvents(events, app.AppID, app.Version, app.Events)
 		}
 	}
 
 	r.UpdateRequest = &extension.UpdateRequest{
 		UpdaterType: updaterType,
+		SessionID:   sessionID,
+		UserID:      userID,
+		Channel:     prodChannel,
+		OS:          extension.NormalizeOS(osName, osInfo.Platform),
+		Arch:        extension.NormalizeArch(arch, osInfo.Arch, naclArch),
 		Extensions:  apps,
+		Events:      events,
+
+		BrowserVersion: prodVersion,
+		AcceptFormats:  extension.ParseAcceptFormats(acceptFormat),
+	}
+	// The browser's channel takes precedence over the updater's channel
+	if r.Channel == "" {
+		r.Channel = updaterChannel
 	}
 
 	return nil
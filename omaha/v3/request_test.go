@@ -6,6 +6,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/brave/go-update/extension"
 	"github.com/brave/go-update/extension/extensiontest"
 	"github.com/stretchr/testify/assert"
 )
@@ -43,6 +44,10 @@ func TestRequestUnmarshalJSON(t *testing.T) {
 	assert.Equal(t, 1, len(req.UpdateRequest.Extensions))
 	assert.Equal(t, onePasswordID, req.UpdateRequest.Extensions[0].ID)
 	assert.Equal(t, onePasswordVersion, req.UpdateRequest.Extensions[0].Version)
+	assert.Equal(t, "stable", req.UpdateRequest.Channel)
+	assert.Equal(t, "mac", req.UpdateRequest.OS)
+	assert.Equal(t, "x64", req.UpdateRequest.Arch)
+	assert.Equal(t, "53.0.2785.116", req.UpdateRequest.BrowserVersion)
 
 	pdfJSID := "jdbefljfgobbmcidnmpjamcbhnbphjnb"
 	pdfJSVersion := "1.0.0"
@@ -56,6 +61,80 @@ func TestRequestUnmarshalJSON(t *testing.T) {
 	assert.Equal(t, onePasswordVersion, req.UpdateRequest.Extensions[0].Version)
 	assert.Equal(t, pdfJSID, req.UpdateRequest.Extensions[1].ID)
 	assert.Equal(t, pdfJSVersion, req.UpdateRequest.Extensions[1].Version)
+	assert.Equal(t, "", req.UpdateRequest.SessionID)
+
+	// Client identifiers are kept for staged rollouts
+	data = []byte(`{"request":{"protocol":"3.1","sessionid":"{5a7e3f4c-6f0e-4d0b-9a3c-0d3e1c7c2b1a}","userid":"{0c4b8b5e-2d4f-4f7c-8f9d-3b2a1e0d9c8b}","app":[{"appid":"` + onePasswordID + `","version":"` + onePasswordVersion + `"}]}}`)
+	req = Request{}
+	err = json.Unmarshal(data, &req)
+	assert.Nil(t, err)
+	assert.Equal(t, "{5a7e3f4c-6f0e-4d0b-9a3c-0d3e1c7c2b1a}", req.UpdateRequest.SessionID)
+	assert.Equal(t, "{0c4b8b5e-2d4f-4f7c-8f9d-3b2a1e0d9c8b}", req.UpdateRequest.UserID)
+	assert.Equal(t, "{0c4b8b5e-2d4f-4f7c-8f9d-3b2a1e0d9c8b}", req.UpdateRequest.ClientID())
+
+	// The updater's channel is used when the browser's channel is missing
+	data = []byte(`{"request":{"protocol":"3.1","updaterchannel":"beta","app":[]}}`)
+	req = Request{}
+	err = json.Unmarshal(data, &req)
+	assert.Nil(t, err)
+	assert.Equal(t, "beta", req.UpdateRequest.Channel)
+
+	data = []byte(`{"request":{"protocol":"3.1","prodchannel":"nightly","updaterchannel":"beta","app":[]}}`)
+	req = Request{}
+	err = json.Unmarshal(data, &req)
+	assert.Nil(t, err)
+	assert.Equal(t, "nightly", req.UpdateRequest.Channel)
+
+	// The platform falls back to the os object and nacl_arch
+	data = []byte(`{"request":{"protocol":"3.1","os":{"platform":"Windows"},"nacl_arch":"x86-32","app":[]}}`)
+	req = Request{}
+	err = json.Unmarshal(data, &req)
+	assert.Nil(t, err)
+	assert.Equal(t, "win", req.UpdateRequest.OS)
+	assert.Equal(t, "x86", req.UpdateRequest.Arch)
+
+	// Version pinning is read from the app's updatecheck
+	data = []byte(`{"request":{"protocol":"3.1","app":[{"appid":"` + onePasswordID + `","version":"` + onePasswordVersion + `","updatecheck":{"targetversionprefix":"4.6.","rollback_allowed":true}}]}}`)
+	req = Request{}
+	err = json.Unmarshal(data, &req)
+	assert.Nil(t, err)
+	assert.Equal(t, "4.6.", req.UpdateRequest.Extensions[0].TargetVersionPrefix)
+	assert.True(t, req.UpdateRequest.Extensions[0].RollbackAllowed)
+
+	// Pings are kept for counting active clients
+	data = []byte(`{"request":{"protocol":"3.1","app":[{"appid":"` + onePasswordID + `","version":"` + onePasswordVersion + `","ping":{"rd":6283,"ad":6280,"ping_freshness":"{d6e1b5f3}"}},{"appid":"` + pdfJSID + `","version":"` + pdfJSVersion + `"}]}}`)
+	req = Request{}
+	err = json.Unmarshal(data, &req)
+	assert.Nil(t, err)
+	rollCallDate, activeDate := 6283, 6280
+	assert.Equal(t, &extension.Ping{RollCallDate: &rollCallDate, ActiveDate: &activeDate}, req.UpdateRequest.Extensions[0].Ping)
+	assert.Nil(t, req.UpdateRequest.Extensions[1].Ping)
+
+	// Cohorts are read from the app's attributes
+	data = []byte(`{"request":{"protocol":"3.1","app":[{"appid":"` + onePasswordID + `","version":"` + onePasswordVersion + `","cohort":"experiment","cohorthint":"opt-in","cohortname":"Experiment"}]}}`)
+	req = Request{}
+	err = json.Unmarshal(data, &req)
+	assert.Nil(t, err)
+	assert.Equal(t, "experiment", req.UpdateRequest.Extensions[0].Cohort)
+	assert.Equal(t, "opt-in", req.UpdateRequest.Extensions[0].CohortHint)
+	assert.Equal(t, "Experiment", req.UpdateRequest.Extensions[0].CohortName)
+
+	// Accepted formats are read from the request's acceptformat
+	data = []byte(`{"request":{"protocol":"3.1","acceptformat":"crx3,puff","app":[{"appid":"` + onePasswordID + `","version":"` + onePasswordVersion + `"}]}}`)
+	req = Request{}
+	err = json.Unmarshal(data, &req)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"crx3", "puff"}, req.UpdateRequest.AcceptFormats)
+
+	// Events of pingbacks are read from the app's event list
+	data = []byte(`{"request":{"protocol":"3.1","app":[{"appid":"` + onePasswordID + `","version":"` + onePasswordVersion + `","event":[{"eventtype":3,"eventresult":0,"errorcode":12,"extracode1":7,"previousversion":"4.7.0.89","nextversion":"` + onePasswordVersion + `"},{"eventtype":14,"eventresult":1,"download_time_ms":1200,"downloaded":1000,"total":1000}]}]}}`)
+	req = Request{}
+	err = json.Unmarshal(data, &req)
+	assert.Nil(t, err)
+	assert.Equal(t, []extension.Event{
+		{AppID: onePasswordID, AppVersion: onePasswordVersion, EventType: 3, EventResult: 0, ErrorCode: 12, ExtraCode1: 7, PreviousVersion: "4.7.0.89", NextVersion: onePasswordVersion},
+		{AppID: onePasswordID, AppVersion: onePasswordVersion, EventType: 14, EventResult: 1, DownloadTimeMs: 1200, Downloaded: 1000, Total: 1000},
+	}, req.UpdateRequest.Events)
 }
 
 func TestRequestUnmarshalXML(t *testing.T) {
@@ -103,6 +182,12 @@ func TestRequestUnmarshalXML(t *testing.T) {
 	assert.Equal(t, "1.0.0", req.UpdateRequest.Extensions[0].Version)
 	assert.Equal(t, "test-fingerprint", req.UpdateRequest.Extensions[0].FP)
 	assert.Equal(t, "chromiumcrx", req.UpdateRequest.UpdaterType)
+	assert.Equal(t, "stable", req.UpdateRequest.Channel)
+	assert.Equal(t, "mac", req.UpdateRequest.OS)
+	assert.Equal(t, "x64", req.UpdateRequest.Arch)
+	assert.Equal(t, "53.0.2785.116", req.UpdateRequest.BrowserVersion)
+	assert.Equal(t, "", req.UpdateRequest.Extensions[0].TargetVersionPrefix)
+	assert.False(t, req.UpdateRequest.Extensions[0].RollbackAllowed)
 
 	// Test v3.1 request
 	data = []byte(`<?xml version="1.0" encoding="UTF-8"?>
@@ -132,4 +217,71 @@ func TestRequestUnmarshalXML(t *testing.T) {
 	assert.Equal(t, "1.0.0", req.UpdateRequest.Extensions[0].Version)
 	assert.Equal(t, "test-fingerprint", req.UpdateRequest.Extensions[0].FP)
 	assert.Equal(t, "BraveComponentUpdater", req.UpdateRequest.UpdaterType)
+	assert.Equal(t, "", req.UpdateRequest.Extensions[0].TargetVersionPrefix)
+	assert.False(t, req.UpdateRequest.Extensions[0].RollbackAllowed)
+
+	// Client identifiers, the os element and version pinning are read from their attributes
+	data = []byte(`<?xml version="1.0" encoding="UTF-8"?>
+		<request protocol="3.1" updater="BraveComponentUpdater" version="chrome-53.0.2785.116" prodversion="53.0.2785.116" requestid="{b4f77b70-af29-462b-a637-8a3e4be5ecd9}" sessionid="{5a7e3f4c-6f0e-4d0b-9a3c-0d3e1c7c2b1a}" userid="{0c4b8b5e-2d4f-4f7c-8f9d-3b2a1e0d9c8b}" lang="" updaterchannel="stable" prodchannel="beta">
+		<os platform="Linux" version="6.1.0" arch="aarch64"/>
+		<app appid="test-app-id" version="1.0.0" fp="test-fingerprint">
+			<updatecheck targetversionprefix="1.0." rollback_allowed="true"/>
+		</app>
+		</request>`)
+
+	decoder = xml.NewDecoder(strings.NewReader(string(data)))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			t.Fatalf("Failed to get XML token: %v", err)
+		}
+		if se, ok := token.(xml.StartElement); ok {
+			start = se
+			break
+		}
+	}
+
+	req = Request{}
+	err = req.UnmarshalXML(decoder, start)
+	assert.Nil(t, err)
+	assert.Equal(t, "{5a7e3f4c-6f0e-4d0b-9a3c-0d3e1c7c2b1a}", req.UpdateRequest.SessionID)
+	assert.Equal(t, "{0c4b8b5e-2d4f-4f7c-8f9d-3b2a1e0d9c8b}", req.UpdateRequest.UserID)
+	assert.Equal(t, "beta", req.UpdateRequest.Channel)
+	assert.Equal(t, "linux", req.UpdateRequest.OS)
+	assert.Equal(t, "arm64", req.UpdateRequest.Arch)
+	assert.Equal(t, "1.0.", req.UpdateRequest.Extensions[0].TargetVersionPrefix)
+	assert.True(t, req.UpdateRequest.Extensions[0].RollbackAllowed)
+
+	// Events of pingbacks are read from the app's event elements
+	data = []byte(`<?xml version="1.0" encoding="UTF-8"?>
+		<request protocol="3.1" updater="BraveComponentUpdater" acceptformat="crx3,zucc">
+		<app appid="test-app-id" version="1.0.1" cohort="experiment" cohorthint="opt-in">
+			<ping r="1" a="-1"/>
+			<event eventtype="3" eventresult="1" previousversion="1.0.0" nextversion="1.0.1"/>
+		</app>
+		</request>`)
+
+	decoder = xml.NewDecoder(strings.NewReader(string(data)))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			t.Fatalf("Failed to get XML token: %v", err)
+		}
+		if se, ok := token.(xml.StartElement); ok {
+			start = se
+			break
+		}
+	}
+
+	req = Request{}
+	err = req.UnmarshalXML(decoder, start)
+	assert.Nil(t, err)
+	assert.Equal(t, []extension.Event{
+		{AppID: "test-app-id", AppVersion: "1.0.1", EventType: 3, EventResult: 1, PreviousVersion: "1.0.0", NextVersion: "1.0.1"},
+	}, req.UpdateRequest.Events)
+	rollCallDays, activeDays := 1, extension.PingNever
+	assert.Equal(t, &extension.Ping{RollCallDays: &rollCallDays, ActiveDays: &activeDays}, req.UpdateRequest.Extensions[0].Ping)
+	assert.Equal(t, []string{"crx3", "zucc"}, req.UpdateRequest.AcceptFormats)
+	assert.Equal(t, "experiment", req.UpdateRequest.Extensions[0].Cohort)
+	assert.Equal(t, "opt-in", req.UpdateRequest.Extensions[0].CohortHint)
 }
@@ -3,22 +3,41 @@ package v3
 import (
 	"encoding/json/v2"
 	"encoding/xml"
-	"strings"
+	"time"
 
 	"github.com/brave/go-update/extension"
 )
 
+// GetElapsedDays and GetElapsedSeconds return the daystart of responses, which
+// clients send back in the rd and ad values of their next pings
+var (
+	GetElapsedDays = func() int {
+		return extension.ElapsedDays(time.Now())
+	}
+	GetElapsedSeconds = func() int {
+		return extension.ElapsedSeconds(time.Now())
+	}
+)
+
 // UpdateResponse represents an Omaha v3 update response
 type UpdateResponse []extension.Extension
 
 // GetUpdateStatus determines the update status based on extension data
-func GetUpdateStatus(extension extension.Extension) string {
-	// Return the existing status if already set (indicates no update available or an error)
-	if extension.Status != "" {
-		return extension.Status
+func GetUpdateStatus(ext extension.Extension) string {
+	return extension.GetUpdateStatus(ext)
+}
+
+// getOfferedPatch returns the patch offered to the client along with the full
+// package, or nil if there is none. Clients get a single diff, the first one they
+// can apply, whether they send their fingerprint on the app (3.1) or on its
+// package (3.0). The patch directory of codebasediff can't carry a signature, so
+// signed packages are only offered in full.
+func getOfferedPatch(ext extension.Extension) *extension.PatchInfo {
+	patches := extension.GetPatches(ext)
+	if len(patches) == 0 || ext.SignedURLs {
+		return nil
 	}
-	// Unassigned status implies an available update
-	return "ok"
+	return patches[0]
 }
 
 // MarshalJSON encodes the extension list into response JSON
@@ -54,12 +73,20 @@ func (r *UpdateResponse) MarshalJSON() ([]byte, error) {
 	type App struct {
 		AppID       string      `json:"appid"`
 		Status      string      `json:"status"`
+		Cohort      string      `json:"cohort,omitempty"`
+		CohortHint  string      `json:"cohorthint,omitempty"`
+		CohortName  string      `json:"cohortname,omitempty"`
 		UpdateCheck UpdateCheck `json:"updatecheck"`
 	}
+	type DayStart struct {
+		ElapsedSeconds int `json:"elapsed_seconds"`
+		ElapsedDays    int `json:"elapsed_days"`
+	}
 	type ResponseWrapper struct {
-		Protocol string `json:"protocol"`
-		Server   string `json:"server"`
-		Apps     []App  `json:"app"`
+		Protocol string   `json:"protocol"`
+		Server   string   `json:"server"`
+		DayStart DayStart `json:"daystart"`
+		Apps     []App    `json:"app"`
 	}
 	type JSONResponse struct {
 		Response ResponseWrapper `json:"response"`
@@ -68,22 +95,22 @@ func (r *UpdateResponse) MarshalJSON() ([]byte, error) {
 	response := ResponseWrapper{}
 	response.Protocol = "3.1"
 	response.Server = "prod"
+	response.DayStart = DayStart{ElapsedSeconds: GetElapsedSeconds(), ElapsedDays: GetElapsedDays()}
 	for _, ext := range *r {
-		app := App{AppID: ext.ID, Status: "ok"}
-		patchInfo, pInfoFound := ext.PatchList[ext.FP]
+		app := App{AppID: ext.ID, Status: "ok", Cohort: ext.Cohort, CohortHint: ext.CohortHint, CohortName: ext.CohortName}
 		app.UpdateCheck = UpdateCheck{Status: GetUpdateStatus(ext)}
-		extensionName := "extension_" + strings.Replace(ext.Version, ".", "_", -1) + ".crx"
-		url := "https://" + extension.GetS3ExtensionBucketHost(ext.ID) + "/release/" + ext.ID + "/" + extensionName
-		diffURL := "https://" + extension.GetS3ExtensionBucketHost(ext.ID) + "/release/" + ext.ID + "/patches/" + ext.SHA256 + "/"
+		extensionName := extension.GetPackageName(ext)
 		if app.UpdateCheck.Status == "ok" {
 			if app.UpdateCheck.URLs == nil {
 				app.UpdateCheck.URLs = &URLs{
 					URLs: []URL{},
 				}
 			}
-			app.UpdateCheck.URLs.URLs = append(app.UpdateCheck.URLs.URLs, URL{
-				Codebase: url,
-			})
+			for _, url := range extension.GetPackageURLs(ext) {
+				app.UpdateCheck.URLs.URLs = append(app.UpdateCheck.URLs.URLs, URL{
+					Codebase: url,
+				})
+			}
 
 			app.UpdateCheck.Manifest = &Manifest{
 				Version: ext.Version,
@@ -96,11 +123,12 @@ func (r *UpdateResponse) MarshalJSON() ([]byte, error) {
 				Required: true,
 			}
 
-			// Only v3.1 supports diffs
-			if pInfoFound {
-				app.UpdateCheck.URLs.URLs = append(app.UpdateCheck.URLs.URLs, URL{
-					CodebaseDiff: diffURL,
-				})
+			if patchInfo := getOfferedPatch(ext); patchInfo != nil {
+				for _, diffURL := range extension.GetPatchURLs(ext) {
+					app.UpdateCheck.URLs.URLs = append(app.UpdateCheck.URLs.URLs, URL{
+						CodebaseDiff: diffURL,
+					})
+				}
 				pkg.NameDiff = patchInfo.Namediff
 				pkg.DiffSHA256 = patchInfo.Hashdiff
 				pkg.SizeDiff = patchInfo.Sizediff
@@ -120,18 +148,23 @@ func (r *UpdateResponse) MarshalJSON() ([]byte, error) {
 // MarshalXML encodes the extension list into response XML
 func (r *UpdateResponse) MarshalXML(e *xml.Encoder, _ xml.StartElement) error {
 	type URL struct {
-		XMLName  xml.Name `xml:"url"`
-		Codebase string   `xml:"codebase,attr"`
+		XMLName      xml.Name `xml:"url"`
+		Codebase     string   `xml:"codebase,attr,omitempty"`
+		CodebaseDiff string   `xml:"codebasediff,attr,omitempty"`
 	}
 	type URLs struct {
 		XMLName xml.Name `xml:"urls"`
 		URLs    []URL
 	}
 	type Package struct {
-		XMLName  xml.Name `xml:"package"`
-		Name     string   `xml:"name,attr"`
-		SHA256   string   `xml:"hash_sha256,attr"`
-		Required bool     `xml:"required,attr"`
+		XMLName    xml.Name `xml:"package"`
+		Name       string   `xml:"name,attr"`
+		NameDiff   string   `xml:"namediff,attr,omitempty"`
+		SizeDiff   int      `xml:"sizediff,attr,omitempty"`
+		FP         string   `xml:"fp,attr"`
+		SHA256     string   `xml:"hash_sha256,attr"`
+		DiffSHA256 string   `xml:"hashdiff_sha256,attr,omitempty"`
+		Required   bool     `xml:"required,attr"`
 	}
 	type Packages struct {
 		XMLName xml.Name `xml:"packages"`
@@ -151,39 +184,63 @@ func (r *UpdateResponse) MarshalXML(e *xml.Encoder, _ xml.StartElement) error {
 	type App struct {
 		XMLName     xml.Name `xml:"app"`
 		AppID       string   `xml:"appid,attr"`
+		Cohort      string   `xml:"cohort,attr,omitempty"`
+		CohortHint  string   `xml:"cohorthint,attr,omitempty"`
+		CohortName  string   `xml:"cohortname,attr,omitempty"`
 		UpdateCheck UpdateCheck
 	}
+	type DayStart struct {
+		XMLName        xml.Name `xml:"daystart"`
+		ElapsedSeconds int      `xml:"elapsed_seconds,attr"`
+		ElapsedDays    int      `xml:"elapsed_days,attr"`
+	}
 	type ResponseWrapper struct {
 		XMLName  xml.Name `xml:"response"`
 		Protocol string   `xml:"protocol,attr"`
 		Server   string   `xml:"server,attr"`
+		DayStart DayStart
 		Apps     []App
 	}
 	response := ResponseWrapper{}
 	response.Protocol = "3.1"
 	response.Server = "prod"
+	response.DayStart = DayStart{ElapsedSeconds: GetElapsedSeconds(), ElapsedDays: GetElapsedDays()}
 	for _, ext := range *r {
-		app := App{AppID: ext.ID}
+		app := App{AppID: ext.ID, Cohort: ext.Cohort, CohortHint: ext.CohortHint, CohortName: ext.CohortName}
 		app.UpdateCheck = UpdateCheck{Status: GetUpdateStatus(ext)}
-		extensionName := "extension_" + strings.Replace(ext.Version, ".", "_", -1) + ".crx"
-		url := "https://" + extension.GetS3ExtensionBucketHost(ext.ID) + "/release/" + ext.ID + "/" + extensionName
+		extensionName := extension.GetPackageName(ext)
 		if app.UpdateCheck.Status == "ok" {
 			if app.UpdateCheck.URLs == nil {
 				app.UpdateCheck.URLs = &URLs{
 					URLs: []URL{},
 				}
 			}
-			app.UpdateCheck.URLs.URLs = append(app.UpdateCheck.URLs.URLs, URL{
-				Codebase: url,
-			})
+			for _, url := range extension.GetPackageURLs(ext) {
+				app.UpdateCheck.URLs.URLs = append(app.UpdateCheck.URLs.URLs, URL{
+					Codebase: url,
+				})
+			}
 			app.UpdateCheck.Manifest = &Manifest{
 				Version: ext.Version,
 			}
 			pkg := Package{
 				Name:     extensionName,
 				SHA256:   ext.SHA256,
+				FP:       ext.SHA256,
 				Required: true,
 			}
+
+			if patchInfo := getOfferedPatch(ext); patchInfo != nil {
+				for _, diffURL := range extension.GetPatchURLs(ext) {
+					app.UpdateCheck.URLs.URLs = append(app.UpdateCheck.URLs.URLs, URL{
+						CodebaseDiff: diffURL,
+					})
+				}
+				pkg.NameDiff = patchInfo.Namediff
+				pkg.DiffSHA256 = patchInfo.Hashdiff
+				pkg.SizeDiff = patchInfo.Sizediff
+			}
+
 			app.UpdateCheck.Manifest.Packages.Package = append(app.UpdateCheck.Manifest.Packages.Package, pkg)
 		}
 		response.Apps = append(response.Apps, app)
@@ -200,19 +257,24 @@ type WebStoreResponse []extension.Extension
 func (r *WebStoreResponse) MarshalJSON() ([]byte, error) {
 	type UpdateCheck struct {
 		Status   string `json:"status"`
-		Codebase string `json:"codebase"`
-		Version  string `json:"version"`
-		SHA256   string `json:"hash_sha256"`
+		Codebase string `json:"codebase,omitempty"`
+		Version  string `json:"version,omitempty"`
+		SHA256   string `json:"hash_sha256,omitempty"`
 	}
 	type App struct {
 		AppID       string      `json:"appid"`
 		Status      string      `json:"status"`
 		UpdateCheck UpdateCheck `json:"updatecheck"`
 	}
+	type DayStart struct {
+		ElapsedSeconds int `json:"elapsed_seconds"`
+		ElapsedDays    int `json:"elapsed_days"`
+	}
 	type GUpdate struct {
-		Protocol string `json:"protocol"`
-		Server   string `json:"server"`
-		Apps     []App  `json:"app"`
+		Protocol string   `json:"protocol"`
+		Server   string   `json:"server"`
+		DayStart DayStart `json:"daystart"`
+		Apps     []App    `json:"app"`
 	}
 	type JSONGUpdate struct {
 		GUpdate GUpdate `json:"gupdate"`
@@ -220,18 +282,20 @@ func (r *WebStoreResponse) MarshalJSON() ([]byte, error) {
 	response := GUpdate{}
 	response.Protocol = "3.1"
 	response.Server = "prod"
+	response.DayStart = DayStart{ElapsedSeconds: GetElapsedSeconds(), ElapsedDays: GetElapsedDays()}
 
 	for _, ext := range *r {
-		extensionName := "extension_" + strings.Replace(ext.Version, ".", "_", -1) + ".crx"
 		app := App{
-			AppID:  ext.ID,
-			Status: "ok",
-			UpdateCheck: UpdateCheck{
-				Status:   "ok",
-				SHA256:   ext.SHA256,
-				Version:  ext.Version,
-				Codebase: "https://" + extension.GetS3ExtensionBucketHost(ext.ID) + "/release/" + ext.ID + "/" + extensionName,
-			},
+			AppID:       ext.ID,
+			Status:      "ok",
+			UpdateCheck: UpdateCheck{Status: GetUpdateStatus(ext)},
+		}
+		// Extensions which are not offered, e.g. restricted ones, only get their status
+		if app.UpdateCheck.Status == "ok" {
+			app.UpdateCheck.SHA256 = ext.SHA256
+			app.UpdateCheck.Version = ext.Version
+			// gupdate has a single codebase, so mirrors are left out
+			app.UpdateCheck.Codebase = extension.GetPackageURLs(ext)[0]
 		}
 		response.Apps = append(response.Apps, app)
 	}
@@ -246,9 +310,9 @@ func (r *WebStoreResponse) MarshalXML(e *xml.Encoder, _ xml.StartElement) error
 	type UpdateCheck struct {
 		XMLName  xml.Name `xml:"updatecheck"`
 		Status   string   `xml:"status,attr"`
-		Codebase string   `xml:"codebase,attr"`
-		Version  string   `xml:"version,attr"`
-		SHA256   string   `xml:"hash_sha256,attr"`
+		Codebase string   `xml:"codebase,attr,omitempty"`
+		Version  string   `xml:"version,attr,omitempty"`
+		SHA256   string   `xml:"hash_sha256,attr,omitempty"`
 	}
 	type App struct {
 		XMLName     xml.Name `xml:"app"`
@@ -256,27 +320,35 @@ func (r *WebStoreResponse) MarshalXML(e *xml.Encoder, _ xml.StartElement) error
 		Status      string   `xml:"status,attr"`
 		UpdateCheck UpdateCheck
 	}
+	type DayStart struct {
+		XMLName        xml.Name `xml:"daystart"`
+		ElapsedSeconds int      `xml:"elapsed_seconds,attr"`
+		ElapsedDays    int      `xml:"elapsed_days,attr"`
+	}
 	type GUpdate struct {
 		XMLName  xml.Name `xml:"gupdate"`
 		Protocol string   `xml:"protocol,attr"`
 		Server   string   `xml:"server,attr"`
+		DayStart DayStart
 		Apps     []App
 	}
 	response := GUpdate{}
 	response.Protocol = "3.1"
 	response.Server = "prod"
+	response.DayStart = DayStart{ElapsedSeconds: GetElapsedSeconds(), ElapsedDays: GetElapsedDays()}
 
 	for _, ext := range *r {
-		extensionName := "extension_" + strings.Replace(ext.Version, ".", "_", -1) + ".crx"
 		app := App{
-			AppID:  ext.ID,
-			Status: "ok",
-			UpdateCheck: UpdateCheck{
-				Status:   "ok",
-				SHA256:   ext.SHA256,
-				Version:  ext.Version,
-				Codebase: "https://" + extension.GetS3ExtensionBucketHost(ext.ID) + "/release/" + ext.ID + "/" + extensionName,
-			},
+			AppID:       ext.ID,
+			Status:      "ok",
+			UpdateCheck: UpdateCheck{Status: GetUpdateStatus(ext)},
+		}
+		// Extensions which are not offered, e.g. restricted ones, only get their status
+		if app.UpdateCheck.Status == "ok" {
+			app.UpdateCheck.SHA256 = ext.SHA256
+			app.UpdateCheck.Version = ext.Version
+			// gupdate has a single codebase, so mirrors are left out
+			app.UpdateCheck.Codebase = extension.GetPackageURLs(ext)[0]
 		}
 		response.Apps = append(response.Apps, app)
 	}
@@ -5,12 +5,17 @@ import (
 	"encoding/xml"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/brave/go-update/extension"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestResponseMarshalJSON(t *testing.T) {
+	// Set a constant daystart for consistent test output
+	GetElapsedDays = func() int { return 6284 }
+	GetElapsedSeconds = func() int { return 100 }
+
 	allExtensionsMap := extension.NewExtensionMap()
 	allExtensionsMap.StoreExtensions(&extension.OfferedExtensions)
 
@@ -85,6 +90,8 @@ func TestResponseMarshalJSON(t *testing.T) {
 	app := apps[0].(map[string]interface{})
 	assert.Equal(t, "bfdgpgibhagkpdlnjonhkabjoijopoge", app["appid"])
 	assert.Equal(t, "ok", app["status"])
+	_, hasCohort := app["cohort"]
+	assert.False(t, hasCohort, "Extensions without cohorts should not have a cohort")
 
 	updateCheck := app["updatecheck"].(map[string]interface{})
 	assert.Equal(t, "ok", updateCheck["status"])
@@ -132,9 +139,19 @@ func TestResponseMarshalJSON(t *testing.T) {
 	// Second app should be darkThemeExtension
 	app = apps[1].(map[string]interface{})
 	assert.Equal(t, "bfdgpgibhagkpdlnjonhkabjoijopoge", app["appid"])
+
+	// Assigned cohorts are returned in the app
+	updateResponse = UpdateResponse{{ID: "test-cohort-ext", Version: "1.0.0", Status: "noupdate", Cohort: "experiment", CohortHint: "opt-in"}}
+	jsonData, err = updateResponse.MarshalJSON()
+	assert.Nil(t, err)
+	assert.Contains(t, string(jsonData), `{"appid":"test-cohort-ext","status":"ok","cohort":"experiment","cohorthint":"opt-in","updatecheck":{"status":"noupdate"}}`)
 }
 
 func TestWebStoreResponseMarshalJSON(t *testing.T) {
+	// Set a constant daystart for consistent test output
+	GetElapsedDays = func() int { return 6284 }
+	GetElapsedSeconds = func() int { return 100 }
+
 	// Test WebStore response with realistic extensions
 	allExtensionsMap := extension.NewExtensionMap()
 	allExtensionsMap.StoreExtensions(&extension.OfferedExtensions)
@@ -146,7 +163,7 @@ func TestWebStoreResponseMarshalJSON(t *testing.T) {
 	updateResponse := WebStoreResponse{darkThemeExtension}
 	jsonData, err := updateResponse.MarshalJSON()
 	assert.Nil(t, err)
-	expectedOutput := `{"gupdate":{"protocol":"3.1","server":"prod","app":[{"appid":"bfdgpgibhagkpdlnjonhkabjoijopoge","status":"ok","updatecheck":{"status":"ok","codebase":"https://` + extension.GetS3ExtensionBucketHost(darkThemeExtension.ID) + `/release/bfdgpgibhagkpdlnjonhkabjoijopoge/extension_1_0_0.crx","version":"1.0.0","hash_sha256":"ae517d6273a4fc126961cb026e02946db4f9dbb58e3d9bc29f5e1270e3ce9834"}}]}}`
+	expectedOutput := `{"gupdate":{"protocol":"3.1","server":"prod","daystart":{"elapsed_seconds":100,"elapsed_days":6284},"app":[{"appid":"bfdgpgibhagkpdlnjonhkabjoijopoge","status":"ok","updatecheck":{"status":"ok","codebase":"https://` + extension.GetS3ExtensionBucketHost(darkThemeExtension.ID) + `/release/bfdgpgibhagkpdlnjonhkabjoijopoge/extension_1_0_0.crx","version":"1.0.0","hash_sha256":"ae517d6273a4fc126961cb026e02946db4f9dbb58e3d9bc29f5e1270e3ce9834"}}]}}`
 	assert.Equal(t, expectedOutput, string(jsonData))
 
 	darkThemeExtension, ok = allExtensionsMap.Load("bfdgpgibhagkpdlnjonhkabjoijopoge")
@@ -156,7 +173,7 @@ func TestWebStoreResponseMarshalJSON(t *testing.T) {
 	updateResponse = WebStoreResponse{darkThemeExtension}
 	jsonData, err = updateResponse.MarshalJSON()
 	assert.Nil(t, err)
-	expectedOutput = `{"gupdate":{"protocol":"3.1","server":"prod","app":[{"appid":"bfdgpgibhagkpdlnjonhkabjoijopoge","status":"ok","updatecheck":{"status":"ok","codebase":"https://` + extension.GetS3ExtensionBucketHost(darkThemeExtension.ID) + `/release/bfdgpgibhagkpdlnjonhkabjoijopoge/extension_1_0_0.crx","version":"1.0.0","hash_sha256":"ae517d6273a4fc126961cb026e02946db4f9dbb58e3d9bc29f5e1270e3ce9834"}}]}}`
+	expectedOutput = `{"gupdate":{"protocol":"3.1","server":"prod","daystart":{"elapsed_seconds":100,"elapsed_days":6284},"app":[{"appid":"bfdgpgibhagkpdlnjonhkabjoijopoge","status":"ok","updatecheck":{"status":"ok","codebase":"https://` + extension.GetS3ExtensionBucketHost(darkThemeExtension.ID) + `/release/bfdgpgibhagkpdlnjonhkabjoijopoge/extension_1_0_0.crx","version":"1.0.0","hash_sha256":"ae517d6273a4fc126961cb026e02946db4f9dbb58e3d9bc29f5e1270e3ce9834"}}]}}`
 	assert.Equal(t, expectedOutput, string(jsonData))
 
 	// Multiple extensions returns a multiple extension JSON webstore update
@@ -167,11 +184,32 @@ func TestWebStoreResponseMarshalJSON(t *testing.T) {
 	updateResponse = WebStoreResponse{lightThemeExtension, darkThemeExtension}
 	jsonData, err = updateResponse.MarshalJSON()
 	assert.Nil(t, err)
-	expectedOutput = `{"gupdate":{"protocol":"3.1","server":"prod","app":[{"appid":"ldimlcelhnjgpjjemdjokpgeeikdinbm","status":"ok","updatecheck":{"status":"ok","codebase":"https://` + extension.GetS3ExtensionBucketHost(lightThemeExtension.ID) + `/release/ldimlcelhnjgpjjemdjokpgeeikdinbm/extension_1_0_0.crx","version":"1.0.0","hash_sha256":"1c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618"}},{"appid":"bfdgpgibhagkpdlnjonhkabjoijopoge","status":"ok","updatecheck":{"status":"ok","codebase":"https://` + extension.GetS3ExtensionBucketHost(darkThemeExtension.ID) + `/release/bfdgpgibhagkpdlnjonhkabjoijopoge/extension_1_0_0.crx","version":"1.0.0","hash_sha256":"ae517d6273a4fc126961cb026e02946db4f9dbb58e3d9bc29f5e1270e3ce9834"}}]}}`
+	expectedOutput = `{"gupdate":{"protocol":"3.1","server":"prod","daystart":{"elapsed_seconds":100,"elapsed_days":6284},"app":[{"appid":"ldimlcelhnjgpjjemdjokpgeeikdinbm","status":"ok","updatecheck":{"status":"ok","codebase":"https://` + extension.GetS3ExtensionBucketHost(lightThemeExtension.ID) + `/release/ldimlcelhnjgpjjemdjokpgeeikdinbm/extension_1_0_0.crx","version":"1.0.0","hash_sha256":"1c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618"}},{"appid":"bfdgpgibhagkpdlnjonhkabjoijopoge","status":"ok","updatecheck":{"status":"ok","codebase":"https://` + extension.GetS3ExtensionBucketHost(darkThemeExtension.ID) + `/release/bfdgpgibhagkpdlnjonhkabjoijopoge/extension_1_0_0.crx","version":"1.0.0","hash_sha256":"ae517d6273a4fc126961cb026e02946db4f9dbb58e3d9bc29f5e1270e3ce9834"}}]}}`
+	assert.Equal(t, expectedOutput, string(jsonData))
+
+	// Extensions which are not offered only get their status
+	updateResponse = WebStoreResponse{{ID: "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Status: "restricted"}}
+	jsonData, err = updateResponse.MarshalJSON()
+	assert.Nil(t, err)
+	expectedOutput = `{"gupdate":{"protocol":"3.1","server":"prod","daystart":{"elapsed_seconds":100,"elapsed_days":6284},"app":[{"appid":"aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa","status":"ok","updatecheck":{"status":"restricted"}}]}}`
 	assert.Equal(t, expectedOutput, string(jsonData))
+
+	xmlData, err := xml.Marshal(&updateResponse)
+	assert.Nil(t, err)
+	expectedOutput = `<gupdate protocol="3.1" server="prod">
+    <daystart elapsed_seconds="100" elapsed_days="6284"></daystart>
+    <app appid="aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa" status="ok">
+        <updatecheck status="restricted"></updatecheck>
+    </app>
+</gupdate>`
+	assert.Equal(t, expectedOutput, string(xmlData))
 }
 
 func TestResponseMarshalXML(t *testing.T) {
+	// Set a constant daystart for consistent test output
+	GetElapsedDays = func() int { return 6284 }
+	GetElapsedSeconds = func() int { return 100 }
+
 	allExtensionsMap := extension.NewExtensionMap()
 	allExtensionsMap.StoreExtensions(&extension.OfferedExtensions)
 
@@ -183,7 +221,9 @@ func TestResponseMarshalXML(t *testing.T) {
 	assert.Nil(t, err)
 	encoder.Flush()
 	xmlData := buf.String()
-	expectedOutput := `<response protocol="3.1" server="prod"></response>`
+	expectedOutput := `<response protocol="3.1" server="prod">
+    <daystart elapsed_seconds="100" elapsed_days="6284"></daystart>
+</response>`
 	assert.Equal(t, expectedOutput, xmlData)
 
 	darkThemeExtension, ok := allExtensionsMap.Load("bfdgpgibhagkpdlnjonhkabjoijopoge")
@@ -198,6 +238,7 @@ func TestResponseMarshalXML(t *testing.T) {
 	encoder.Flush()
 	xmlData = buf.String()
 	expectedOutput = `<response protocol="3.1" server="prod">
+    <daystart elapsed_seconds="100" elapsed_days="6284"></daystart>
     <app appid="bfdgpgibhagkpdlnjonhkabjoijopoge">
         <updatecheck status="ok">
             <urls>
@@ -205,7 +246,7 @@ func TestResponseMarshalXML(t *testing.T) {
             </urls>
             <manifest version="1.0.0">
                 <packages>
-                    <package name="extension_1_0_0.crx" hash_sha256="ae517d6273a4fc126961cb026e02946db4f9dbb58e3d9bc29f5e1270e3ce9834" required="true"></package>
+                    <package name="extension_1_0_0.crx" fp="ae517d6273a4fc126961cb026e02946db4f9dbb58e3d9bc29f5e1270e3ce9834" hash_sha256="ae517d6273a4fc126961cb026e02946db4f9dbb58e3d9bc29f5e1270e3ce9834" required="true"></package>
                 </packages>
             </manifest>
         </updatecheck>
@@ -226,6 +267,7 @@ func TestResponseMarshalXML(t *testing.T) {
 	encoder.Flush()
 	xmlData = buf.String()
 	expectedOutput = `<response protocol="3.1" server="prod">
+    <daystart elapsed_seconds="100" elapsed_days="6284"></daystart>
     <app appid="ldimlcelhnjgpjjemdjokpgeeikdinbm">
         <updatecheck status="ok">
             <urls>
@@ -233,7 +275,7 @@ func TestResponseMarshalXML(t *testing.T) {
             </urls>
             <manifest version="1.0.0">
                 <packages>
-                    <package name="extension_1_0_0.crx" hash_sha256="1c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618" required="true"></package>
+                    <package name="extension_1_0_0.crx" fp="1c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618" hash_sha256="1c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618" required="true"></package>
                 </packages>
             </manifest>
         </updatecheck>
@@ -245,16 +287,168 @@ func TestResponseMarshalXML(t *testing.T) {
             </urls>
             <manifest version="1.0.0">
                 <packages>
-                    <package name="extension_1_0_0.crx" hash_sha256="ae517d6273a4fc126961cb026e02946db4f9dbb58e3d9bc29f5e1270e3ce9834" required="true"></package>
+                    <package name="extension_1_0_0.crx" fp="ae517d6273a4fc126961cb026e02946db4f9dbb58e3d9bc29f5e1270e3ce9834" hash_sha256="ae517d6273a4fc126961cb026e02946db4f9dbb58e3d9bc29f5e1270e3ce9834" required="true"></package>
                 </packages>
             </manifest>
         </updatecheck>
     </app>
 </response>`
 	assert.Equal(t, expectedOutput, xmlData)
+
+	// Assigned cohorts are returned in the app's attributes
+	updateResponse = UpdateResponse{{ID: "test-cohort-ext", Version: "1.0.0", Status: "noupdate", Cohort: "experiment", CohortName: "Experiment"}}
+	buf.Reset()
+	encoder = xml.NewEncoder(&buf)
+	err = updateResponse.MarshalXML(encoder, xml.StartElement{Name: xml.Name{Local: "response"}})
+	assert.Nil(t, err)
+	encoder.Flush()
+	expectedOutput = `<response protocol="3.1" server="prod">
+    <daystart elapsed_seconds="100" elapsed_days="6284"></daystart>
+    <app appid="test-cohort-ext" cohort="experiment" cohortname="Experiment">
+        <updatecheck status="noupdate"></updatecheck>
+    </app>
+</response>`
+	assert.Equal(t, expectedOutput, buf.String())
+}
+
+func TestResponseMarshalMirrors(t *testing.T) {
+	GetElapsedDays = func() int { return 6284 }
+	GetElapsedSeconds = func() int { return 100 }
+	t.Setenv("EXTENSIONS_MIRROR_HOSTS", "mirror.example.com")
+
+	updateResponse := UpdateResponse{{
+		ID:        "ldimlcelhnjgpjjemdjokpgeeikdinbm",
+		FP:        "old-sha256",
+		Version:   "1.0.0",
+		SHA256:    "new-sha256",
+		PatchList: map[string]*extension.PatchInfo{"old-sha256": {Hashdiff: "diff-sha256", Namediff: "old-sha256.puff", Sizediff: 100}},
+	}}
+	host := extension.GetS3ExtensionBucketHost("ldimlcelhnjgpjjemdjokpgeeikdinbm")
+
+	// Mirrors follow the default host, for full packages and then for diffs
+	jsonData, err := updateResponse.MarshalJSON()
+	assert.Nil(t, err)
+	assert.Contains(t, string(jsonData), `"urls":{"url":[`+
+		`{"codebase":"https://`+host+`/release/ldimlcelhnjgpjjemdjokpgeeikdinbm/extension_1_0_0.crx"},`+
+		`{"codebase":"https://mirror.example.com/release/ldimlcelhnjgpjjemdjokpgeeikdinbm/extension_1_0_0.crx"},`+
+		`{"codebasediff":"https://`+host+`/release/ldimlcelhnjgpjjemdjokpgeeikdinbm/patches/new-sha256/"},`+
+		`{"codebasediff":"https://mirror.example.com/release/ldimlcelhnjgpjjemdjokpgeeikdinbm/patches/new-sha256/"}]}`)
+
+	var buf strings.Builder
+	encoder := xml.NewEncoder(&buf)
+	err = updateResponse.MarshalXML(encoder, xml.StartElement{Name: xml.Name{Local: "response"}})
+	assert.Nil(t, err)
+	encoder.Flush()
+	assert.Contains(t, buf.String(), `            <urls>
+                <url codebase="https://`+host+`/release/ldimlcelhnjgpjjemdjokpgeeikdinbm/extension_1_0_0.crx"></url>
+                <url codebase="https://mirror.example.com/release/ldimlcelhnjgpjjemdjokpgeeikdinbm/extension_1_0_0.crx"></url>
+                <url codebasediff="https://`+host+`/release/ldimlcelhnjgpjjemdjokpgeeikdinbm/patches/new-sha256/"></url>
+                <url codebasediff="https://mirror.example.com/release/ldimlcelhnjgpjjemdjokpgeeikdinbm/patches/new-sha256/"></url>
+            </urls>`)
+
+	// Diffs in formats the client doesn't accept are left out
+	updateResponse[0].AcceptFormats = []string{"crx3", "zucc"}
+	jsonData, err = updateResponse.MarshalJSON()
+	assert.Nil(t, err)
+	assert.NotContains(t, string(jsonData), "codebasediff")
+	assert.NotContains(t, string(jsonData), "namediff")
+
+	// Clients listing only package formats get the diffs
+	updateResponse[0].AcceptFormats = []string{"crx2", "crx3"}
+	jsonData, err = updateResponse.MarshalJSON()
+	assert.Nil(t, err)
+	assert.Contains(t, string(jsonData), "codebasediff")
+	updateResponse[0].AcceptFormats = nil
+
+	// Signed packages are offered in full, with a signature per URL
+	extension.SetURLSigner(extension.NewURLSigner([]byte("secret"), time.Hour))
+	defer extension.SetURLSigner(nil)
+	updateResponse[0].SignedURLs = true
+	jsonData, err = updateResponse.MarshalJSON()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, strings.Count(string(jsonData), `extension_1_0_0.crx?Expires=`))
+	assert.NotContains(t, string(jsonData), "codebasediff")
+	assert.NotContains(t, string(jsonData), "namediff")
+}
+
+func TestResponseMarshalXMLDiff(t *testing.T) {
+	GetElapsedDays = func() int { return 6284 }
+	GetElapsedSeconds = func() int { return 100 }
+
+	lightThemeExtension := extension.OfferedExtensions[0]
+	lightThemeExtension.PatchList = map[string]*extension.PatchInfo{
+		"old-sha256": {Hashdiff: "diff-sha256", Namediff: "old-sha256.puff", Sizediff: 100},
+	}
+	extensionsMap := extension.NewExtensionMap()
+	extensionsMap.StoreExtensions(&extension.Extensions{lightThemeExtension})
+	host := extension.GetS3ExtensionBucketHost(lightThemeExtension.ID)
+	expectedOutput := `<response protocol="3.1" server="prod">
+    <daystart elapsed_seconds="100" elapsed_days="6284"></daystart>
+    <app appid="ldimlcelhnjgpjjemdjokpgeeikdinbm">
+        <updatecheck status="ok">
+            <urls>
+                <url codebase="https://` + host + `/release/ldimlcelhnjgpjjemdjokpgeeikdinbm/extension_1_0_0.crx"></url>
+                <url codebasediff="https://` + host + `/release/ldimlcelhnjgpjjemdjokpgeeikdinbm/patches/` + lightThemeExtension.SHA256 + `/"></url>
+            </urls>
+            <manifest version="1.0.0">
+                <packages>
+                    <package name="extension_1_0_0.crx" namediff="old-sha256.puff" sizediff="100" fp="` + lightThemeExtension.SHA256 + `" hash_sha256="` + lightThemeExtension.SHA256 + `" hashdiff_sha256="diff-sha256" required="true"></package>
+                </packages>
+            </manifest>
+        </updatecheck>
+    </app>
+</response>`
+
+	// Clients get the diff whether they send their fingerprint on the app (3.1)
+	// or on its package (3.0)
+	requests := map[string]string{
+		"3.0": `<request protocol="3.0"><app appid="ldimlcelhnjgpjjemdjokpgeeikdinbm" version="0.1.0"><updatecheck/><packages><package fp="old-sha256"/></packages></app></request>`,
+		"3.1": `<request protocol="3.1"><app appid="ldimlcelhnjgpjjemdjokpgeeikdinbm" version="0.1.0" fp="old-sha256"><updatecheck/></app></request>`,
+	}
+	for version, request := range requests {
+		handler, err := NewProtocol(version)
+		assert.Nil(t, err)
+		updateRequest, err := handler.ParseRequest([]byte(request), "application/xml")
+		assert.Nil(t, err)
+		xmlData, err := handler.FormatUpdateResponse(extension.ProcessExtensionRequests(updateRequest, extensionsMap), "application/xml")
+		assert.Nil(t, err)
+		assert.Equal(t, expectedOutput, string(xmlData), version)
+	}
+}
+
+func TestResponseMarshalPackageURL(t *testing.T) {
+	GetElapsedDays = func() int { return 6284 }
+	GetElapsedSeconds = func() int { return 100 }
+
+	ext := extension.Extension{
+		ID:          "ldimlcelhnjgpjjemdjokpgeeikdinbm",
+		Version:     "1.0.0",
+		SHA256:      "new-sha256",
+		URLTemplate: "https://{host}/components/{id}/{name}",
+		PackageName: "light-theme-{version}.crx",
+	}
+	host := extension.GetS3ExtensionBucketHost(ext.ID)
+
+	// Templates set the package name and URL
+	updateResponse := UpdateResponse{ext}
+	jsonData, err := updateResponse.MarshalJSON()
+	assert.Nil(t, err)
+	assert.Contains(t, string(jsonData), `"urls":{"url":[{"codebase":"https://`+host+`/components/ldimlcelhnjgpjjemdjokpgeeikdinbm/light-theme-1.0.0.crx"}]}`)
+	assert.Contains(t, string(jsonData), `"name":"light-theme-1.0.0.crx"`)
+
+	// Explicit URLs are used as is
+	ext.URL = "https://downloads.example.com/light-theme.crx"
+	webStoreResponse := WebStoreResponse{ext}
+	jsonData, err = webStoreResponse.MarshalJSON()
+	assert.Nil(t, err)
+	assert.Contains(t, string(jsonData), `"codebase":"https://downloads.example.com/light-theme.crx"`)
 }
 
 func TestWebStoreResponseMarshalXML(t *testing.T) {
+	// Set a constant daystart for consistent test output
+	GetElapsedDays = func() int { return 6284 }
+	GetElapsedSeconds = func() int { return 100 }
+
 	// No extensions returns blank update response
 	updateResponse := WebStoreResponse{}
 	allExtensionsMap := extension.NewExtensionMap()
@@ -266,7 +460,9 @@ func TestWebStoreResponseMarshalXML(t *testing.T) {
 	assert.Nil(t, err)
 	encoder.Flush()
 	xmlData := buf.String()
-	expectedOutput := `<gupdate protocol="3.1" server="prod"></gupdate>`
+	expectedOutput := `<gupdate protocol="3.1" server="prod">
+    <daystart elapsed_seconds="100" elapsed_days="6284"></daystart>
+</gupdate>`
 	assert.Equal(t, expectedOutput, xmlData)
 
 	darkThemeExtension, ok := allExtensionsMap.Load("bfdgpgibhagkpdlnjonhkabjoijopoge")
@@ -281,6 +477,7 @@ func TestWebStoreResponseMarshalXML(t *testing.T) {
 	encoder.Flush()
 	xmlData = buf.String()
 	expectedOutput = `<gupdate protocol="3.1" server="prod">
+    <daystart elapsed_seconds="100" elapsed_days="6284"></daystart>
     <app appid="bfdgpgibhagkpdlnjonhkabjoijopoge" status="ok">
         <updatecheck status="ok" codebase="https://` + extension.GetS3ExtensionBucketHost(darkThemeExtension.ID) + `/release/bfdgpgibhagkpdlnjonhkabjoijopoge/extension_1_0_0.crx" version="1.0.0" hash_sha256="ae517d6273a4fc126961cb026e02946db4f9dbb58e3d9bc29f5e1270e3ce9834"></updatecheck>
     </app>
@@ -300,6 +497,7 @@ func TestWebStoreResponseMarshalXML(t *testing.T) {
 	encoder.Flush()
 	xmlData = buf.String()
 	expectedOutput = `<gupdate protocol="3.1" server="prod">
+    <daystart elapsed_seconds="100" elapsed_days="6284"></daystart>
     <app appid="ldimlcelhnjgpjjemdjokpgeeikdinbm" status="ok">
         <updatecheck status="ok" codebase="https://` + extension.GetS3ExtensionBucketHost(lightThemeExtension.ID) + `/release/ldimlcelhnjgpjjemdjokpgeeikdinbm/extension_1_0_0.crx" version="1.0.0" hash_sha256="1c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618"></updatecheck>
     </app>
@@ -6,6 +6,7 @@ import (
 
 	"github.com/brave/go-update/extension"
 	"github.com/brave/go-update/omaha/protocol"
+	v3 "github.com/brave/go-update/omaha/v3"
 )
 
 // SupportedV4Versions is a list of v4.x protocol versions that are supported
@@ -32,10 +33,12 @@ func (h *VersionedHandler) GetVersion() string {
 	return h.version
 }
 
-// ParseRequest parses a request in the appropriate format (JSON or XML)
+// ParseRequest parses a request in the appropriate format (JSON or XML). Protocol
+// v4 is only specified in JSON, so XML requests are parsed as protocol 3.1 XML,
+// whose layout Omaha clients keep when they speak v4 over XML.
 func (h *VersionedHandler) ParseRequest(data []byte, contentType string) (*extension.UpdateRequest, error) {
-	if contentType != "application/json" {
-		return nil, fmt.Errorf("protocol v4 only supports JSON format")
+	if !protocol.IsJSONContentType(contentType) {
+		return v3.ParseXMLRequest(data)
 	}
 
 	var req Request
@@ -46,8 +49,12 @@ func (h *VersionedHandler) ParseRequest(data []byte, contentType string) (*exten
 	return req.UpdateRequest, nil
 }
 
-// FormatUpdateResponse formats a standard update response in the appropriate format based on content type
-func (h *VersionedHandler) FormatUpdateResponse(extensions extension.Extensions, _ string) ([]byte, error) {
+// FormatUpdateResponse formats a standard update response in the appropriate format
+// based on content type. XML responses are downgraded to protocol 3.1, see ParseRequest.
+func (h *VersionedHandler) FormatUpdateResponse(extensions extension.Extensions, contentType string) ([]byte, error) {
+	if !protocol.IsJSONContentType(contentType) {
+		return v3.FormatXMLUpdateResponse(extensions)
+	}
 	response := UpdateResponse(extensions)
 	return response.MarshalJSON()
 }
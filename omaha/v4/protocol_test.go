@@ -255,7 +255,7 @@ func TestProtocolHandler(t *testing.T) {
 		t.Fatalf("Failed to create protocol handler: %v", err)
 	}
 
-	// Test non-JSON content type rejection
+	// Test non-XML body with XML content type rejection
 	jsonData := []byte(`{
 		"request": {
 			"protocol": "4.0",
@@ -264,10 +264,22 @@ func TestProtocolHandler(t *testing.T) {
 	}`)
 	_, err = handler.ParseRequest(jsonData, "application/xml")
 	if err == nil {
-		t.Errorf("Expected error for non-JSON content type, got nil")
+		t.Errorf("Expected error for JSON body with XML content type, got nil")
 	}
-	if err != nil && err.Error() != "protocol v4 only supports JSON format" {
-		t.Errorf("Expected error message 'protocol v4 only supports JSON format', got '%s'", err.Error())
+
+	// Test XML request parsing, with the layout of protocol 3.1
+	xmlData := []byte(`<request protocol="4.0" updater="BraveComponentUpdater" acceptformat="crx3">
+		<app appid="test-app-id" version="1.0.0" fp="test-fingerprint"><updatecheck/></app>
+	</request>`)
+	xmlRequest, err := handler.ParseRequest(xmlData, "application/xml")
+	if err != nil {
+		t.Fatalf("Failed to parse XML request: %v", err)
+	}
+	if len(xmlRequest.Extensions) != 1 || xmlRequest.Extensions[0].ID != "test-app-id" || xmlRequest.Extensions[0].FP != "test-fingerprint" {
+		t.Errorf("Expected extension test-app-id with fingerprint test-fingerprint, got %+v", xmlRequest.Extensions)
+	}
+	if xmlRequest.UpdaterType != "BraveComponentUpdater" {
+		t.Errorf("Expected updater type 'BraveComponentUpdater', got '%s'", xmlRequest.UpdaterType)
 	}
 
 	// Test JSON request parsing
@@ -329,4 +341,13 @@ func TestProtocolHandler(t *testing.T) {
 	if _, ok := result["response"]; !ok {
 		t.Errorf("Expected 'response' field in JSON output")
 	}
+
+	// Test XML response formatting, downgraded to protocol 3.1
+	xmlResponse, err := handler.FormatUpdateResponse(extensions, "application/xml")
+	if err != nil {
+		t.Fatalf("Failed to format XML update response: %v", err)
+	}
+	if !strings.HasPrefix(string(xmlResponse), `<response protocol="3.1" server="prod">`) {
+		t.Errorf("Expected protocol 3.1 XML response, got '%s'", string(xmlResponse))
+	}
 }
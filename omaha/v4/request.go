@@ -3,6 +3,7 @@ package v4
 import (
 	"encoding/json/v2"
 	"fmt"
+	"slices"
 
 	"github.com/brave/go-update/extension"
 	"github.com/go-playground/validator/v10"
@@ -13,15 +14,58 @@ type Request struct {
 	*extension.UpdateRequest
 }
 
+// ping is the ping object of an app
+type ping struct {
+	R  *int `json:"r"`
+	A  *int `json:"a"`
+	RD *int `json:"rd"`
+	AD *int `json:"ad"`
+}
+
+// toPing returns the ping of an app, or nil if the app has no ping object
+func (p *ping) toPing() *extension.Ping {
+	if p == nil {
+		return nil
+	}
+	return &extension.Ping{RollCallDays: p.R, ActiveDays: p.A, RollCallDate: p.RD, ActiveDate: p.AD}
+}
+
+// pingEvent is an event object of a pingback
+type pingEvent struct {
+	EventType       int    `json:"eventtype"`
+	EventResult     int    `json:"eventresult"`
+	ErrorCode       int    `json:"errorcode"`
+	ExtraCode1      int    `json:"extracode1"`
+	PreviousVersion string `json:"previousversion"`
+	NextVersion     string `json:"nextversion"`
+	DownloadTimeMs  int64  `json:"download_time_ms"`
+	Downloaded      int64  `json:"downloaded"`
+	Total           int64  `json:"total"`
+}
+
 // UnmarshalJSON implements the json.Unmarshaler interface
 func (r *Request) UnmarshalJSON(b []byte) error {
 	type CachedItem struct {
 		SHA256 string `json:"sha256"`
 	}
+	type UpdateCheck struct {
+		TargetVersionPrefix string `json:"targetversionprefix"`
+		RollbackAllowed     bool   `json:"rollback_allowed"`
+	}
 	type App struct {
 		AppID       string       `json:"appid"`
 		Version     string       `json:"version"`
 		CachedItems []CachedItem `json:"cached_items"`
+		UpdateCheck UpdateCheck  `json:"updatecheck"`
+		Ping        *ping        `json:"ping"`
+		Events      []pingEvent  `json:"events"`
+		Cohort      string       `json:"cohort"`
+		CohortHint  string       `json:"cohorthint"`
+		CohortName  string       `json:"cohortname"`
+	}
+	type OS struct {
+		Platform string `json:"platform"`
+		Arch     string `json:"arch"`
 	}
 	type RequestWrapper struct {
 		OS           string `json:"@os"`
@@ -29,6 +73,16 @@ func (r *Request) UnmarshalJSON(b []byte) error {
 		Apps         []App  `json:"apps"`
 		Protocol     string `json:"protocol" validate:"required"`
 		AcceptFormat string `json:"acceptformat"`
+		SessionID    string `json:"sessionid"`
+		UserID       string `json:"userid"`
+		Arch         string `json:"arch"`
+		NaClArch     string `json:"nacl_arch"`
+		OSInfo       OS     `json:"os"`
+		// The version of the browser, as opposed to the version of the updater
+		ProdVersion string `json:"prodversion"`
+		// The browser's channel takes precedence over the updater's channel
+		ProdChannel    string `json:"prodchannel"`
+		UpdaterChannel string `json:"updaterchannel"`
 	}
 	type JSONRequest struct {
 		Request RequestWrapper `json:"request" validate:"required"`
@@ -47,19 +101,62 @@ func (r *Request) UnmarshalJSON(b []byte) error {
 
 	r.UpdateRequest = &extension.UpdateRequest{
 		UpdaterType: request.Request.Updater,
+		SessionID:   request.Request.SessionID,
+		UserID:      request.Request.UserID,
+		Channel:     request.Request.ProdChannel,
+		OS:          extension.NormalizeOS(request.Request.OS, request.Request.OSInfo.Platform),
+		Arch:        extension.NormalizeArch(request.Request.Arch, request.Request.OSInfo.Arch, request.Request.NaClArch),
 		Extensions:  extension.Extensions{},
+
+		BrowserVersion: request.Request.ProdVersion,
+		AcceptFormats:  extension.ParseAcceptFormats(request.Request.AcceptFormat),
+	}
+	if r.Channel == "" {
+		r.Channel = request.Request.UpdaterChannel
 	}
 
 	for _, app := range request.Request.Apps {
+		// The first cached item is the package the client runs
 		fp := ""
-		if len(app.CachedItems) > 0 {
-			fp = app.CachedItems[0].SHA256
+		var cachedFPs []string
+		for _, item := range app.CachedItems {
+			if item.SHA256 == "" || slices.Contains(cachedFPs, item.SHA256) {
+				continue
+			}
+			if fp == "" {
+				fp = item.SHA256
+			}
+			cachedFPs = append(cachedFPs, item.SHA256)
 		}
 		r.Extensions = append(r.Extensions, extension.Extension{
-			ID:      app.AppID,
-			FP:      fp,
-			Version: app.Version,
+			ID:        app.AppID,
+			FP:        fp,
+			CachedFPs: cachedFPs,
+			Version:   app.Version,
+
+			TargetVersionPrefix: app.UpdateCheck.TargetVersionPrefix,
+			RollbackAllowed:     app.UpdateCheck.RollbackAllowed,
+			Ping:                app.Ping.toPing(),
+
+			Cohort:     app.Cohort,
+			CohortHint: app.CohortHint,
+			CohortName: app.CohortName,
 		})
+		for _, event := range app.Events {
+			r.Events = append(r.Events, extension.Event{
+				AppID:           app.AppID,
+				AppVersion:      app.Version,
+				EventType:       event.EventType,
+				EventResult:     event.EventResult,
+				ErrorCode:       event.ErrorCode,
+				ExtraCode1:      event.ExtraCode1,
+				PreviousVersion: event.PreviousVersion,
+				NextVersion:     event.NextVersion,
+				DownloadTimeMs:  event.DownloadTimeMs,
+				Downloaded:      event.Downloaded,
+				Total:           event.Total,
+			})
+		}
 	}
 
 	return nil
@@ -4,6 +4,7 @@ import (
 	"encoding/json/v2"
 	"testing"
 
+	"github.com/brave/go-update/extension"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -35,12 +36,20 @@ func TestRequestUnmarshalJSON(t *testing.T) {
 		"request": {
 			"protocol": "4.0",
 			"@updater": "chromiumcrx",
+			"sessionid": "{b3296be1-ffae-4833-bcf0-31a6c4603ec6}",
+			"prodchannel": "nightly",
+			"updaterchannel": "stable",
+			"@os": "win",
+			"prodversion": "137.0.7115.0",
+			"os": { "platform": "Windows", "arch": "x86_64" },
 			"acceptformat": "download,xz,zucc,puff,crx3,run",
 			"apps": [
 				{
 					"appid": "test-v4-app-id",
 					"version": "2.0.0",
 					"cached_items": [
+						{ "sha256": "test-sha256-hash" },
+						{ "sha256": "older-sha256-hash" },
 						{ "sha256": "test-sha256-hash" }
 					],
 					"updatecheck": {}
@@ -55,7 +64,14 @@ func TestRequestUnmarshalJSON(t *testing.T) {
 	assert.Equal(t, "test-v4-app-id", req.UpdateRequest.Extensions[0].ID)
 	assert.Equal(t, "2.0.0", req.UpdateRequest.Extensions[0].Version)
 	assert.Equal(t, "test-sha256-hash", req.UpdateRequest.Extensions[0].FP)
+	assert.Equal(t, []string{"test-sha256-hash", "older-sha256-hash"}, req.UpdateRequest.Extensions[0].CachedFPs)
 	assert.Equal(t, "chromiumcrx", req.UpdateRequest.UpdaterType)
+	assert.Equal(t, "{b3296be1-ffae-4833-bcf0-31a6c4603ec6}", req.UpdateRequest.SessionID)
+	assert.Equal(t, "", req.UpdateRequest.ClientID())
+	assert.Equal(t, "nightly", req.UpdateRequest.Channel)
+	assert.Equal(t, "win", req.UpdateRequest.OS)
+	assert.Equal(t, "x64", req.UpdateRequest.Arch)
+	assert.Equal(t, "137.0.7115.0", req.UpdateRequest.BrowserVersion)
 
 	// Test v4.0 request with multiple apps
 	v4MultiAppRequestData := []byte(`{
@@ -117,4 +133,34 @@ func TestRequestUnmarshalJSON(t *testing.T) {
 	assert.Equal(t, "test-v4-app-id", req.UpdateRequest.Extensions[0].ID)
 	assert.Equal(t, "2.0.0", req.UpdateRequest.Extensions[0].Version)
 	assert.Equal(t, "", req.UpdateRequest.Extensions[0].FP)
+	assert.Equal(t, "", req.UpdateRequest.Extensions[0].TargetVersionPrefix)
+	assert.False(t, req.UpdateRequest.Extensions[0].RollbackAllowed)
+
+	// Version pinning is read from the app's updatecheck
+	v4VersionPinningData := []byte(`{"request":{"protocol":"4.0","apps":[{"appid":"test-v4-app-id","version":"2.0.0","updatecheck":{"targetversionprefix":"2.","rollback_allowed":true}}]}}`)
+	req = Request{}
+	err = json.Unmarshal(v4VersionPinningData, &req)
+	assert.Nil(t, err)
+	assert.Equal(t, "2.", req.UpdateRequest.Extensions[0].TargetVersionPrefix)
+	assert.True(t, req.UpdateRequest.Extensions[0].RollbackAllowed)
+
+	// Pings are kept for counting active clients, and cohorts are read from the app
+	v4PingData := []byte(`{"request":{"protocol":"4.0","acceptformat":"crx3,zucc,puff","apps":[{"appid":"test-v4-app-id","version":"2.0.0","ping":{"r":3,"a":3},"cohort":"experiment","cohorthint":"opt-in"}]}}`)
+	req = Request{}
+	err = json.Unmarshal(v4PingData, &req)
+	assert.Nil(t, err)
+	rollCallDays, activeDays := 3, 3
+	assert.Equal(t, &extension.Ping{RollCallDays: &rollCallDays, ActiveDays: &activeDays}, req.UpdateRequest.Extensions[0].Ping)
+	assert.Equal(t, "experiment", req.UpdateRequest.Extensions[0].Cohort)
+	assert.Equal(t, "opt-in", req.UpdateRequest.Extensions[0].CohortHint)
+	assert.Equal(t, []string{"crx3", "zucc", "puff"}, req.UpdateRequest.AcceptFormats)
+
+	// Events of pingbacks are read from the app's events
+	v4EventsData := []byte(`{"request":{"protocol":"4.0","apps":[{"appid":"test-v4-app-id","version":"2.0.0","events":[{"eventtype":2,"eventresult":0,"errorcode":3,"extracode1":1,"nextversion":"2.0.0","download_time_ms":50}]}]}}`)
+	req = Request{}
+	err = json.Unmarshal(v4EventsData, &req)
+	assert.Nil(t, err)
+	assert.Equal(t, []extension.Event{
+		{AppID: "test-v4-app-id", AppVersion: "2.0.0", EventType: 2, EventResult: 0, ErrorCode: 3, ExtraCode1: 1, NextVersion: "2.0.0", DownloadTimeMs: 50},
+	}, req.UpdateRequest.Events)
 }
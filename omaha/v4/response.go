@@ -3,7 +3,7 @@ package v4
 import (
 	"encoding/json/v2"
 	"fmt"
-	"strings"
+	"slices"
 	"time"
 
 	"github.com/brave/go-update/extension"
@@ -12,21 +12,41 @@ import (
 
 // GetElapsedDays calculates elapsed days since Jan 1, 2007
 var GetElapsedDays = func() int {
-	startDate := time.Date(2007, 1, 1, 0, 0, 0, 0, time.UTC)
-	return int(time.Now().UTC().Sub(startDate).Hours() / 24)
+	return extension.ElapsedDays(time.Now())
 }
 
 // UpdateResponse represents an Omaha v4 update response
 type UpdateResponse []extension.Extension
 
 // GetUpdateStatus determines the update status based on extension data
-func GetUpdateStatus(extension extension.Extension) string {
-	// Return the existing status if already set (indicates no update available or an error)
-	if extension.Status != "" {
-		return extension.Status
+func GetUpdateStatus(ext extension.Extension) string {
+	return extension.GetUpdateStatus(ext)
+}
+
+// pipelineFormats lists the patch formats which Chromium applies as operations of
+// v4 pipelines, from the most to the least preferred. Patches in other formats are
+// only offered by v3 responses.
+var pipelineFormats = []string{extension.PatchFormatZucchini, extension.PatchFormatPuff}
+
+// getPipelinePatches returns the patches of the client offered as diff pipelines,
+// see extension.GetCachedPatches, in the order of pipelineFormats. The acceptformat
+// of the client only limits the formats offered, as Chromium lists them in a fixed
+// order rather than by preference.
+func getPipelinePatches(ext extension.Extension) []extension.CachedPatch {
+	formats := pipelineFormats
+	if accepted := extension.PatchFormatsIn(ext.AcceptFormats); len(accepted) > 0 {
+		formats = nil
+		for _, format := range pipelineFormats {
+			if slices.Contains(accepted, format) {
+				formats = append(formats, format)
+			}
+		}
+		if len(formats) == 0 {
+			return nil
+		}
 	}
-	// Unassigned status implies an available update
-	return "ok"
+	ext.AcceptFormats = formats
+	return extension.GetCachedPatches(ext)
 }
 
 // MarshalJSON encodes the extension list into response JSON
@@ -41,11 +61,11 @@ func (r *UpdateResponse) MarshalJSON() ([]byte, error) {
 		SHA256 string `json:"sha256" validate:"required"`
 	}
 	type Operation struct {
-		Type     string `json:"type" validate:"required,oneof=download puff crx3"`
-		Out      *Out   `json:"out,omitempty" validate:"omitempty,required_if=Type download,required_if=Type puff"`
+		Type     string `json:"type" validate:"required,oneof=download puff zucc crx3"`
+		Out      *Out   `json:"out,omitempty" validate:"omitempty,required_if=Type download,required_if=Type puff,required_if=Type zucc"`
 		In       *In    `json:"in,omitempty" validate:"omitempty,required_if=Type crx3"`
 		URLs     []URL  `json:"urls,omitempty" validate:"omitempty,required_if=Type download,dive"`
-		Previous *In    `json:"previous,omitempty" validate:"omitempty,required_if=Type puff"`
+		Previous *In    `json:"previous,omitempty" validate:"omitempty,required_if=Type puff,required_if=Type zucc"`
 		Size     uint64 `json:"size,omitempty" validate:"omitempty,required_if=Type download,gt=0"`
 	}
 	type Pipeline struct {
@@ -63,6 +83,9 @@ func (r *UpdateResponse) MarshalJSON() ([]byte, error) {
 	type App struct {
 		AppID       string      `json:"appid"`
 		Status      string      `json:"status"`
+		Cohort      string      `json:"cohort,omitempty"`
+		CohortHint  string      `json:"cohorthint,omitempty"`
+		CohortName  string      `json:"cohortname,omitempty"`
 		UpdateCheck UpdateCheck `json:"updatecheck"`
 	}
 	type ResponseWrapper struct {
@@ -92,6 +115,9 @@ func (r *UpdateResponse) MarshalJSON() ([]byte, error) {
 		app := App{
 			AppID:       ext.ID,
 			Status:      "ok",
+			Cohort:      ext.Cohort,
+			CohortHint:  ext.CohortHint,
+			CohortName:  ext.CohortName,
 			UpdateCheck: UpdateCheck{Status: updateStatus},
 		}
 
@@ -104,85 +130,87 @@ func (r *UpdateResponse) MarshalJSON() ([]byte, error) {
 
 			app.UpdateCheck.NextVersion = ext.Version
 
-			// Create pipeline with operations
-			extensionName := "extension_" + strings.Replace(ext.Version, ".", "_", -1) + ".crx"
-			url := "https://" + extension.GetS3ExtensionBucketHost(ext.ID) + "/release/" + ext.ID + "/" + extensionName
-
 			// Initialize pipelines array
 			app.UpdateCheck.Pipelines = []Pipeline{}
 
 			mainCrx3Out := &Out{
 				SHA256: ext.SHA256,
 			}
-			// Add diff pipeline if patch is available (diff pipeline should come first)
-			if ext.FP != "" && ext.PatchList != nil {
-				if patchInfo, ok := ext.PatchList[ext.FP]; ok {
-					// Check if hashdiff is empty
-					if patchInfo.Hashdiff == "" {
-						return nil, fmt.Errorf("extension %s has empty Hashdiff", ext.ID)
-					}
-
-					fpPrefix := ext.FP
-					if len(ext.FP) >= 8 {
-						fpPrefix = ext.FP[:8]
-					}
-					diffPipelineID := "puff_diff_" + fpPrefix
-					patchURL := "https://" + extension.GetS3ExtensionBucketHost(ext.ID) + "/release/" +
-						ext.ID + "/patches/" + ext.SHA256 + "/" + ext.FP + ".puff"
+			// Add a diff pipeline per cached package and available patch format, in
+			// the order clients should try them (diff pipelines should come first)
+			for _, cached := range getPipelinePatches(ext) {
+				patchInfo := cached.Patch
+				// Check if hashdiff is empty
+				if patchInfo.Hashdiff == "" {
+					return nil, fmt.Errorf("extension %s has empty Hashdiff", ext.ID)
+				}
 
-					// Create the Out struct for diff pipeline
-					diffOut := &Out{
-						SHA256: patchInfo.Hashdiff,
-					}
+				format := patchInfo.PatchFormat()
+				fpPrefix := cached.FP
+				if len(cached.FP) >= 8 {
+					fpPrefix = cached.FP[:8]
+				}
+				diffPipelineID := format + "_diff_" + fpPrefix
 
-					// Create URLs for diff pipeline
-					diffURLs := []URL{{URL: patchURL}}
+				// Create the Out struct for diff pipeline
+				diffOut := &Out{
+					SHA256: patchInfo.Hashdiff,
+				}
 
-					// Create In structs
-					previousIn := &In{SHA256: ext.FP}
-					crx3In := &In{SHA256: ext.SHA256}
+				// Create URLs for diff pipeline
+				diffURLs := []URL{}
+				for _, patchURL := range extension.GetPatchFileURLs(ext, cached.FP+"."+format) {
+					diffURLs = append(diffURLs, URL{URL: patchURL})
+				}
 
-					// Create operations for diff pipeline
-					diffDownloadOp := Operation{
-						Type: "download",
-						Out:  diffOut,
-						URLs: diffURLs,
-						Size: normalizeSize(uint64(patchInfo.Sizediff)),
-					}
+				// Create In structs
+				previousIn := &In{SHA256: cached.FP}
+				crx3In := &In{SHA256: ext.SHA256}
 
-					puffOp := Operation{
-						Type:     "puff",
-						Previous: previousIn,
-						Out:      mainCrx3Out,
-					}
+				// Create operations for diff pipeline
+				diffDownloadOp := Operation{
+					Type: "download",
+					Out:  diffOut,
+					URLs: diffURLs,
+					Size: normalizeSize(uint64(patchInfo.Sizediff)),
+				}
 
-					crx3Op := Operation{
-						Type: "crx3",
-						In:   crx3In,
-					}
+				// The patch is applied by the operation named after its format
+				patchOp := Operation{
+					Type:     format,
+					Previous: previousIn,
+					Out:      mainCrx3Out,
+				}
 
-					// Validate all operations
-					for _, op := range []Operation{diffDownloadOp, puffOp, crx3Op} {
-						if err := validate.Struct(op); err != nil {
-							return nil, fmt.Errorf("%s operation validation failed for extension %s: %v", op.Type, ext.ID, err)
-						}
-					}
+				crx3Op := Operation{
+					Type: "crx3",
+					In:   crx3In,
+				}
 
-					diffPipeline := Pipeline{
-						PipelineID: diffPipelineID,
-						Operations: []Operation{
-							diffDownloadOp,
-							puffOp,
-							crx3Op,
-						},
+				// Validate all operations
+				for _, op := range []Operation{diffDownloadOp, patchOp, crx3Op} {
+					if err := validate.Struct(op); err != nil {
+						return nil, fmt.Errorf("%s operation validation failed for extension %s: %v", op.Type, ext.ID, err)
 					}
+				}
 
-					app.UpdateCheck.Pipelines = append(app.UpdateCheck.Pipelines, diffPipeline)
+				diffPipeline := Pipeline{
+					PipelineID: diffPipelineID,
+					Operations: []Operation{
+						diffDownloadOp,
+						patchOp,
+						crx3Op,
+					},
 				}
+
+				app.UpdateCheck.Pipelines = append(app.UpdateCheck.Pipelines, diffPipeline)
 			}
 
 			// Add full pipeline as fallback (always add as the last pipeline)
-			urls := []URL{{URL: url}}
+			urls := []URL{}
+			for _, url := range extension.GetPackageURLs(ext) {
+				urls = append(urls, URL{URL: url})
+			}
 			mainCrx3In := &In{SHA256: ext.SHA256}
 
 			// Create operations for main pipeline
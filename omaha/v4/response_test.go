@@ -123,6 +123,137 @@ func TestResponseMarshalJSON(t *testing.T) {
 	// Second app should be darkThemeExtension
 	app = apps[1].(map[string]interface{})
 	assert.Equal(t, "bfdgpgibhagkpdlnjonhkabjoijopoge", app["appid"])
+	_, hasCohort := app["cohort"]
+	assert.False(t, hasCohort)
+
+	// Assigned cohorts are returned in the app
+	updateResponse = UpdateResponse{{ID: "test-cohort-ext", Version: "1.0.0", Status: "noupdate", Cohort: "experiment", CohortName: "Experiment"}}
+	jsonData, err = updateResponse.MarshalJSON()
+	assert.Nil(t, err)
+	assert.Contains(t, string(jsonData), `{"appid":"test-cohort-ext","status":"ok","cohort":"experiment","cohortname":"Experiment","updatecheck":{"status":"noupdate"}}`)
+}
+
+func TestResponseMarshalJSONMirrors(t *testing.T) {
+	GetElapsedDays = func() int { return 6284 }
+
+	updateResponse := UpdateResponse{{
+		ID:            "ldimlcelhnjgpjjemdjokpgeeikdinbm",
+		FP:            "old-sha256",
+		Version:       "1.0.0",
+		SHA256:        "new-sha256",
+		Size:          1024,
+		PatchList:     map[string]*extension.PatchInfo{"old-sha256": {Hashdiff: "diff-sha256", Namediff: "old-sha256.puff", Sizediff: 100}},
+		DownloadHosts: []string{"cdn.example.com", "mirror.example.com"},
+	}}
+	jsonData, err := updateResponse.MarshalJSON()
+	assert.Nil(t, err)
+
+	// Every download lists the hosts in order
+	assert.Contains(t, string(jsonData), `"urls":[{"url":"https://cdn.example.com/release/ldimlcelhnjgpjjemdjokpgeeikdinbm/patches/new-sha256/old-sha256.puff"},{"url":"https://mirror.example.com/release/ldimlcelhnjgpjjemdjokpgeeikdinbm/patches/new-sha256/old-sha256.puff"}]`)
+	assert.Contains(t, string(jsonData), `"urls":[{"url":"https://cdn.example.com/release/ldimlcelhnjgpjjemdjokpgeeikdinbm/extension_1_0_0.crx"},{"url":"https://mirror.example.com/release/ldimlcelhnjgpjjemdjokpgeeikdinbm/extension_1_0_0.crx"}]`)
+
+	// Explicit URLs replace the full package URLs, but not the patch URLs
+	updateResponse[0].URL = "https://downloads.example.com/light-theme.crx"
+	jsonData, err = updateResponse.MarshalJSON()
+	assert.Nil(t, err)
+	assert.Contains(t, string(jsonData), `"urls":[{"url":"https://downloads.example.com/light-theme.crx"}]`)
+	assert.Contains(t, string(jsonData), `"urls":[{"url":"https://cdn.example.com/release/ldimlcelhnjgpjjemdjokpgeeikdinbm/patches/new-sha256/old-sha256.puff"},`)
+}
+
+func TestResponseMarshalJSONPatchFormats(t *testing.T) {
+	GetElapsedDays = func() int { return 6284 }
+
+	updateResponse := UpdateResponse{{
+		ID:      "ldimlcelhnjgpjjemdjokpgeeikdinbm",
+		FP:      "old-sha256",
+		Version: "1.0.0",
+		SHA256:  "new-sha256",
+		Size:    1024,
+		PatchList: map[string]*extension.PatchInfo{"old-sha256": {
+			Hashdiff: "puff-sha256",
+			Sizediff: 100,
+			Alternatives: []*extension.PatchInfo{
+				{Hashdiff: "bsdiff-sha256", Sizediff: 60, Format: extension.PatchFormatBsdiff},
+				{Hashdiff: "zucc-sha256", Sizediff: 80, Format: extension.PatchFormatZucchini},
+				{Hashdiff: "courgette-sha256", Sizediff: 70, Format: extension.PatchFormatCourgette},
+			},
+		}},
+		DownloadHosts: []string{"cdn.example.com"},
+		AcceptFormats: []string{"crx3", "puff", "bsdiff", "courgette", "zucc"},
+	}}
+	jsonData, err := updateResponse.MarshalJSON()
+	assert.Nil(t, err)
+
+	// A pipeline per format, zucc then puff whatever the order of the client, then the
+	// full package.
+	// There are no operations applying courgette and bsdiff patches in v4.
+	var actual map[string]interface{}
+	assert.Nil(t, json.Unmarshal(jsonData, &actual))
+	app := actual["response"].(map[string]interface{})["apps"].([]interface{})[0].(map[string]interface{})
+	pipelines := app["updatecheck"].(map[string]interface{})["pipelines"].([]interface{})
+	assert.Equal(t, 3, len(pipelines))
+	pipelineIDs := []string{}
+	for _, pipeline := range pipelines {
+		pipelineIDs = append(pipelineIDs, pipeline.(map[string]interface{})["pipeline_id"].(string))
+	}
+	assert.Equal(t, []string{"zucc_diff_old-sha2", "puff_diff_old-sha2", "direct_full"}, pipelineIDs)
+	assert.Contains(t, string(jsonData), `{"type":"download","out":{"sha256":"zucc-sha256"},"urls":[{"url":"https://cdn.example.com/release/ldimlcelhnjgpjjemdjokpgeeikdinbm/patches/new-sha256/old-sha256.zucc"}],"size":80},{"type":"zucc","out":{"sha256":"new-sha256"},"previous":{"sha256":"old-sha256"},"size":0}`)
+	assert.NotContains(t, string(jsonData), "bsdiff")
+	assert.NotContains(t, string(jsonData), "courgette")
+
+	// Clients accepting only legacy formats get the full package
+	updateResponse[0].AcceptFormats = []string{"crx3", "bsdiff"}
+	jsonData, err = updateResponse.MarshalJSON()
+	assert.Nil(t, err)
+	assert.Nil(t, json.Unmarshal(jsonData, &actual))
+	app = actual["response"].(map[string]interface{})["apps"].([]interface{})[0].(map[string]interface{})
+	pipelines = app["updatecheck"].(map[string]interface{})["pipelines"].([]interface{})
+	assert.Equal(t, 1, len(pipelines))
+	assert.Equal(t, "direct_full", pipelines[0].(map[string]interface{})["pipeline_id"])
+
+	// Clients listing only package formats get every pipeline
+	updateResponse[0].AcceptFormats = []string{"crx3"}
+	jsonData, err = updateResponse.MarshalJSON()
+	assert.Nil(t, err)
+	assert.Nil(t, json.Unmarshal(jsonData, &actual))
+	app = actual["response"].(map[string]interface{})["apps"].([]interface{})[0].(map[string]interface{})
+	pipelines = app["updatecheck"].(map[string]interface{})["pipelines"].([]interface{})
+	pipelineIDs = []string{}
+	for _, pipeline := range pipelines {
+		pipelineIDs = append(pipelineIDs, pipeline.(map[string]interface{})["pipeline_id"].(string))
+	}
+	assert.Equal(t, []string{"zucc_diff_old-sha2", "puff_diff_old-sha2", "direct_full"}, pipelineIDs)
+}
+
+func TestResponseMarshalJSONCachedItems(t *testing.T) {
+	GetElapsedDays = func() int { return 6284 }
+
+	updateResponse := UpdateResponse{{
+		ID:        "ldimlcelhnjgpjjemdjokpgeeikdinbm",
+		FP:        "old-sha256",
+		CachedFPs: []string{"old-sha256", "older-sha256", "unknown-sha256"},
+		Version:   "1.0.0",
+		SHA256:    "new-sha256",
+		Size:      1024,
+		PatchList: map[string]*extension.PatchInfo{
+			"old-sha256":   {Hashdiff: "old-puff-sha256", Sizediff: 100},
+			"older-sha256": {Hashdiff: "older-puff-sha256", Sizediff: 60},
+		},
+	}}
+	jsonData, err := updateResponse.MarshalJSON()
+	assert.Nil(t, err)
+
+	// A pipeline per cached package with a patch, smallest patch first
+	var actual map[string]interface{}
+	assert.Nil(t, json.Unmarshal(jsonData, &actual))
+	app := actual["response"].(map[string]interface{})["apps"].([]interface{})[0].(map[string]interface{})
+	pipelines := app["updatecheck"].(map[string]interface{})["pipelines"].([]interface{})
+	pipelineIDs := []string{}
+	for _, pipeline := range pipelines {
+		pipelineIDs = append(pipelineIDs, pipeline.(map[string]interface{})["pipeline_id"].(string))
+	}
+	assert.Equal(t, []string{"puff_diff_older-sh", "puff_diff_old-sha2", "direct_full"}, pipelineIDs)
+	assert.Contains(t, string(jsonData), `/patches/new-sha256/older-sha256.puff"}],"size":60},{"type":"puff","out":{"sha256":"new-sha256"},"previous":{"sha256":"older-sha256"},"size":0}`)
 }
 
 func TestSizeValidation(t *testing.T) {
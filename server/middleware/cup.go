@@ -0,0 +1,195 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/brave/go-update/logger"
+)
+
+// CUPServerProofHeader is the response header carrying the CUP-ECDSA server proof
+const CUPServerProofHeader = "X-Cup-Server-Proof"
+
+// CUPSigner signs update responses following the Client Update Protocol (CUP-ECDSA)
+// used by Chromium's component updater. Clients pick the key version, and the
+// signer holds the private key of every version it supports.
+//
+// Ref: https://chromium.googlesource.com/chromium/src.git/+/master/docs/updater/cup.md
+type CUPSigner struct {
+	keys map[int]*ecdsa.PrivateKey
+}
+
+// NewCUPSigner creates a CUPSigner with a mapping of key version to private key
+func NewCUPSigner(keys map[int]*ecdsa.PrivateKey) *CUPSigner {
+	return &CUPSigner{keys: keys}
+}
+
+// NewCUPSignerFromEnv creates a CUPSigner with the keys listed by CUP_KEYS, a comma
+// separated list of <key version>=<path of a PEM encoded ECDSA private key>.
+// It returns nil if CUP_KEYS is not set, in which case responses are not signed.
+func NewCUPSignerFromEnv() (*CUPSigner, error) {
+	cupKeys := strings.TrimSpace(os.Getenv("CUP_KEYS"))
+	if cupKeys == "" {
+		return nil, nil
+	}
+
+	keys := make(map[int]*ecdsa.PrivateKey)
+	for entry := range strings.SplitSeq(cupKeys, ",") {
+		versionStr, path, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid CUP_KEYS entry %q, expected <key version>=<path>", entry)
+		}
+		version, err := strconv.Atoi(versionStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CUP key version %q: %w", versionStr, err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading CUP key %d: %w", version, err)
+		}
+		key, err := ParseCUPPrivateKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing CUP key %d: %w", version, err)
+		}
+		keys[version] = key
+	}
+	return NewCUPSigner(keys), nil
+}
+
+// ParseCUPPrivateKey parses a PEM encoded ECDSA private key, either in SEC 1
+// ("EC PRIVATE KEY") or in PKCS #8 ("PRIVATE KEY") form
+func ParseCUPPrivateKey(data []byte) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+	if block.Type == "EC PRIVATE KEY" {
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	ecdsaKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("key is not an ECDSA private key")
+	}
+	return ecdsaKey, nil
+}
+
+// Proof returns the server proof of a response for the X-Cup-Server-Proof header,
+// given the value of the request's cup2key query parameter, formatted as
+// <key version>:<nonce>. The proof is the hex encoded ASN.1 ECDSA-SHA256 signature of
+// SHA256(SHA256(request) || SHA256(response) || cup2key), followed by a colon and
+// the hex encoded SHA256 of the request the client checks against its own.
+func (s *CUPSigner) Proof(cup2key string, requestBody []byte, responseBody []byte) (string, error) {
+	versionStr, _, ok := strings.Cut(cup2key, ":")
+	if !ok {
+		return "", fmt.Errorf("invalid cup2key %q", cup2key)
+	}
+	version, err := strconv.Atoi(versionStr)
+	if err != nil {
+		return "", fmt.Errorf("invalid cup2key key version %q: %w", versionStr, err)
+	}
+	key, ok := s.keys[version]
+	if !ok {
+		return "", fmt.Errorf("unsupported CUP key version %d", version)
+	}
+
+	requestHash := sha256.Sum256(requestBody)
+	responseHash := sha256.Sum256(responseBody)
+	message := make([]byte, 0, len(requestHash)+len(responseHash)+len(cup2key))
+	message = append(message, requestHash[:]...)
+	message = append(message, responseHash[:]...)
+	message = append(message, cup2key...)
+
+	// Clients verify an ECDSA-SHA256 signature over the hash of the message
+	messageHash := sha256.Sum256(message)
+	digest := sha256.Sum256(messageHash[:])
+	signature, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("error signing CUP response: %w", err)
+	}
+	return hex.EncodeToString(signature) + ":" + hex.EncodeToString(requestHash[:]), nil
+}
+
+// cupResponseWriter buffers a response until it has been signed
+type cupResponseWriter struct {
+	header     http.Header
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (w *cupResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *cupResponseWriter) WriteHeader(statusCode int) {
+	if w.statusCode == 0 {
+		w.statusCode = statusCode
+	}
+}
+
+func (w *cupResponseWriter) Write(b []byte) (int, error) {
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+	}
+	return w.body.Write(b)
+}
+
+// CUPMiddleware signs the responses to requests carrying a cup2key query parameter
+// with signer. It must run inside the compression middleware, since clients verify
+// the uncompressed response. Requests with a key version the signer doesn't hold are
+// served without a proof, which clients enforcing CUP reject.
+func CUPMiddleware(signer *CUPSigner) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cup2key := r.URL.Query().Get("cup2key")
+			if signer == nil || cup2key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			logger := logger.FromContext(r.Context())
+
+			// Handlers reject requests reaching the limit, so reading no further is safe
+			limit := int64(1024 * 1024 * 10) // 10MiB
+			requestBody, err := io.ReadAll(io.LimitReader(r.Body, limit))
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Error reading body: %v", err), http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(requestBody))
+
+			buffered := &cupResponseWriter{header: w.Header()}
+			next.ServeHTTP(buffered, r)
+			if buffered.statusCode == 0 {
+				buffered.statusCode = http.StatusOK
+			}
+
+			proof, err := signer.Proof(cup2key, requestBody, buffered.body.Bytes())
+			if err != nil {
+				logger.Warn("Unable to sign CUP response", "error", err)
+			} else {
+				w.Header().Set(CUPServerProofHeader, proof)
+			}
+
+			w.WriteHeader(buffered.statusCode)
+			// nosemgrep: go.lang.security.audit.xss.no-direct-write-to-responsewriter.no-direct-write-to-responsewriter
+			if _, err := w.Write(buffered.body.Bytes()); err != nil {
+				logger.Error("Error writing signed response", "error", err)
+			}
+		})
+	}
+}
@@ -35,8 +35,33 @@ func setupRouter(ctx context.Context, testRouter bool) (context.Context, *chi.Mu
 		r.Use(logger.RequestLoggerMiddleware())
 	}
 
-	extensions := extension.OfferedExtensions
-	r.Mount("/extensions", controller.ExtensionsRouter(extensions, testRouter))
+	// Responses are signed before they are compressed
+	cupSigner, err := middleware.NewCUPSignerFromEnv()
+	if err != nil {
+		logger.Panic(logger.FromContext(ctx), "Failed to configure CUP signing", err)
+	}
+	if cupSigner != nil {
+		r.Use(middleware.CUPMiddleware(cupSigner))
+	}
+
+	urlSigner, err := extension.NewURLSignerFromEnv()
+	if err != nil {
+		logger.Panic(logger.FromContext(ctx), "Failed to configure download URL signing", err)
+	}
+	extension.SetURLSigner(urlSigner)
+
+	var catalog extension.Catalog = extension.NewMemoryCatalog(extension.OfferedExtensions)
+	if !testRouter {
+		catalog, err = extension.NewCatalogFromEnv()
+		if err != nil {
+			logger.Panic(logger.FromContext(ctx), "Failed to configure extensions catalog", err)
+		}
+		controller.EventSink, err = extension.NewEventSinkFromEnv()
+		if err != nil {
+			logger.Panic(logger.FromContext(ctx), "Failed to configure events sink", err)
+		}
+	}
+	r.Mount("/extensions", controller.ExtensionsRouter(catalog, testRouter))
 	return ctx, r
 }
 
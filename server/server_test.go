@@ -3,12 +3,21 @@ package server
 import (
 	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
 	"encoding/json/v2"
+	"encoding/pem"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -17,6 +26,7 @@ import (
 	"github.com/brave/go-update/extension"
 	"github.com/brave/go-update/extension/extensiontest"
 	"github.com/brave/go-update/logger"
+	v3 "github.com/brave/go-update/omaha/v3"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -62,9 +72,10 @@ func init() {
 	// We maintain a count to make sure the refresh function is called more than just
 	// the first time.
 	count := 0
-	controller.AllExtensionsMap = extension.NewExtensionMap()
-	controller.AllExtensionsMap.StoreExtensions(&extension.OfferedExtensions)
 	controller.ExtensionUpdaterTimeout = time.Millisecond * 1
+	// Set a constant daystart for consistent test output
+	v3.GetElapsedDays = func() int { return 6284 }
+	v3.GetElapsedSeconds = func() int { return 100 }
 	serverCtx, _ := logger.Setup(context.Background())
 	_, router := setupRouter(serverCtx, true)
 	handler = router
@@ -95,6 +106,27 @@ func TestPing(t *testing.T) {
 	}
 }
 
+func TestExtensionsRouterCatalog(t *testing.T) {
+	originalAllExtensionsMap := controller.AllExtensionsMap
+	controller.AllExtensionsMap = extension.NewExtensionMap()
+	defer func() {
+		controller.AllExtensionsMap = originalAllExtensionsMap
+	}()
+
+	controller.ExtensionsRouter(extension.NewMemoryCatalog(extension.OfferedExtensions), true)
+	_, ok := controller.AllExtensionsMap.Load(lightThemeExtensionID)
+	assert.True(t, ok)
+
+	// Catalogs with an invalid extension are not loaded, the previous extensions are kept
+	invalid := newExtension1
+	invalid.Cohorts = []*extension.Cohort{nil}
+	controller.ExtensionsRouter(extension.NewMemoryCatalog(extension.Extensions{newExtension2, invalid}), true)
+	_, ok = controller.AllExtensionsMap.Load(lightThemeExtensionID)
+	assert.True(t, ok)
+	_, ok = controller.AllExtensionsMap.Load(newExtensionID2)
+	assert.False(t, ok)
+}
+
 func testCall(t *testing.T, server *httptest.Server, method string, contentType string, query string,
 	requestBody string, expectedResponseCode int, expectedResponse string, redirectLocation string,
 ) {
@@ -137,7 +169,9 @@ func TestUpdateExtensionsXMLV3(t *testing.T) {
 		  <hw physmemory="16"/>
 		  <os platform="Mac OS X" version="10.11.6" arch="x86_64"/>
 		</request>`
-	expectedResponse := "<response protocol=\"3.1\" server=\"prod\"></response>"
+	expectedResponse := `<response protocol="3.1" server="prod">
+    <daystart elapsed_seconds="100" elapsed_days="6284"></daystart>
+</response>`
 	testCall(t, server, http.MethodPost, contentTypeXML, "", requestBody, http.StatusOK, expectedResponse, "")
 
 	// Unsupported protocol version
@@ -176,6 +210,7 @@ func TestUpdateExtensionsXMLV3(t *testing.T) {
 	// Single extension out of date
 	requestBody = lightThemeExtension("0.0.0")
 	expectedResponse = `<response protocol="3.1" server="prod">
+    <daystart elapsed_seconds="100" elapsed_days="6284"></daystart>
     <app appid="ldimlcelhnjgpjjemdjokpgeeikdinbm">
         <updatecheck status="ok">
             <urls>
@@ -183,7 +218,7 @@ func TestUpdateExtensionsXMLV3(t *testing.T) {
             </urls>
             <manifest version="1.0.0">
                 <packages>
-                    <package name="extension_1_0_0.crx" hash_sha256="1c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618" required="true"></package>
+                    <package name="extension_1_0_0.crx" fp="1c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618" hash_sha256="1c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618" required="true"></package>
                 </packages>
             </manifest>
         </updatecheck>
@@ -194,6 +229,7 @@ func TestUpdateExtensionsXMLV3(t *testing.T) {
 	// Single extension same version
 	requestBody = lightThemeExtension("1.0.0")
 	expectedResponse = `<response protocol="3.1" server="prod">
+    <daystart elapsed_seconds="100" elapsed_days="6284"></daystart>
     <app appid="ldimlcelhnjgpjjemdjokpgeeikdinbm">
         <updatecheck status="noupdate"></updatecheck>
     </app>
@@ -203,6 +239,7 @@ func TestUpdateExtensionsXMLV3(t *testing.T) {
 	// Single extension greater version
 	requestBody = lightThemeExtension("2.0.0")
 	expectedResponse = `<response protocol="3.1" server="prod">
+    <daystart elapsed_seconds="100" elapsed_days="6284"></daystart>
     <app appid="ldimlcelhnjgpjjemdjokpgeeikdinbm">
         <updatecheck status="noupdate"></updatecheck>
     </app>
@@ -214,6 +251,7 @@ func TestUpdateExtensionsXMLV3(t *testing.T) {
 	// Multiple components with none out of date
 	requestBody = lightAndDarkThemeRequest("70.0.0", "70.0.0")
 	expectedResponse = `<response protocol="3.1" server="prod">
+    <daystart elapsed_seconds="100" elapsed_days="6284"></daystart>
     <app appid="ldimlcelhnjgpjjemdjokpgeeikdinbm">
         <updatecheck status="noupdate"></updatecheck>
     </app>
@@ -226,6 +264,7 @@ func TestUpdateExtensionsXMLV3(t *testing.T) {
 	// Only one components out of date
 	requestBody = lightAndDarkThemeRequest("0.0.0", "70.0.0")
 	expectedResponse = `<response protocol="3.1" server="prod">
+    <daystart elapsed_seconds="100" elapsed_days="6284"></daystart>
     <app appid="ldimlcelhnjgpjjemdjokpgeeikdinbm">
         <updatecheck status="ok">
             <urls>
@@ -233,7 +272,7 @@ func TestUpdateExtensionsXMLV3(t *testing.T) {
             </urls>
             <manifest version="1.0.0">
                 <packages>
-                    <package name="extension_1_0_0.crx" hash_sha256="1c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618" required="true"></package>
+                    <package name="extension_1_0_0.crx" fp="1c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618" hash_sha256="1c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618" required="true"></package>
                 </packages>
             </manifest>
         </updatecheck>
@@ -247,6 +286,7 @@ func TestUpdateExtensionsXMLV3(t *testing.T) {
 	// Other component of 2 out of date
 	requestBody = lightAndDarkThemeRequest("70.0.0", "0.0.0")
 	expectedResponse = `<response protocol="3.1" server="prod">
+    <daystart elapsed_seconds="100" elapsed_days="6284"></daystart>
     <app appid="ldimlcelhnjgpjjemdjokpgeeikdinbm">
         <updatecheck status="noupdate"></updatecheck>
     </app>
@@ -257,7 +297,7 @@ func TestUpdateExtensionsXMLV3(t *testing.T) {
             </urls>
             <manifest version="1.0.0">
                 <packages>
-                    <package name="extension_1_0_0.crx" hash_sha256="ae517d6273a4fc126961cb026e02946db4f9dbb58e3d9bc29f5e1270e3ce9834" required="true"></package>
+                    <package name="extension_1_0_0.crx" fp="ae517d6273a4fc126961cb026e02946db4f9dbb58e3d9bc29f5e1270e3ce9834" hash_sha256="ae517d6273a4fc126961cb026e02946db4f9dbb58e3d9bc29f5e1270e3ce9834" required="true"></package>
                 </packages>
             </manifest>
         </updatecheck>
@@ -268,6 +308,7 @@ func TestUpdateExtensionsXMLV3(t *testing.T) {
 	// Both components need updates
 	requestBody = lightAndDarkThemeRequest("0.0.0", "0.0.0")
 	expectedResponse = `<response protocol="3.1" server="prod">
+    <daystart elapsed_seconds="100" elapsed_days="6284"></daystart>
     <app appid="ldimlcelhnjgpjjemdjokpgeeikdinbm">
         <updatecheck status="ok">
             <urls>
@@ -275,7 +316,7 @@ func TestUpdateExtensionsXMLV3(t *testing.T) {
             </urls>
             <manifest version="1.0.0">
                 <packages>
-                    <package name="extension_1_0_0.crx" hash_sha256="1c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618" required="true"></package>
+                    <package name="extension_1_0_0.crx" fp="1c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618" hash_sha256="1c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618" required="true"></package>
                 </packages>
             </manifest>
         </updatecheck>
@@ -287,7 +328,7 @@ func TestUpdateExtensionsXMLV3(t *testing.T) {
             </urls>
             <manifest version="1.0.0">
                 <packages>
-                    <package name="extension_1_0_0.crx" hash_sha256="ae517d6273a4fc126961cb026e02946db4f9dbb58e3d9bc29f5e1270e3ce9834" required="true"></package>
+                    <package name="extension_1_0_0.crx" fp="ae517d6273a4fc126961cb026e02946db4f9dbb58e3d9bc29f5e1270e3ce9834" hash_sha256="ae517d6273a4fc126961cb026e02946db4f9dbb58e3d9bc29f5e1270e3ce9834" required="true"></package>
                 </packages>
             </manifest>
         </updatecheck>
@@ -322,6 +363,7 @@ func TestUpdateExtensionsXMLV3(t *testing.T) {
 	// Single new extension out of date that was added in by the refresh timer
 	requestBody = extensiontest.ExtensionRequestFnForXML("newext1eplbcioakkpcpgfkobkghlhen")("0.0.0")
 	expectedResponse = `<response protocol="3.1" server="prod">
+    <daystart elapsed_seconds="100" elapsed_days="6284"></daystart>
     <app appid="newext1eplbcioakkpcpgfkobkghlhen">
         <updatecheck status="ok">
             <urls>
@@ -329,7 +371,7 @@ func TestUpdateExtensionsXMLV3(t *testing.T) {
             </urls>
             <manifest version="1.0.0">
                 <packages>
-                    <package name="extension_1_0_0.crx" hash_sha256="4c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618" required="true"></package>
+                    <package name="extension_1_0_0.crx" fp="4c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618" hash_sha256="4c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618" required="true"></package>
                 </packages>
             </manifest>
         </updatecheck>
@@ -340,6 +382,7 @@ func TestUpdateExtensionsXMLV3(t *testing.T) {
 	// Single second new extension out of date that was added in by the refresh timer
 	requestBody = extensiontest.ExtensionRequestFnForXML("newext2eplbcioakkpcpgfkobkghlhen")("0.0.0")
 	expectedResponse = `<response protocol="3.1" server="prod">
+    <daystart elapsed_seconds="100" elapsed_days="6284"></daystart>
     <app appid="newext2eplbcioakkpcpgfkobkghlhen">
         <updatecheck status="ok">
             <urls>
@@ -347,7 +390,7 @@ func TestUpdateExtensionsXMLV3(t *testing.T) {
             </urls>
             <manifest version="1.0.0">
                 <packages>
-                    <package name="extension_1_0_0.crx" hash_sha256="3c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618" required="true"></package>
+                    <package name="extension_1_0_0.crx" fp="3c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618" hash_sha256="3c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618" required="true"></package>
                 </packages>
             </manifest>
         </updatecheck>
@@ -380,6 +423,7 @@ func TestUpdateExtensionsXMLV3(t *testing.T) {
 	// Mixed statuses XML: outdated (ok), current (noupdate), unknown (error-unknownApplication)
 	requestBody = threeExtensionXMLRequest("0.0.0", "70.0.0", "1.0.0")
 	expectedResponse = `<response protocol="3.1" server="prod">
+    <daystart elapsed_seconds="100" elapsed_days="6284"></daystart>
     <app appid="` + lightThemeExtensionID + `">
         <updatecheck status="ok">
             <urls>
@@ -387,7 +431,7 @@ func TestUpdateExtensionsXMLV3(t *testing.T) {
             </urls>
             <manifest version="1.0.0">
                 <packages>
-                    <package name="extension_1_0_0.crx" hash_sha256="1c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618" required="true"></package>
+                    <package name="extension_1_0_0.crx" fp="1c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618" hash_sha256="1c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618" required="true"></package>
                 </packages>
             </manifest>
         </updatecheck>
@@ -415,6 +459,7 @@ func TestUpdateExtensionsXMLV3(t *testing.T) {
 	// Test blacklisted extension returns restricted status in XML
 	requestBody = extensiontest.ExtensionRequestFnForXML(lightThemeExtensionID)("0.0.0")
 	expectedResponse = `<response protocol="3.1" server="prod">
+    <daystart elapsed_seconds="100" elapsed_days="6284"></daystart>
     <app appid="` + lightThemeExtensionID + `">
         <updatecheck status="restricted"></updatecheck>
     </app>
@@ -439,7 +484,9 @@ func TestWebStoreUpdateExtensionV3XML(t *testing.T) {
 	// Empty query param request, no extensions.
 	requestBody := ""
 	query := ""
-	expectedResponse := `<gupdate protocol="3.1" server="prod"></gupdate>`
+	expectedResponse := `<gupdate protocol="3.1" server="prod">
+    <daystart elapsed_seconds="100" elapsed_days="6284"></daystart>
+</gupdate>`
 	testCall(t, server, http.MethodGet, contentTypeXML, query, requestBody, http.StatusOK, expectedResponse, "")
 
 	// Extension that we handle which is outdated should produce a response
@@ -448,6 +495,7 @@ func TestWebStoreUpdateExtensionV3XML(t *testing.T) {
 	assert.True(t, ok)
 	query = "?" + getQueryParams(&outdatedLightThemeExtension)
 	expectedResponse = `<gupdate protocol="3.1" server="prod">
+    <daystart elapsed_seconds="100" elapsed_days="6284"></daystart>
     <app appid="ldimlcelhnjgpjjemdjokpgeeikdinbm" status="ok">
         <updatecheck status="ok" codebase="https://` + extension.GetS3ExtensionBucketHost(lightThemeExtensionID) + `/release/ldimlcelhnjgpjjemdjokpgeeikdinbm/extension_1_0_0.crx" version="1.0.0" hash_sha256="1c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618"></updatecheck>
     </app>
@@ -460,6 +508,7 @@ func TestWebStoreUpdateExtensionV3XML(t *testing.T) {
 	outdatedDarkThemeExtension.Version = "0.0.0"
 	query = "?" + getQueryParams(&outdatedLightThemeExtension) + "&" + getQueryParams(&outdatedDarkThemeExtension)
 	expectedResponse = `<gupdate protocol="3.1" server="prod">
+    <daystart elapsed_seconds="100" elapsed_days="6284"></daystart>
     <app appid="ldimlcelhnjgpjjemdjokpgeeikdinbm" status="ok">
         <updatecheck status="ok" codebase="https://` + extension.GetS3ExtensionBucketHost(lightThemeExtensionID) + `/release/ldimlcelhnjgpjjemdjokpgeeikdinbm/extension_1_0_0.crx" version="1.0.0" hash_sha256="1c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618"></updatecheck>
     </app>
@@ -469,11 +518,23 @@ func TestWebStoreUpdateExtensionV3XML(t *testing.T) {
 </gupdate>`
 	testCall(t, server, http.MethodGet, contentTypeXML, query, requestBody, http.StatusOK, expectedResponse, "")
 
+	// Clients which don't accept CRX3 packages are not offered the update
+	query = "?" + getQueryParams(&outdatedLightThemeExtension) + "&acceptformat=crx2"
+	expectedResponse = `<gupdate protocol="3.1" server="prod">
+    <daystart elapsed_seconds="100" elapsed_days="6284"></daystart>
+    <app appid="ldimlcelhnjgpjjemdjokpgeeikdinbm" status="ok">
+        <updatecheck status="error-unsupportedProtocol"></updatecheck>
+    </app>
+</gupdate>`
+	testCall(t, server, http.MethodGet, contentTypeXML, query, requestBody, http.StatusOK, expectedResponse, "")
+
 	// Extension that we handle which is up to date should NOT produce an update but still be successful
 	lightThemeExtension, ok := allExtensionsMap.Load("ldimlcelhnjgpjjemdjokpgeeikdinbm")
 	assert.True(t, ok)
 	query = "?" + getQueryParams(&lightThemeExtension)
-	expectedResponse = `<gupdate protocol="3.1" server="prod"></gupdate>`
+	expectedResponse = `<gupdate protocol="3.1" server="prod">
+    <daystart elapsed_seconds="100" elapsed_days="6284"></daystart>
+</gupdate>`
 	testCall(t, server, http.MethodGet, contentTypeXML, query, requestBody, http.StatusOK, expectedResponse, "")
 
 	// Unknown extension ID goes to Google server
@@ -495,7 +556,9 @@ func TestWebStoreUpdateExtensionV3XML(t *testing.T) {
 		Version: "0.0.0",
 	}
 	query = "?" + getQueryParams(&unknownExtension) + "&" + getQueryParams(&unknownExtension2)
-	expectedResponse = `<gupdate protocol="3.1" server="prod"></gupdate>`
+	expectedResponse = `<gupdate protocol="3.1" server="prod">
+    <daystart elapsed_seconds="100" elapsed_days="6284"></daystart>
+</gupdate>`
 	testCall(t, server, http.MethodGet, contentTypeXML, query, requestBody, http.StatusOK, expectedResponse, "")
 }
 
@@ -507,7 +570,7 @@ func TestUpdateExtensionsV3JSON(t *testing.T) {
 	// No extensions
 	requestBody := `{"request":{"protocol":"3.1","version":"chrome-53.0.2785.116","prodversion":"53.0.2785.116","requestid":"{e821bacd-8dbf-4cc8-9e8c-bcbe8c1cfd3d}","lang":"","updaterchannel":"stable","prodchannel":"stable","@os":"mac","arch":"x64","nacl_arch":"x86-64","hw":{"physmemory":16},"os":{"arch":"x86_64","platform":"Mac OS X","version":"10.14.3"}}}`
 	// The server responds with a different response than what's documented externally
-	expectedResponse := jsonPrefix + `{"response":{"protocol":"3.1","server":"prod","app":[]}}`
+	expectedResponse := jsonPrefix + `{"response":{"protocol":"3.1","server":"prod","daystart":{"elapsed_seconds":100,"elapsed_days":6284},"app":[]}}`
 	testCall(t, server, http.MethodPost, contentTypeJSON, "", requestBody, http.StatusOK, expectedResponse, "")
 
 	// Unsupported protocol version
@@ -529,39 +592,39 @@ func TestUpdateExtensionsV3JSON(t *testing.T) {
 
 	// Single extension out of date
 	requestBody = lightThemeExtension("0.0.0")
-	expectedResponse = jsonPrefix + `{"response":{"protocol":"3.1","server":"prod","app":[{"appid":"ldimlcelhnjgpjjemdjokpgeeikdinbm","status":"ok","updatecheck":{"status":"ok","urls":{"url":[{"codebase":"https://` + extension.GetS3ExtensionBucketHost(lightThemeExtensionID) + `/release/ldimlcelhnjgpjjemdjokpgeeikdinbm/extension_1_0_0.crx"}]},"manifest":{"version":"1.0.0","packages":{"package":[{"name":"extension_1_0_0.crx","fp":"1c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618","hash_sha256":"1c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618","required":true}]}}}}]}}`
+	expectedResponse = jsonPrefix + `{"response":{"protocol":"3.1","server":"prod","daystart":{"elapsed_seconds":100,"elapsed_days":6284},"app":[{"appid":"ldimlcelhnjgpjjemdjokpgeeikdinbm","status":"ok","updatecheck":{"status":"ok","urls":{"url":[{"codebase":"https://` + extension.GetS3ExtensionBucketHost(lightThemeExtensionID) + `/release/ldimlcelhnjgpjjemdjokpgeeikdinbm/extension_1_0_0.crx"}]},"manifest":{"version":"1.0.0","packages":{"package":[{"name":"extension_1_0_0.crx","fp":"1c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618","hash_sha256":"1c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618","required":true}]}}}}]}}`
 	testCall(t, server, http.MethodPost, contentTypeJSON, "", requestBody, http.StatusOK, expectedResponse, "")
 
 	// Single extension same version
 	requestBody = lightThemeExtension("1.0.0")
-	expectedResponse = jsonPrefix + `{"response":{"protocol":"3.1","server":"prod","app":[{"appid":"ldimlcelhnjgpjjemdjokpgeeikdinbm","status":"ok","updatecheck":{"status":"noupdate"}}]}}`
+	expectedResponse = jsonPrefix + `{"response":{"protocol":"3.1","server":"prod","daystart":{"elapsed_seconds":100,"elapsed_days":6284},"app":[{"appid":"ldimlcelhnjgpjjemdjokpgeeikdinbm","status":"ok","updatecheck":{"status":"noupdate"}}]}}`
 	testCall(t, server, http.MethodPost, contentTypeJSON, "", requestBody, http.StatusOK, expectedResponse, "")
 
 	// Single extension greater version
 	requestBody = lightThemeExtension("2.0.0")
-	expectedResponse = jsonPrefix + `{"response":{"protocol":"3.1","server":"prod","app":[{"appid":"ldimlcelhnjgpjjemdjokpgeeikdinbm","status":"ok","updatecheck":{"status":"noupdate"}}]}}`
+	expectedResponse = jsonPrefix + `{"response":{"protocol":"3.1","server":"prod","daystart":{"elapsed_seconds":100,"elapsed_days":6284},"app":[{"appid":"ldimlcelhnjgpjjemdjokpgeeikdinbm","status":"ok","updatecheck":{"status":"noupdate"}}]}}`
 	testCall(t, server, http.MethodPost, contentTypeJSON, "", requestBody, http.StatusOK, expectedResponse, "")
 
 	lightAndDarkThemeRequest := extensiontest.ExtensionRequestFnForTwoJSON("ldimlcelhnjgpjjemdjokpgeeikdinbm", "bfdgpgibhagkpdlnjonhkabjoijopoge")
 
 	// Multiple components with none out of date
 	requestBody = lightAndDarkThemeRequest("70.0.0", "70.0.0")
-	expectedResponse = jsonPrefix + `{"response":{"protocol":"3.1","server":"prod","app":[{"appid":"ldimlcelhnjgpjjemdjokpgeeikdinbm","status":"ok","updatecheck":{"status":"noupdate"}},{"appid":"bfdgpgibhagkpdlnjonhkabjoijopoge","status":"ok","updatecheck":{"status":"noupdate"}}]}}`
+	expectedResponse = jsonPrefix + `{"response":{"protocol":"3.1","server":"prod","daystart":{"elapsed_seconds":100,"elapsed_days":6284},"app":[{"appid":"ldimlcelhnjgpjjemdjokpgeeikdinbm","status":"ok","updatecheck":{"status":"noupdate"}},{"appid":"bfdgpgibhagkpdlnjonhkabjoijopoge","status":"ok","updatecheck":{"status":"noupdate"}}]}}`
 	testCall(t, server, http.MethodPost, contentTypeJSON, "", requestBody, http.StatusOK, expectedResponse, "")
 
 	// Only one components out of date
 	requestBody = lightAndDarkThemeRequest("0.0.0", "70.0.0")
-	expectedResponse = jsonPrefix + `{"response":{"protocol":"3.1","server":"prod","app":[{"appid":"ldimlcelhnjgpjjemdjokpgeeikdinbm","status":"ok","updatecheck":{"status":"ok","urls":{"url":[{"codebase":"https://` + extension.GetS3ExtensionBucketHost(lightThemeExtensionID) + `/release/ldimlcelhnjgpjjemdjokpgeeikdinbm/extension_1_0_0.crx"}]},"manifest":{"version":"1.0.0","packages":{"package":[{"name":"extension_1_0_0.crx","fp":"1c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618","hash_sha256":"1c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618","required":true}]}}}},{"appid":"bfdgpgibhagkpdlnjonhkabjoijopoge","status":"ok","updatecheck":{"status":"noupdate"}}]}}`
+	expectedResponse = jsonPrefix + `{"response":{"protocol":"3.1","server":"prod","daystart":{"elapsed_seconds":100,"elapsed_days":6284},"app":[{"appid":"ldimlcelhnjgpjjemdjokpgeeikdinbm","status":"ok","updatecheck":{"status":"ok","urls":{"url":[{"codebase":"https://` + extension.GetS3ExtensionBucketHost(lightThemeExtensionID) + `/release/ldimlcelhnjgpjjemdjokpgeeikdinbm/extension_1_0_0.crx"}]},"manifest":{"version":"1.0.0","packages":{"package":[{"name":"extension_1_0_0.crx","fp":"1c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618","hash_sha256":"1c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618","required":true}]}}}},{"appid":"bfdgpgibhagkpdlnjonhkabjoijopoge","status":"ok","updatecheck":{"status":"noupdate"}}]}}`
 	testCall(t, server, http.MethodPost, contentTypeJSON, "", requestBody, http.StatusOK, expectedResponse, "")
 
 	// Other component of 2 out of date
 	requestBody = lightAndDarkThemeRequest("70.0.0", "0.0.0")
-	expectedResponse = jsonPrefix + `{"response":{"protocol":"3.1","server":"prod","app":[{"appid":"ldimlcelhnjgpjjemdjokpgeeikdinbm","status":"ok","updatecheck":{"status":"noupdate"}},{"appid":"bfdgpgibhagkpdlnjonhkabjoijopoge","status":"ok","updatecheck":{"status":"ok","urls":{"url":[{"codebase":"https://` + extension.GetS3ExtensionBucketHost(darkThemeExtensionID) + `/release/bfdgpgibhagkpdlnjonhkabjoijopoge/extension_1_0_0.crx"}]},"manifest":{"version":"1.0.0","packages":{"package":[{"name":"extension_1_0_0.crx","fp":"ae517d6273a4fc126961cb026e02946db4f9dbb58e3d9bc29f5e1270e3ce9834","hash_sha256":"ae517d6273a4fc126961cb026e02946db4f9dbb58e3d9bc29f5e1270e3ce9834","required":true}]}}}}]}}`
+	expectedResponse = jsonPrefix + `{"response":{"protocol":"3.1","server":"prod","daystart":{"elapsed_seconds":100,"elapsed_days":6284},"app":[{"appid":"ldimlcelhnjgpjjemdjokpgeeikdinbm","status":"ok","updatecheck":{"status":"noupdate"}},{"appid":"bfdgpgibhagkpdlnjonhkabjoijopoge","status":"ok","updatecheck":{"status":"ok","urls":{"url":[{"codebase":"https://` + extension.GetS3ExtensionBucketHost(darkThemeExtensionID) + `/release/bfdgpgibhagkpdlnjonhkabjoijopoge/extension_1_0_0.crx"}]},"manifest":{"version":"1.0.0","packages":{"package":[{"name":"extension_1_0_0.crx","fp":"ae517d6273a4fc126961cb026e02946db4f9dbb58e3d9bc29f5e1270e3ce9834","hash_sha256":"ae517d6273a4fc126961cb026e02946db4f9dbb58e3d9bc29f5e1270e3ce9834","required":true}]}}}}]}}`
 	testCall(t, server, http.MethodPost, contentTypeJSON, "", requestBody, http.StatusOK, expectedResponse, "")
 
 	// Both components need updates
 	requestBody = lightAndDarkThemeRequest("0.0.0", "0.0.0")
-	expectedResponse = jsonPrefix + `{"response":{"protocol":"3.1","server":"prod","app":[{"appid":"ldimlcelhnjgpjjemdjokpgeeikdinbm","status":"ok","updatecheck":{"status":"ok","urls":{"url":[{"codebase":"https://` + extension.GetS3ExtensionBucketHost(lightThemeExtensionID) + `/release/ldimlcelhnjgpjjemdjokpgeeikdinbm/extension_1_0_0.crx"}]},"manifest":{"version":"1.0.0","packages":{"package":[{"name":"extension_1_0_0.crx","fp":"1c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618","hash_sha256":"1c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618","required":true}]}}}},{"appid":"bfdgpgibhagkpdlnjonhkabjoijopoge","status":"ok","updatecheck":{"status":"ok","urls":{"url":[{"codebase":"https://` + extension.GetS3ExtensionBucketHost(darkThemeExtensionID) + `/release/bfdgpgibhagkpdlnjonhkabjoijopoge/extension_1_0_0.crx"}]},"manifest":{"version":"1.0.0","packages":{"package":[{"name":"extension_1_0_0.crx","fp":"ae517d6273a4fc126961cb026e02946db4f9dbb58e3d9bc29f5e1270e3ce9834","hash_sha256":"ae517d6273a4fc126961cb026e02946db4f9dbb58e3d9bc29f5e1270e3ce9834","required":true}]}}}}]}}`
+	expectedResponse = jsonPrefix + `{"response":{"protocol":"3.1","server":"prod","daystart":{"elapsed_seconds":100,"elapsed_days":6284},"app":[{"appid":"ldimlcelhnjgpjjemdjokpgeeikdinbm","status":"ok","updatecheck":{"status":"ok","urls":{"url":[{"codebase":"https://` + extension.GetS3ExtensionBucketHost(lightThemeExtensionID) + `/release/ldimlcelhnjgpjjemdjokpgeeikdinbm/extension_1_0_0.crx"}]},"manifest":{"version":"1.0.0","packages":{"package":[{"name":"extension_1_0_0.crx","fp":"1c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618","hash_sha256":"1c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618","required":true}]}}}},{"appid":"bfdgpgibhagkpdlnjonhkabjoijopoge","status":"ok","updatecheck":{"status":"ok","urls":{"url":[{"codebase":"https://` + extension.GetS3ExtensionBucketHost(darkThemeExtensionID) + `/release/bfdgpgibhagkpdlnjonhkabjoijopoge/extension_1_0_0.crx"}]},"manifest":{"version":"1.0.0","packages":{"package":[{"name":"extension_1_0_0.crx","fp":"ae517d6273a4fc126961cb026e02946db4f9dbb58e3d9bc29f5e1270e3ce9834","hash_sha256":"ae517d6273a4fc126961cb026e02946db4f9dbb58e3d9bc29f5e1270e3ce9834","required":true}]}}}}]}}`
 	testCall(t, server, http.MethodPost, contentTypeJSON, "", requestBody, http.StatusOK, expectedResponse, "")
 
 	// Unknown extension ID goes to Google server via componentupdater proxy
@@ -585,12 +648,12 @@ func TestUpdateExtensionsV3JSON(t *testing.T) {
 
 	// Single new extension out of date that was added in by the refresh timer
 	requestBody = extensiontest.ExtensionRequestFnForJSON("newext1eplbcioakkpcpgfkobkghlhen")("0.0.0")
-	expectedResponse = jsonPrefix + `{"response":{"protocol":"3.1","server":"prod","app":[{"appid":"newext1eplbcioakkpcpgfkobkghlhen","status":"ok","updatecheck":{"status":"ok","urls":{"url":[{"codebase":"https://` + extension.GetS3ExtensionBucketHost(newExtensionID1) + `/release/newext1eplbcioakkpcpgfkobkghlhen/extension_1_0_0.crx"}]},"manifest":{"version":"1.0.0","packages":{"package":[{"name":"extension_1_0_0.crx","fp":"4c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618","hash_sha256":"4c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618","required":true}]}}}}]}}`
+	expectedResponse = jsonPrefix + `{"response":{"protocol":"3.1","server":"prod","daystart":{"elapsed_seconds":100,"elapsed_days":6284},"app":[{"appid":"newext1eplbcioakkpcpgfkobkghlhen","status":"ok","updatecheck":{"status":"ok","urls":{"url":[{"codebase":"https://` + extension.GetS3ExtensionBucketHost(newExtensionID1) + `/release/newext1eplbcioakkpcpgfkobkghlhen/extension_1_0_0.crx"}]},"manifest":{"version":"1.0.0","packages":{"package":[{"name":"extension_1_0_0.crx","fp":"4c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618","hash_sha256":"4c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618","required":true}]}}}}]}}`
 	testCall(t, server, http.MethodPost, contentTypeJSON, "", requestBody, http.StatusOK, expectedResponse, "")
 
 	// Single second new extension out of date that was added in by the refresh timer
 	requestBody = extensiontest.ExtensionRequestFnForJSON("newext2eplbcioakkpcpgfkobkghlhen")("0.0.0")
-	expectedResponse = jsonPrefix + `{"response":{"protocol":"3.1","server":"prod","app":[{"appid":"newext2eplbcioakkpcpgfkobkghlhen","status":"ok","updatecheck":{"status":"ok","urls":{"url":[{"codebase":"https://` + extension.GetS3ExtensionBucketHost(newExtensionID2) + `/release/newext2eplbcioakkpcpgfkobkghlhen/extension_1_0_0.crx"}]},"manifest":{"version":"1.0.0","packages":{"package":[{"name":"extension_1_0_0.crx","fp":"3c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618","hash_sha256":"3c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618","required":true}]}}}}]}}`
+	expectedResponse = jsonPrefix + `{"response":{"protocol":"3.1","server":"prod","daystart":{"elapsed_seconds":100,"elapsed_days":6284},"app":[{"appid":"newext2eplbcioakkpcpgfkobkghlhen","status":"ok","updatecheck":{"status":"ok","urls":{"url":[{"codebase":"https://` + extension.GetS3ExtensionBucketHost(newExtensionID2) + `/release/newext2eplbcioakkpcpgfkobkghlhen/extension_1_0_0.crx"}]},"manifest":{"version":"1.0.0","packages":{"package":[{"name":"extension_1_0_0.crx","fp":"3c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618","hash_sha256":"3c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618","required":true}]}}}}]}}`
 	testCall(t, server, http.MethodPost, contentTypeJSON, "", requestBody, http.StatusOK, expectedResponse, "")
 
 	// Test mixed extension statuses in a single request - one outdated, one current, one unknown
@@ -600,7 +663,7 @@ func TestUpdateExtensionsV3JSON(t *testing.T) {
 
 	// Mixed statuses: outdated (ok), current (noupdate), unknown (error-unknownApplication)
 	requestBody = threeExtensionRequest("0.0.0", "70.0.0", "1.0.0")
-	expectedResponse = jsonPrefix + `{"response":{"protocol":"3.1","server":"prod","app":[{"appid":"` + lightThemeExtensionID + `","status":"ok","updatecheck":{"status":"ok","urls":{"url":[{"codebase":"https://` + extension.GetS3ExtensionBucketHost(lightThemeExtensionID) + `/release/ldimlcelhnjgpjjemdjokpgeeikdinbm/extension_1_0_0.crx"}]},"manifest":{"version":"1.0.0","packages":{"package":[{"name":"extension_1_0_0.crx","fp":"1c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618","hash_sha256":"1c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618","required":true}]}}}},{"appid":"` + darkThemeExtensionID + `","status":"ok","updatecheck":{"status":"noupdate"}},{"appid":"unknown-test-extension","status":"ok","updatecheck":{"status":"error-unknownApplication"}}]}}`
+	expectedResponse = jsonPrefix + `{"response":{"protocol":"3.1","server":"prod","daystart":{"elapsed_seconds":100,"elapsed_days":6284},"app":[{"appid":"` + lightThemeExtensionID + `","status":"ok","updatecheck":{"status":"ok","urls":{"url":[{"codebase":"https://` + extension.GetS3ExtensionBucketHost(lightThemeExtensionID) + `/release/ldimlcelhnjgpjjemdjokpgeeikdinbm/extension_1_0_0.crx"}]},"manifest":{"version":"1.0.0","packages":{"package":[{"name":"extension_1_0_0.crx","fp":"1c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618","hash_sha256":"1c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618","required":true}]}}}},{"appid":"` + darkThemeExtensionID + `","status":"ok","updatecheck":{"status":"noupdate"}},{"appid":"unknown-test-extension","status":"ok","updatecheck":{"status":"error-unknownApplication"}}]}}`
 	testCall(t, server, http.MethodPost, contentTypeJSON, "", requestBody, http.StatusOK, expectedResponse, "")
 
 	// Test with blacklisted extension
@@ -616,7 +679,7 @@ func TestUpdateExtensionsV3JSON(t *testing.T) {
 
 	// Test blacklisted extension returns restricted status
 	requestBody = lightThemeExtension("0.0.0")
-	expectedResponse = jsonPrefix + `{"response":{"protocol":"3.1","server":"prod","app":[{"appid":"` + lightThemeExtensionID + `","status":"ok","updatecheck":{"status":"restricted"}}]}}`
+	expectedResponse = jsonPrefix + `{"response":{"protocol":"3.1","server":"prod","daystart":{"elapsed_seconds":100,"elapsed_days":6284},"app":[{"appid":"` + lightThemeExtensionID + `","status":"ok","updatecheck":{"status":"restricted"}}]}}`
 	testCall(t, server, http.MethodPost, contentTypeJSON, "", requestBody, http.StatusOK, expectedResponse, "")
 
 	// Restore original extensions map
@@ -633,7 +696,7 @@ func TestWebStoreUpdateExtensionV3JSON(t *testing.T) {
 	// Empty query param request, no extensions.
 	requestBody := ""
 	query := ""
-	expectedResponse := `{"gupdate":{"protocol":"3.1","server":"prod","app":[]}}`
+	expectedResponse := `{"gupdate":{"protocol":"3.1","server":"prod","daystart":{"elapsed_seconds":100,"elapsed_days":6284},"app":[]}}`
 	testCall(t, server, http.MethodGet, contentTypeJSON, query, requestBody, http.StatusOK, expectedResponse, "")
 
 	// Extension that we handle which is outdated should produce a response
@@ -641,7 +704,7 @@ func TestWebStoreUpdateExtensionV3JSON(t *testing.T) {
 	outdatedLightThemeExtension.Version = "0.0.0"
 	assert.True(t, ok)
 	query = "?" + getQueryParams(&outdatedLightThemeExtension)
-	expectedResponse = `{"gupdate":{"protocol":"3.1","server":"prod","app":[{"appid":"ldimlcelhnjgpjjemdjokpgeeikdinbm","status":"ok","updatecheck":{"status":"ok","codebase":"https://` + extension.GetS3ExtensionBucketHost(lightThemeExtensionID) + `/release/ldimlcelhnjgpjjemdjokpgeeikdinbm/extension_1_0_0.crx","version":"1.0.0","hash_sha256":"1c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618"}}]}}`
+	expectedResponse = `{"gupdate":{"protocol":"3.1","server":"prod","daystart":{"elapsed_seconds":100,"elapsed_days":6284},"app":[{"appid":"ldimlcelhnjgpjjemdjokpgeeikdinbm","status":"ok","updatecheck":{"status":"ok","codebase":"https://` + extension.GetS3ExtensionBucketHost(lightThemeExtensionID) + `/release/ldimlcelhnjgpjjemdjokpgeeikdinbm/extension_1_0_0.crx","version":"1.0.0","hash_sha256":"1c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618"}}]}}`
 	testCall(t, server, http.MethodGet, contentTypeJSON, query, requestBody, http.StatusOK, expectedResponse, "")
 
 	// Multiple extensions that we handle which are outdated should produce a response
@@ -649,14 +712,14 @@ func TestWebStoreUpdateExtensionV3JSON(t *testing.T) {
 	assert.True(t, ok)
 	outdatedDarkThemeExtension.Version = "0.0.0"
 	query = "?" + getQueryParams(&outdatedLightThemeExtension) + "&" + getQueryParams(&outdatedDarkThemeExtension)
-	expectedResponse = `{"gupdate":{"protocol":"3.1","server":"prod","app":[{"appid":"ldimlcelhnjgpjjemdjokpgeeikdinbm","status":"ok","updatecheck":{"status":"ok","codebase":"https://` + extension.GetS3ExtensionBucketHost(lightThemeExtensionID) + `/release/ldimlcelhnjgpjjemdjokpgeeikdinbm/extension_1_0_0.crx","version":"1.0.0","hash_sha256":"1c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618"}},{"appid":"bfdgpgibhagkpdlnjonhkabjoijopoge","status":"ok","updatecheck":{"status":"ok","codebase":"https://` + extension.GetS3ExtensionBucketHost(darkThemeExtensionID) + `/release/bfdgpgibhagkpdlnjonhkabjoijopoge/extension_1_0_0.crx","version":"1.0.0","hash_sha256":"ae517d6273a4fc126961cb026e02946db4f9dbb58e3d9bc29f5e1270e3ce9834"}}]}}`
+	expectedResponse = `{"gupdate":{"protocol":"3.1","server":"prod","daystart":{"elapsed_seconds":100,"elapsed_days":6284},"app":[{"appid":"ldimlcelhnjgpjjemdjokpgeeikdinbm","status":"ok","updatecheck":{"status":"ok","codebase":"https://` + extension.GetS3ExtensionBucketHost(lightThemeExtensionID) + `/release/ldimlcelhnjgpjjemdjokpgeeikdinbm/extension_1_0_0.crx","version":"1.0.0","hash_sha256":"1c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618"}},{"appid":"bfdgpgibhagkpdlnjonhkabjoijopoge","status":"ok","updatecheck":{"status":"ok","codebase":"https://` + extension.GetS3ExtensionBucketHost(darkThemeExtensionID) + `/release/bfdgpgibhagkpdlnjonhkabjoijopoge/extension_1_0_0.crx","version":"1.0.0","hash_sha256":"ae517d6273a4fc126961cb026e02946db4f9dbb58e3d9bc29f5e1270e3ce9834"}}]}}`
 	testCall(t, server, http.MethodGet, contentTypeJSON, query, requestBody, http.StatusOK, expectedResponse, "")
 
 	// Extension that we handle which is up to date should NOT produce an update but still be successful
 	lightThemeExtension, ok := allExtensionsMap.Load("ldimlcelhnjgpjjemdjokpgeeikdinbm")
 	assert.True(t, ok)
 	query = "?" + getQueryParams(&lightThemeExtension)
-	expectedResponse = `{"gupdate":{"protocol":"3.1","server":"prod","app":[]}}`
+	expectedResponse = `{"gupdate":{"protocol":"3.1","server":"prod","daystart":{"elapsed_seconds":100,"elapsed_days":6284},"app":[]}}`
 	testCall(t, server, http.MethodGet, contentTypeJSON, query, requestBody, http.StatusOK, expectedResponse, "")
 
 	// Unknown extension ID goes to Google server
@@ -678,7 +741,7 @@ func TestWebStoreUpdateExtensionV3JSON(t *testing.T) {
 		Version: "0.0.0",
 	}
 	query = "?" + getQueryParams(&unknownExtension) + "&" + getQueryParams(&unknownExtension2)
-	expectedResponse = `{"gupdate":{"protocol":"3.1","server":"prod","app":[]}}`
+	expectedResponse = `{"gupdate":{"protocol":"3.1","server":"prod","daystart":{"elapsed_seconds":100,"elapsed_days":6284},"app":[]}}`
 	testCall(t, server, http.MethodGet, contentTypeJSON, query, requestBody, http.StatusOK, expectedResponse, "")
 }
 
@@ -1104,3 +1167,484 @@ func TestUpdateExtensionsV4JSON(t *testing.T) {
 	controller.AllExtensionsMap = extension.NewExtensionMap()
 	controller.AllExtensionsMap.StoreExtensions(&extension.OfferedExtensions)
 }
+
+func TestWebStoreUpdateExtensionReleases(t *testing.T) {
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	originalAllExtensionsMap := controller.AllExtensionsMap
+	defer func() { controller.AllExtensionsMap = originalAllExtensionsMap }()
+	controller.AllExtensionsMap = extension.NewExtensionMap()
+	lightThemeExtension, ok := originalAllExtensionsMap.Load(lightThemeExtensionID)
+	assert.True(t, ok)
+	lightThemeExtension.Version = "2.0.0"
+	lightThemeExtension.SHA256 = "new-sha256"
+	lightThemeExtension.RolloutPercentage = 0
+	lightThemeExtension.PreviousRelease = &extension.Release{Version: "1.0.0", SHA256: "previous-sha256"}
+	lightThemeExtension.Channels = map[string]*extension.Release{extension.ChannelBeta: {Version: "2.1.0", SHA256: "beta-sha256"}}
+	lightThemeExtension.OS = []string{"mac", "win"}
+	controller.AllExtensionsMap.Store(lightThemeExtensionID, lightThemeExtension)
+	outdated := extension.Extension{ID: lightThemeExtensionID, Version: "0.0.0"}
+	expectedResponse := func(status string, version string, sha256 string) string {
+		if status != "ok" {
+			return `<gupdate protocol="3.1" server="prod">
+    <daystart elapsed_seconds="100" elapsed_days="6284"></daystart>
+    <app appid="ldimlcelhnjgpjjemdjokpgeeikdinbm" status="ok">
+        <updatecheck status="` + status + `"></updatecheck>
+    </app>
+</gupdate>`
+		}
+		return `<gupdate protocol="3.1" server="prod">
+    <daystart elapsed_seconds="100" elapsed_days="6284"></daystart>
+    <app appid="ldimlcelhnjgpjjemdjokpgeeikdinbm" status="ok">
+        <updatecheck status="ok" codebase="https://` + extension.GetS3ExtensionBucketHost(lightThemeExtensionID) + `/release/ldimlcelhnjgpjjemdjokpgeeikdinbm/extension_` + strings.ReplaceAll(version, ".", "_") + `.crx" version="` + version + `" hash_sha256="` + sha256 + `"></updatecheck>
+    </app>
+</gupdate>`
+	}
+
+	// Clients of GET requests don't identify themselves, they are offered the new
+	// version by the chance of the rollout percentage
+	query := "?os=mac&" + getQueryParams(&outdated)
+	testCall(t, server, http.MethodGet, contentTypeXML, query, "", http.StatusOK, expectedResponse("ok", "1.0.0", "previous-sha256"), "")
+	lightThemeExtension.RolloutPercentage = 100
+	controller.AllExtensionsMap.Store(lightThemeExtensionID, lightThemeExtension)
+	testCall(t, server, http.MethodGet, contentTypeXML, query, "", http.StatusOK, expectedResponse("ok", "2.0.0", "new-sha256"), "")
+
+	// So are clients of update requests without a userid, like Chromium's
+	requestBody := `{"request":{"protocol":"3.1","sessionid":"{session}","os":{"platform":"Mac OS X"},"app":[{"appid":"` + lightThemeExtensionID + `","version":"0.0.0","updatecheck":{}}]}}`
+	resp, err := http.Post(server.URL+"/extensions", contentTypeJSON, strings.NewReader(requestBody))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	assert.Contains(t, string(body), `"version":"2.0.0"`)
+	assert.Contains(t, string(body), `"hash_sha256":"new-sha256"`)
+	lightThemeExtension.RolloutPercentage = 0
+	controller.AllExtensionsMap.Store(lightThemeExtensionID, lightThemeExtension)
+
+	// Clients get the releases of their channel
+	query = "?os=mac&prodchannel=beta&" + getQueryParams(&outdated)
+	testCall(t, server, http.MethodGet, contentTypeXML, query, "", http.StatusOK, expectedResponse("ok", "2.1.0", "beta-sha256"), "")
+
+	// Clients on other platforms are not offered the extension
+	query = "?os=linux&" + getQueryParams(&outdated)
+	testCall(t, server, http.MethodGet, contentTypeXML, query, "", http.StatusOK, expectedResponse("error-osnotsupported", "", ""), "")
+}
+
+func TestWebStoreUpdateExtensionBrowserVersion(t *testing.T) {
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	originalAllExtensionsMap := controller.AllExtensionsMap
+	defer func() { controller.AllExtensionsMap = originalAllExtensionsMap }()
+	controller.AllExtensionsMap = extension.NewExtensionMap()
+	lightThemeExtension, ok := originalAllExtensionsMap.Load(lightThemeExtensionID)
+	assert.True(t, ok)
+	lightThemeExtension.MinBrowserVersion = "200.0"
+	controller.AllExtensionsMap.Store(lightThemeExtensionID, lightThemeExtension)
+	outdated := extension.Extension{ID: lightThemeExtensionID, Version: "0.0.0"}
+
+	// Browsers which can't load the package are not offered it
+	expectedResponse := `<gupdate protocol="3.1" server="prod">
+    <daystart elapsed_seconds="100" elapsed_days="6284"></daystart>
+</gupdate>`
+	testCall(t, server, http.MethodGet, contentTypeXML, "?prodversion=1.0&"+getQueryParams(&outdated), "", http.StatusOK, expectedResponse, "")
+
+	expectedResponse = `<gupdate protocol="3.1" server="prod">
+    <daystart elapsed_seconds="100" elapsed_days="6284"></daystart>
+    <app appid="ldimlcelhnjgpjjemdjokpgeeikdinbm" status="ok">
+        <updatecheck status="ok" codebase="https://` + extension.GetS3ExtensionBucketHost(lightThemeExtensionID) + `/release/ldimlcelhnjgpjjemdjokpgeeikdinbm/extension_1_0_0.crx" version="1.0.0" hash_sha256="1c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618"></updatecheck>
+    </app>
+</gupdate>`
+	testCall(t, server, http.MethodGet, contentTypeXML, "?prodversion=200.0.1&"+getQueryParams(&outdated), "", http.StatusOK, expectedResponse, "")
+}
+
+func TestWebStoreUpdateExtensionSignedURLs(t *testing.T) {
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	originalAllExtensionsMap := controller.AllExtensionsMap
+	defer func() { controller.AllExtensionsMap = originalAllExtensionsMap }()
+	controller.AllExtensionsMap = extension.NewExtensionMap()
+	controller.AllExtensionsMap.StoreExtensions(&extension.OfferedExtensions)
+	privateExtension, ok := controller.AllExtensionsMap.Load(lightThemeExtensionID)
+	assert.True(t, ok)
+	privateExtension.SignedURLs = true
+	controller.AllExtensionsMap.Store(lightThemeExtensionID, privateExtension)
+	outdated := extension.Extension{ID: lightThemeExtensionID, Version: "0.0.0"}
+
+	// Private packages are not offered without a signer
+	expectedResponse := `<gupdate protocol="3.1" server="prod">
+    <daystart elapsed_seconds="100" elapsed_days="6284"></daystart>
+    <app appid="ldimlcelhnjgpjjemdjokpgeeikdinbm" status="ok">
+        <updatecheck status="error-internal"></updatecheck>
+    </app>
+</gupdate>`
+	testCall(t, server, http.MethodGet, contentTypeXML, "?"+getQueryParams(&outdated), "", http.StatusOK, expectedResponse, "")
+
+	// With a signer, they are offered with a signed URL
+	extension.SetURLSigner(extension.NewURLSigner([]byte("secret"), time.Hour))
+	defer extension.SetURLSigner(nil)
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/extensions?"+getQueryParams(&outdated), nil)
+	assert.Nil(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	assert.Contains(t, string(body), `/extension_1_0_0.crx?Expires=`)
+}
+
+func TestUpdateExtensionsV4XML(t *testing.T) {
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	// Protocol v4 requests in XML are answered with protocol 3.1 XML
+	requestBody := `<?xml version="1.0" encoding="UTF-8"?>
+		<request protocol="4.0" updater="BraveComponentUpdater" acceptformat="crx3,puff">
+			<app appid="` + lightThemeExtensionID + `" version="0.0.0"><updatecheck/></app>
+			<app appid="` + darkThemeExtensionID + `" version="1.0.0"><updatecheck/></app>
+		</request>`
+	expectedResponse := `<response protocol="3.1" server="prod">
+    <daystart elapsed_seconds="100" elapsed_days="6284"></daystart>
+    <app appid="ldimlcelhnjgpjjemdjokpgeeikdinbm">
+        <updatecheck status="ok">
+            <urls>
+                <url codebase="https://` + extension.GetS3ExtensionBucketHost(lightThemeExtensionID) + `/release/ldimlcelhnjgpjjemdjokpgeeikdinbm/extension_1_0_0.crx"></url>
+            </urls>
+            <manifest version="1.0.0">
+                <packages>
+                    <package name="extension_1_0_0.crx" fp="1c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618" hash_sha256="1c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618" required="true"></package>
+                </packages>
+            </manifest>
+        </updatecheck>
+    </app>
+    <app appid="bfdgpgibhagkpdlnjonhkabjoijopoge">
+        <updatecheck status="noupdate"></updatecheck>
+    </app>
+</response>`
+	testCall(t, server, http.MethodPost, contentTypeXML, "", requestBody, http.StatusOK, expectedResponse, "")
+}
+
+func TestCUPSigning(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	der, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err)
+	keyPath := filepath.Join(t.TempDir(), "cup-9.pem")
+	assert.Nil(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0o600))
+	t.Setenv("CUP_KEYS", "9="+keyPath)
+
+	serverCtx, _ := logger.Setup(context.Background())
+	_, router := setupRouter(serverCtx, true)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	requestBody := extensiontest.ExtensionRequestFnForJSON(lightThemeExtensionID)("0.0.0")
+	post := func(query string) (*http.Response, []byte) {
+		resp, err := http.Post(server.URL+"/extensions"+query, contentTypeJSON, strings.NewReader(requestBody))
+		assert.Nil(t, err)
+		defer func() { _ = resp.Body.Close() }()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		body, err := io.ReadAll(resp.Body)
+		assert.Nil(t, err)
+		return resp, body
+	}
+
+	// The proof signs the request, the uncompressed response and cup2key
+	cup2key := "9:2813587112"
+	resp, responseBody := post("?cup2key=" + cup2key)
+	assert.True(t, strings.Contains(string(responseBody), lightThemeExtensionID))
+	signatureHex, requestHashHex, ok := strings.Cut(resp.Header.Get("X-Cup-Server-Proof"), ":")
+	assert.True(t, ok)
+	requestHash := sha256.Sum256([]byte(requestBody))
+	assert.Equal(t, hex.EncodeToString(requestHash[:]), requestHashHex)
+
+	responseHash := sha256.Sum256(responseBody)
+	message := append(append(requestHash[:], responseHash[:]...), cup2key...)
+	messageHash := sha256.Sum256(message)
+	digest := sha256.Sum256(messageHash[:])
+	signature, err := hex.DecodeString(signatureHex)
+	assert.Nil(t, err)
+	assert.True(t, ecdsa.VerifyASN1(&key.PublicKey, digest[:], signature))
+
+	// Unknown key versions and requests without cup2key are not signed
+	resp, _ = post("?cup2key=10:2813587112")
+	assert.Equal(t, "", resp.Header.Get("X-Cup-Server-Proof"))
+	resp, _ = post("")
+	assert.Equal(t, "", resp.Header.Get("X-Cup-Server-Proof"))
+}
+
+func TestUpdateExtensionsUpstreamProxy(t *testing.T) {
+	unknownExtensionID := "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	upstreamDelay := time.Duration(0)
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(upstreamDelay)
+		body, err := io.ReadAll(r.Body)
+		assert.Nil(t, err)
+		assert.Equal(t, "", r.URL.Query().Get("cup2key"))
+		// Only the unknown extension is forwarded
+		assert.True(t, strings.Contains(string(body), unknownExtensionID))
+		assert.False(t, strings.Contains(string(body), lightThemeExtensionID))
+		if r.URL.Path == "/service/update2" {
+			// Protocol 3.0 requests are forwarded as protocol 3.1 requests
+			assert.Contains(t, string(body), `<request protocol="3.1"`)
+			assert.Contains(t, string(body), `<app fp="unknown-fp" appid="`+unknownExtensionID+`"`)
+			_, _ = w.Write([]byte(`<response protocol="3.1" server="upstream"><app appid="` + unknownExtensionID + `" status="ok"><updatecheck status="noupdate"/></app></response>`))
+			return
+		}
+		assert.Equal(t, "/service/update2/json", r.URL.Path)
+		_, _ = w.Write([]byte(")]}'\n" + `{"response":{"protocol":"3.1","server":"upstream","app":[{"appid":"` + unknownExtensionID + `","status":"ok","updatecheck":{"status":"noupdate"}}]}}`))
+	}))
+	defer upstream.Close()
+
+	t.Setenv("COMPONENT_UPDATER_HOST", strings.TrimPrefix(upstream.URL, "https://"))
+	controller.UpstreamProxyEnabled = true
+	controller.UpstreamHTTPClient = upstream.Client()
+	defer func() {
+		controller.UpstreamProxyEnabled = false
+		controller.UpstreamHTTPClient = &http.Client{}
+	}()
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	requestBody := `{"request":{"protocol":"3.1","@updater":"BraveComponentUpdater","app":[{"appid":"` + lightThemeExtensionID + `","version":"0.0.0"},{"appid":"` + unknownExtensionID + `","version":"1.0.0"}]}}`
+	post := func() map[string]string {
+		resp, err := http.Post(server.URL+"/extensions?cup2key=9:1", contentTypeJSON, strings.NewReader(requestBody))
+		assert.Nil(t, err)
+		defer func() { _ = resp.Body.Close() }()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		data, err := io.ReadAll(resp.Body)
+		assert.Nil(t, err)
+
+		var response struct {
+			Response struct {
+				App []struct {
+					AppID       string `json:"appid"`
+					UpdateCheck struct {
+						Status string `json:"status"`
+					} `json:"updatecheck"`
+				} `json:"app"`
+			} `json:"response"`
+		}
+		assert.Nil(t, json.Unmarshal(bytes.TrimPrefix(data, []byte(")]}'\n")), &response))
+		statuses := map[string]string{}
+		for _, app := range response.Response.App {
+			statuses[app.AppID] = app.UpdateCheck.Status
+		}
+		return statuses
+	}
+
+	// The upstream answer is merged into our own
+	statuses := post()
+	assert.Equal(t, 2, len(statuses))
+	assert.Equal(t, "ok", statuses[lightThemeExtensionID])
+	assert.Equal(t, "noupdate", statuses[unknownExtensionID])
+
+	// Upstream answers to protocol 3.0 requests are in the protocol 3.1 of the response
+	xmlRequestBody := `<?xml version="1.0" encoding="UTF-8"?>
+		<request protocol="3.0" updater="BraveComponentUpdater">
+		<app appid="` + lightThemeExtensionID + `" version="0.0.0"><updatecheck/></app>
+		<app appid="` + unknownExtensionID + `" version="1.0.0"><updatecheck/><packages><package fp="unknown-fp"/></packages></app>
+		</request>`
+	resp, err := http.Post(server.URL+"/extensions", contentTypeXML, strings.NewReader(xmlRequestBody))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	data, err := io.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(string(data), `<response protocol="3.1" server="prod">`))
+	assert.Contains(t, string(data), `<app appid="`+lightThemeExtensionID+`">`)
+	assert.Contains(t, string(data), `<app appid="`+unknownExtensionID+`" status="ok"><updatecheck status="noupdate"/></app></response>`)
+
+	// Only the extensions sent upstream fail when the upstream updater times out
+	upstreamDelay = time.Millisecond * 200
+	controller.UpstreamProxyTimeout = time.Millisecond * 50
+	defer func() { controller.UpstreamProxyTimeout = time.Second * 5 }()
+	statuses = post()
+	assert.Equal(t, "ok", statuses[lightThemeExtensionID])
+	assert.Equal(t, "error-internal", statuses[unknownExtensionID])
+}
+
+func TestUpdateExtensionsRouting(t *testing.T) {
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	extension.SetRoutingTable(&extension.RoutingTable{Rules: []extension.RoutingRule{
+		{AppID: darkThemeExtensionID, Action: extension.RouteDeny},
+		{AppID: lightThemeExtensionID, UpdaterType: "chromiumcrx", Action: extension.RouteRedirect, Host: "updates.example.com"},
+	}})
+	defer extension.SetRoutingTable(nil)
+
+	jsonPrefix := ")]}'\n"
+
+	// Denied extensions are restricted, even if they are in the catalog
+	requestBody := extensiontest.ExtensionRequestFnForTwoJSON(lightThemeExtensionID, darkThemeExtensionID)("0.0.0", "0.0.0")
+	expectedResponse := jsonPrefix + `{"response":{"protocol":"3.1","server":"prod","daystart":{"elapsed_seconds":100,"elapsed_days":6284},"app":[{"appid":"ldimlcelhnjgpjjemdjokpgeeikdinbm","status":"ok","updatecheck":{"status":"ok","urls":{"url":[{"codebase":"https://` + extension.GetS3ExtensionBucketHost(lightThemeExtensionID) + `/release/ldimlcelhnjgpjjemdjokpgeeikdinbm/extension_1_0_0.crx"}]},"manifest":{"version":"1.0.0","packages":{"package":[{"name":"extension_1_0_0.crx","fp":"1c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618","hash_sha256":"1c714fadd4208c63f74b707e4c12b81b3ad0153c37de1348fa810dd47cfc5618","required":true}]}}}},{"appid":"bfdgpgibhagkpdlnjonhkabjoijopoge","status":"ok","updatecheck":{"status":"restricted"}}]}}`
+	testCall(t, server, http.MethodPost, contentTypeJSON, "", requestBody, http.StatusOK, expectedResponse, "")
+
+	// Rules may apply to a single updater type only
+	requestBody = `<?xml version="1.0" encoding="UTF-8"?><request protocol="3.1" updater="chromiumcrx"><app appid="` + lightThemeExtensionID + `" version="0.0.0"><updatecheck/></app></request>`
+	testCall(t, server, http.MethodPost, contentTypeXML, "?foo=bar", requestBody, http.StatusTemporaryRedirect, "", "https://updates.example.com/service/update2?foo=bar")
+
+	// GET requests are routed too
+	lightThemeExtension := extension.Extension{ID: lightThemeExtensionID, Version: "0.0.0"}
+	darkThemeExtension := extension.Extension{ID: darkThemeExtensionID, Version: "0.0.0"}
+	query := "?" + getQueryParams(&lightThemeExtension)
+	redirectLocation := "https://updates.example.com/service/update2/crx" + query
+	testCall(t, server, http.MethodGet, contentTypeXML, query, "", http.StatusTemporaryRedirect, `<a href="`+redirectLocation+`">Temporary Redirect</a>.`, redirectLocation)
+	query = "?" + getQueryParams(&darkThemeExtension)
+	expectedResponse = `<gupdate protocol="3.1" server="prod">
+    <daystart elapsed_seconds="100" elapsed_days="6284"></daystart>
+    <app appid="bfdgpgibhagkpdlnjonhkabjoijopoge" status="ok">
+        <updatecheck status="restricted"></updatecheck>
+    </app>
+</gupdate>`
+	testCall(t, server, http.MethodGet, contentTypeXML, query, "", http.StatusOK, expectedResponse, "")
+}
+
+func TestUpdateExtensionsDenylist(t *testing.T) {
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	denylist, err := extension.NewDenylist([]extension.DenylistEntry{
+		{ID: newExtensionID1, Reason: extension.DenyReasonMalware, Source: "malware report 1234"},
+		{ID: "takendownextensionaaaaaaaaaaaaaa", Reason: extension.DenyReasonLegal, Source: "takedown notice", Status: "error-unknownApplication"},
+	})
+	assert.Nil(t, err)
+	extension.SetDenylist(denylist)
+	defer extension.SetDenylist(nil)
+
+	// Denylisted extensions are not redirected
+	requestBody := extensiontest.ExtensionRequestFnForXML(newExtensionID1)("0.0.0")
+	expectedResponse := `<response protocol="3.1" server="prod">
+    <daystart elapsed_seconds="100" elapsed_days="6284"></daystart>
+    <app appid="newext1eplbcioakkpcpgfkobkghlhen">
+        <updatecheck status="restricted"></updatecheck>
+    </app>
+</response>`
+	testCall(t, server, http.MethodPost, contentTypeXML, "", requestBody, http.StatusOK, expectedResponse, "")
+
+	requestBody = extensiontest.ExtensionRequestFnForTwoJSON(lightThemeExtensionID, "takendownextensionaaaaaaaaaaaaaa")("1.0.0", "0.0.0")
+	expectedResponse = ")]}'\n" + `{"response":{"protocol":"3.1","server":"prod","daystart":{"elapsed_seconds":100,"elapsed_days":6284},"app":[{"appid":"ldimlcelhnjgpjjemdjokpgeeikdinbm","status":"ok","updatecheck":{"status":"noupdate"}},{"appid":"takendownextensionaaaaaaaaaaaaaa","status":"ok","updatecheck":{"status":"error-unknownApplication"}}]}}`
+	testCall(t, server, http.MethodPost, contentTypeJSON, "", requestBody, http.StatusOK, expectedResponse, "")
+
+	denylisted := extension.Extension{ID: "takendownextensionaaaaaaaaaaaaaa", Version: "0.0.0"}
+	expectedResponse = `<gupdate protocol="3.1" server="prod">
+    <daystart elapsed_seconds="100" elapsed_days="6284"></daystart>
+    <app appid="takendownextensionaaaaaaaaaaaaaa" status="ok">
+        <updatecheck status="error-unknownApplication"></updatecheck>
+    </app>
+</gupdate>`
+	testCall(t, server, http.MethodGet, contentTypeXML, "?"+getQueryParams(&denylisted), "", http.StatusOK, expectedResponse, "")
+}
+
+func TestUpdateExtensionsPingback(t *testing.T) {
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	controller.EventSink = extension.NewEventAggregator(extension.DefaultStatsBucketSize, extension.DefaultStatsBucketCount, extension.DefaultEventAggregatorMaxKeys)
+	defer func() {
+		controller.EventSink = nil
+	}()
+
+	// Pingbacks are not answered, whatever their protocol and format
+	requestBody := `{"request":{"protocol":"3.1","@updater":"BraveComponentUpdater","app":[{"appid":"` + lightThemeExtensionID + `","version":"1.0.0","event":[{"eventtype":3,"eventresult":1,"previousversion":"0.9.0","nextversion":"1.0.0"}]}]}}`
+	testCall(t, server, http.MethodPost, contentTypeJSON, "", requestBody, http.StatusNoContent, "", "")
+
+	requestBody = `{"request":{"protocol":"4.0","@updater":"BraveComponentUpdater","apps":[{"appid":"` + lightThemeExtensionID + `","version":"1.0.0","events":[{"eventtype":3,"eventresult":0,"errorcode":12}]}]}}`
+	testCall(t, server, http.MethodPost, contentTypeJSON, "", requestBody, http.StatusNoContent, "", "")
+
+	requestBody = `<?xml version="1.0" encoding="UTF-8"?>
+<request protocol="3.1" updater="BraveComponentUpdater">
+  <app appid="` + lightThemeExtensionID + `" version="1.0.0">
+    <event eventtype="3" eventresult="1" previousversion="0.9.0" nextversion="1.0.0"/>
+  </app>
+</request>`
+	testCall(t, server, http.MethodPost, contentTypeXML, "", requestBody, http.StatusNoContent, "", "")
+
+	// Invalid events are left out
+	requestBody = `{"request":{"protocol":"3.1","app":[{"appid":"","event":[{"eventtype":3,"eventresult":1}]}]}}`
+	testCall(t, server, http.MethodPost, contentTypeJSON, "", requestBody, http.StatusNoContent, "", "")
+
+	// Events of apps which aren't in the catalog are counted together
+	requestBody = `{"request":{"protocol":"3.1","app":[{"appid":"aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa","version":"1.0.0","event":[{"eventtype":3,"eventresult":1}]},{"appid":"zzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzz","version":"2.0.0","event":[{"eventtype":3,"eventresult":1}]}]}}`
+	testCall(t, server, http.MethodPost, contentTypeJSON, "", requestBody, http.StatusNoContent, "", "")
+
+	// The counts are returned by /extensions/stats
+	resp, err := http.Get(server.URL + "/extensions/stats")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var stats struct {
+		Events []extension.EventWindow
+	}
+	assert.Nil(t, json.UnmarshalRead(resp.Body, &stats))
+	expectedCounts := []extension.EventCount{
+		{EventCountKey: extension.EventCountKey{AppID: lightThemeExtensionID, AppVersion: "1.0.0", EventType: extension.EventTypeUpdate, EventResult: extension.EventResultError, ErrorCode: 12}, Count: 1},
+		{EventCountKey: extension.EventCountKey{AppID: lightThemeExtensionID, AppVersion: "1.0.0", EventType: extension.EventTypeUpdate, EventResult: extension.EventResultSuccess}, Count: 2},
+		{EventCountKey: extension.EventCountKey{AppID: extension.UnknownAppID, EventType: extension.EventTypeUpdate, EventResult: extension.EventResultSuccess}, Count: 2},
+	}
+	assert.Equal(t, []extension.EventWindow{
+		{Window: "1h", Counts: expectedCounts},
+		{Window: "24h", Counts: expectedCounts},
+	}, stats.Events)
+}
+
+func TestPrintStats(t *testing.T) {
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	originalStats, originalActives := controller.Stats, controller.Actives
+	controller.Stats = extension.NewStatsAggregator(extension.DefaultStatsBucketSize, extension.DefaultStatsBucketCount, extension.DefaultStatsMaxKeys)
+	controller.Actives = extension.NewActiveCounter(extension.DefaultActiveCounterMaxKeys)
+	defer func() {
+		controller.Stats, controller.Actives = originalStats, originalActives
+	}()
+	controller.AllExtensionsMap = extension.NewExtensionMap()
+	controller.AllExtensionsMap.StoreExtensions(&extension.OfferedExtensions)
+
+	requestBody := extensiontest.ExtensionRequestFnForTwoJSON(lightThemeExtensionID, darkThemeExtensionID)("0.9.0", "1.0.0")
+	resp, err := http.Post(server.URL+"/extensions", contentTypeJSON, strings.NewReader(requestBody))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	// Clients which checked in yesterday and are active are counted
+	yesterday := strconv.Itoa(extension.ElapsedDays(time.Now()) - 1)
+	requestBody = `{"request":{"protocol":"3.1","app":[{"appid":"` + lightThemeExtensionID + `","version":"1.0.0","ping":{"rd":` + yesterday + `,"ad":` + yesterday + `}}]}}`
+	resp, err = http.Post(server.URL+"/extensions", contentTypeJSON, strings.NewReader(requestBody))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	requestBody = `{"request":{"protocol":"3.1","app":[{"appid":"` + lightThemeExtensionID + `","version":"0.9.0","event":[{"eventtype":3,"eventresult":1,"previousversion":"0.9.0","nextversion":"1.0.0"}]}]}}`
+	testCall(t, server, http.MethodPost, contentTypeJSON, "", requestBody, http.StatusNoContent, "", "")
+	// Apps which aren't in the catalog are counted together, whatever their ID and version
+	requestBody = `{"request":{"protocol":"3.1","app":[{"appid":"aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa","version":"1.0.0","ping":{"rd":` + yesterday + `,"ad":` + yesterday + `}},{"appid":"zzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzz","version":"2.0.0"}]}}`
+	resp, err = http.Post(server.URL+"/extensions", contentTypeJSON, strings.NewReader(requestBody))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	requestBody = `{"request":{"protocol":"3.1","app":[{"appid":"aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa","version":"1.0.0","event":[{"eventtype":3,"eventresult":1,"previousversion":"0.9.0","nextversion":"1.0.0"}]}]}}`
+	testCall(t, server, http.MethodPost, contentTypeJSON, "", requestBody, http.StatusNoContent, "", "")
+
+	resp, err = http.Get(server.URL + "/extensions/stats")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("content-type"))
+	var stats struct {
+		Windows []extension.StatsWindow
+		Actives []extension.ActiveCount
+	}
+	assert.Nil(t, json.UnmarshalRead(resp.Body, &stats))
+
+	expectedStats := []extension.VersionStats{
+		{StatsKey: extension.StatsKey{AppID: darkThemeExtensionID, Version: "1.0.0"}, UpdateStats: extension.UpdateStats{UpdateChecks: 1, NoUpdate: 1}},
+		{StatsKey: extension.StatsKey{AppID: lightThemeExtensionID, Version: "0.9.0"}, UpdateStats: extension.UpdateStats{UpdateChecks: 1, UpdatesOffered: 1, EventSuccesses: 1}},
+		{StatsKey: extension.StatsKey{AppID: lightThemeExtensionID, Version: "1.0.0"}, UpdateStats: extension.UpdateStats{UpdateChecks: 1, NoUpdate: 1}},
+		{StatsKey: extension.StatsKey{AppID: extension.UnknownAppID}, UpdateStats: extension.UpdateStats{UpdateChecks: 2, Errors: 2, EventSuccesses: 1}},
+	}
+	assert.Equal(t, []extension.StatsWindow{
+		{Window: "1h", Stats: expectedStats},
+		{Window: "24h", Stats: expectedStats},
+	}, stats.Windows)
+	assert.Equal(t, []extension.ActiveCount{
+		{AppID: lightThemeExtensionID, DailyUsers: 1, DailyActives: 1},
+		{AppID: extension.UnknownAppID, DailyUsers: 1, DailyActives: 1},
+	}, stats.Actives)
+}